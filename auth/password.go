@@ -0,0 +1,35 @@
+// Package auth hashes passwords and issues and verifies the tokens that
+// identify API callers.
+package auth
+
+import "golang.org/x/crypto/bcrypt"
+
+// Password length limits. bcrypt ignores everything past 72 bytes, so longer
+// passwords are refused rather than silently truncated.
+const (
+	MinPasswordLength = 8
+	MaxPasswordLength = 72
+)
+
+// dummyHash is compared against when a login names an unknown account, so
+// that the response takes as long as for a wrong password.
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("not a real password"), bcrypt.DefaultCost)
+
+// HashPassword returns the bcrypt hash of password.
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// CheckPassword reports whether password matches hash. An empty hash never
+// matches but costs as much time as one that doesn't.
+func CheckPassword(hash, password string) bool {
+	if hash == "" {
+		bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+		return false
+	}
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
@@ -0,0 +1,90 @@
+package auth
+
+import (
+	"fmt"
+	"slices"
+)
+
+// Role is the set of permissions granted to a user.
+type Role string
+
+const (
+	RoleViewer Role = "viewer"
+	RoleMember Role = "member"
+	RoleAdmin  Role = "admin"
+)
+
+// Roles lists every role, least privileged first.
+var Roles = []Role{RoleViewer, RoleMember, RoleAdmin}
+
+// DefaultRole is the role of new accounts.
+const DefaultRole = RoleMember
+
+// ParseRole returns the role named s.
+func ParseRole(s string) (Role, error) {
+	for _, role := range Roles {
+		if string(role) == s {
+			return role, nil
+		}
+	}
+	return "", fmt.Errorf("unknown role %q", s)
+}
+
+// Permission is an action the policy can allow or deny.
+type Permission string
+
+const (
+	PermTodosRead   Permission = "todos:read"
+	PermTodosWrite  Permission = "todos:write"
+	PermTodosDelete Permission = "todos:delete"
+	// PermTodosAll extends the other todo permissions to every workspace
+	// rather than only the one the caller works in.
+	PermTodosAll Permission = "todos:all"
+	// PermTodosTrash allows reading the soft deleted todos of a workspace,
+	// which may be anyone's.
+	PermTodosTrash Permission = "todos:trash"
+	PermTodosPurge Permission = "todos:purge"
+	PermLogsRead   Permission = "logs:read"
+	PermUsersAdmin Permission = "users:admin"
+)
+
+// Permissions lists every permission.
+var Permissions = []Permission{
+	PermTodosRead, PermTodosWrite, PermTodosDelete, PermTodosAll, PermTodosTrash, PermTodosPurge, PermLogsRead, PermUsersAdmin,
+}
+
+// policy is the permission matrix: what each role may do.
+var policy = map[Role][]Permission{
+	RoleViewer: {PermTodosRead},
+	RoleMember: {PermTodosRead, PermTodosWrite, PermTodosDelete},
+	RoleAdmin:  Permissions,
+}
+
+// permissionScopes gives the scope an API key needs to use each permission.
+var permissionScopes = map[Permission]Scope{
+	PermTodosRead:   ScopeTodosRead,
+	PermTodosWrite:  ScopeTodosWrite,
+	PermTodosDelete: ScopeTodosWrite,
+	PermTodosAll:    ScopeAdmin,
+	PermTodosTrash:  ScopeTodosRead,
+	PermTodosPurge:  ScopeAdmin,
+	PermLogsRead:    ScopeLogsRead,
+	PermUsersAdmin:  ScopeAdmin,
+}
+
+// Allowed reports whether the policy grants perm to role, and scopes cover
+// it when scopes is not nil, as it is for API keys.
+func Allowed(role Role, scopes []Scope, perm Permission) bool {
+	return slices.Contains(policy[role], perm) && (scopes == nil || slices.Contains(scopes, permissionScopes[perm]))
+}
+
+// Effective returns every permission Allowed grants to role and scopes.
+func Effective(role Role, scopes []Scope) []Permission {
+	perms := []Permission{}
+	for _, perm := range policy[role] {
+		if Allowed(role, scopes, perm) {
+			perms = append(perms, perm)
+		}
+	}
+	return perms
+}
@@ -0,0 +1,67 @@
+package auth_test
+
+import (
+	"reflect"
+	"testing"
+	"todo-api/auth"
+)
+
+func TestParseRole(t *testing.T) {
+	for _, role := range auth.Roles {
+		if got, err := auth.ParseRole(string(role)); err != nil || got != role {
+			t.Errorf("ParseRole(%q) = %q, %v", role, got, err)
+		}
+	}
+	for _, name := range []string{"", "Admin", "owner"} {
+		if _, err := auth.ParseRole(name); err == nil {
+			t.Errorf("ParseRole(%q) succeeded", name)
+		}
+	}
+}
+
+func TestAllowed(t *testing.T) {
+	readOnly := []auth.Scope{auth.ScopeTodosRead}
+	tests := []struct {
+		role   auth.Role
+		scopes []auth.Scope
+		perm   auth.Permission
+		want   bool
+	}{
+		{role: auth.RoleViewer, perm: auth.PermTodosRead, want: true},
+		{role: auth.RoleViewer, perm: auth.PermTodosWrite},
+		{role: auth.RoleMember, perm: auth.PermTodosDelete, want: true},
+		{role: auth.RoleMember, perm: auth.PermTodosTrash},
+		{role: auth.RoleMember, perm: auth.PermLogsRead},
+		{role: auth.RoleAdmin, perm: auth.PermUsersAdmin, want: true},
+		{role: auth.RoleAdmin, perm: auth.PermTodosPurge, want: true},
+		{role: "", perm: auth.PermTodosRead},
+		// Scopes only ever take permissions away
+		{role: auth.RoleAdmin, scopes: readOnly, perm: auth.PermTodosRead, want: true},
+		{role: auth.RoleAdmin, scopes: readOnly, perm: auth.PermTodosTrash, want: true},
+		{role: auth.RoleAdmin, scopes: readOnly, perm: auth.PermTodosWrite},
+		{role: auth.RoleAdmin, scopes: []auth.Scope{}, perm: auth.PermTodosRead},
+		{role: auth.RoleViewer, scopes: auth.Scopes, perm: auth.PermTodosWrite},
+	}
+	for _, tt := range tests {
+		if got := auth.Allowed(tt.role, tt.scopes, tt.perm); got != tt.want {
+			t.Errorf("Allowed(%q, %v, %s) = %v, want %v", tt.role, tt.scopes, tt.perm, got, tt.want)
+		}
+	}
+}
+
+func TestEffective(t *testing.T) {
+	if got, want := auth.Effective(auth.RoleMember, nil),
+		[]auth.Permission{auth.PermTodosRead, auth.PermTodosWrite, auth.PermTodosDelete}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Effective(member) = %v, want %v", got, want)
+	}
+	if got := auth.Effective(auth.RoleAdmin, nil); !reflect.DeepEqual(got, auth.Permissions) {
+		t.Errorf("Effective(admin) = %v, want every permission", got)
+	}
+	if got, want := auth.Effective(auth.RoleAdmin, []auth.Scope{auth.ScopeLogsRead}),
+		[]auth.Permission{auth.PermLogsRead}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Effective(admin, logs:read) = %v, want %v", got, want)
+	}
+	if got := auth.Effective("", nil); got == nil || len(got) != 0 {
+		t.Errorf("Effective of no role = %#v, want an empty list", got)
+	}
+}
@@ -0,0 +1,57 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"strings"
+)
+
+// Scope is a permission an API key can be limited to.
+type Scope string
+
+const (
+	ScopeTodosRead  Scope = "todos:read"
+	ScopeTodosWrite Scope = "todos:write"
+	ScopeLogsRead   Scope = "logs:read"
+	ScopeAdmin      Scope = "admin"
+)
+
+// Scopes lists every known scope.
+var Scopes = []Scope{ScopeTodosRead, ScopeTodosWrite, ScopeLogsRead, ScopeAdmin}
+
+// ParseScope returns the scope named s.
+func ParseScope(s string) (Scope, error) {
+	for _, scope := range Scopes {
+		if string(scope) == s {
+			return scope, nil
+		}
+	}
+	return "", fmt.Errorf("unknown scope %q", s)
+}
+
+// APIKeyPrefix starts every API key, so keys are recognisable in config
+// files and can be told apart from access tokens.
+const APIKeyPrefix = "tdk_"
+
+// NewAPIKey returns a random API key, the hash to store for it and a short
+// prefix of it that identifies the key in listings.
+func NewAPIKey() (key, hash, prefix string, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", "", err
+	}
+	key = APIKeyPrefix + base64.RawURLEncoding.EncodeToString(b)
+	return key, HashAPIKey(key), key[:len(APIKeyPrefix)+6], nil
+}
+
+// IsAPIKey reports whether a bearer token looks like an API key rather than
+// an access token.
+func IsAPIKey(token string) bool {
+	return strings.HasPrefix(token, APIKeyPrefix)
+}
+
+// HashAPIKey returns the stored form of an API key.
+func HashAPIKey(key string) string {
+	return HashRefreshToken(key)
+}
@@ -0,0 +1,36 @@
+package auth_test
+
+import (
+	"strings"
+	"testing"
+	"todo-api/auth"
+)
+
+func TestParseScope(t *testing.T) {
+	for _, scope := range auth.Scopes {
+		if got, err := auth.ParseScope(string(scope)); err != nil || got != scope {
+			t.Errorf("ParseScope(%q) = %q, %v", scope, got, err)
+		}
+	}
+	for _, name := range []string{"", "todos", "TODOS:READ", "todos:read ", "logs:write"} {
+		if _, err := auth.ParseScope(name); err == nil {
+			t.Errorf("ParseScope(%q) succeeded", name)
+		}
+	}
+}
+
+func TestNewAPIKey(t *testing.T) {
+	key, hash, prefix, err := auth.NewAPIKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !auth.IsAPIKey(key) || !strings.HasPrefix(key, prefix) || len(prefix) != len(auth.APIKeyPrefix)+6 {
+		t.Errorf("key %q with prefix %q", key, prefix)
+	}
+	if auth.HashAPIKey(key) != hash || strings.Contains(hash, key) {
+		t.Error("the stored hash does not match the key")
+	}
+	if auth.IsAPIKey("eyJhbGciOiJIUzI1NiJ9.e30.sig") {
+		t.Error("an access token was taken for an API key")
+	}
+}
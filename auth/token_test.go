@@ -0,0 +1,127 @@
+package auth_test
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+	"todo-api/auth"
+
+	"github.com/google/uuid"
+)
+
+func TestIssueAndVerify(t *testing.T) {
+	issuer, _ := auth.NewIssuer("secret", time.Minute)
+	user := uuid.New()
+	now := time.Unix(1_800_000_000, 0)
+	token := issuer.Issue(user, auth.RoleMember, now)
+
+	claims, err := issuer.Verify(token, now.Add(59*time.Second))
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if claims.Subject != user || claims.Role != auth.RoleMember || claims.ExpiresAt != now.Add(time.Minute).Unix() || claims.ID == "" {
+		t.Errorf("claims = %+v", claims)
+	}
+	if other := issuer.Issue(user, auth.RoleMember, now); other == token {
+		t.Error("two tokens issued at once are identical")
+	}
+}
+
+func TestVerifyRejects(t *testing.T) {
+	issuer, _ := auth.NewIssuer("secret", time.Minute)
+	other, _ := auth.NewIssuer("other secret", time.Minute)
+	now := time.Unix(1_800_000_000, 0)
+	token := issuer.Issue(uuid.New(), auth.RoleMember, now)
+	header, rest, _ := strings.Cut(token, ".")
+	payload, sig, _ := strings.Cut(rest, ".")
+	enc := base64.RawURLEncoding
+
+	// escalated swaps the role in the payload but keeps the signature
+	raw, _ := enc.DecodeString(payload)
+	escalated := header + "." + enc.EncodeToString([]byte(strings.Replace(string(raw), `"member"`, `"admin"`, 1))) + "." + sig
+	unsigned := enc.EncodeToString([]byte(`{"alg":"none","typ":"JWT"}`)) + "." + payload + "."
+
+	tests := []struct {
+		name   string
+		issuer *auth.Issuer
+		token  string
+		at     time.Time
+	}{
+		{name: "expired", issuer: issuer, token: token, at: now.Add(time.Minute)},
+		{name: "other key", issuer: other, token: token, at: now},
+		{name: "escalated role", issuer: issuer, token: escalated, at: now},
+		{name: "alg none", issuer: issuer, token: unsigned, at: now},
+		{name: "no signature", issuer: issuer, token: header + "." + payload, at: now},
+		{name: "unknown role", issuer: issuer, token: issuer.Issue(uuid.New(), "root", now), at: now},
+		{name: "no subject", issuer: issuer, token: issuer.Issue(uuid.Nil, auth.RoleAdmin, now), at: now},
+		{name: "garbage", issuer: issuer, token: "a.b.c", at: now},
+		{name: "empty", issuer: issuer, token: "", at: now},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tt.issuer.Verify(tt.token, tt.at); err != auth.ErrInvalidToken {
+				t.Errorf("Verify = %v, want ErrInvalidToken", err)
+			}
+		})
+	}
+}
+
+func TestSealAndOpen(t *testing.T) {
+	issuer, _ := auth.NewIssuer("secret", time.Minute)
+	other, _ := auth.NewIssuer("other secret", time.Minute)
+	sealed := issuer.Seal("state", []byte(`{"nonce":"n"}`))
+
+	payload, err := issuer.Open("state", sealed)
+	if err != nil || string(payload) != `{"nonce":"n"}` {
+		t.Fatalf("Open = %s, %v", payload, err)
+	}
+	enc, sig, _ := strings.Cut(sealed, ".")
+	forged := base64.RawURLEncoding.EncodeToString([]byte("{}")) + "." + sig
+
+	tests := []struct {
+		name    string
+		issuer  *auth.Issuer
+		purpose string
+		sealed  string
+	}{
+		{name: "other purpose", issuer: issuer, purpose: "cursor", sealed: sealed},
+		{name: "other key", issuer: other, purpose: "state", sealed: sealed},
+		{name: "forged payload", issuer: issuer, purpose: "state", sealed: forged},
+		{name: "no signature", issuer: issuer, purpose: "state", sealed: enc},
+	}
+	for _, tt := range tests {
+		if _, err := tt.issuer.Open(tt.purpose, tt.sealed); err != auth.ErrInvalidToken {
+			t.Errorf("%s: Open = %v, want ErrInvalidToken", tt.name, err)
+		}
+	}
+}
+
+func TestRefreshTokens(t *testing.T) {
+	token, hash, err := auth.NewRefreshToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if auth.HashRefreshToken(token) != hash || hash == token {
+		t.Error("the stored hash does not match the token")
+	}
+	if again, _, _ := auth.NewRefreshToken(); again == token {
+		t.Error("two refresh tokens are identical")
+	}
+}
+
+func TestPasswords(t *testing.T) {
+	hash, err := auth.HashPassword("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !auth.CheckPassword(hash, "correct horse") {
+		t.Error("the right password was refused")
+	}
+	if auth.CheckPassword(hash, "Correct horse") {
+		t.Error("a wrong password was accepted")
+	}
+	if auth.CheckPassword("", "") {
+		t.Error("an empty hash matched")
+	}
+}
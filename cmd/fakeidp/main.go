@@ -0,0 +1,43 @@
+// Command fakeidp runs the fake OpenID Connect provider from oidctest, to
+// try out signing in to the API without a real identity provider:
+//
+//	fakeidp -addr :9090 -email alice@example.com -groups todo-admins
+//	todo-api -oidc-issuer http://localhost:9090 -oidc-client-id todo-api \
+//	    -oidc-redirect-url http://localhost:8080/auth/oidc/callback
+//
+// then open http://localhost:8080/auth/oidc/login in a browser. Every
+// sign-in is approved at once as the user described by the flags.
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+	"strings"
+	"todo-api/oidc/oidctest"
+)
+
+func main() {
+	addr := flag.String("addr", ":9090", "HTTP listen address")
+	issuer := flag.String("issuer", "http://localhost:9090", "issuer URL, as the API reaches this server")
+	clientID := flag.String("client-id", "todo-api", "client ID of the API")
+	clientSecret := flag.String("client-secret", "", "client secret of the API (public client when empty)")
+	sub := flag.String("sub", "fake-user", "subject of the signed-in user")
+	email := flag.String("email", "fake-user@example.com", "email of the signed-in user")
+	verified := flag.Bool("email-verified", true, "whether the email is verified")
+	groups := flag.String("groups", "", "comma-separated groups of the signed-in user")
+	flag.Parse()
+
+	p, err := oidctest.NewProvider(*issuer, *clientID, *clientSecret)
+	if err != nil {
+		log.Fatalf("Error starting the provider: %v", err)
+	}
+	claims := map[string]interface{}{"sub": *sub, "email": *email, "email_verified": *verified}
+	if *groups != "" {
+		claims["groups"] = strings.Split(*groups, ",")
+	}
+	p.SetClaims(claims)
+
+	log.Printf("Fake OpenID Connect provider %s listening on %s", *issuer, *addr)
+	log.Fatal(http.ListenAndServe(*addr, p))
+}
@@ -0,0 +1,588 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Config holds every setting the API needs at startup.
+//
+// Values are resolved in this order, each layer overriding the previous one:
+// built-in defaults, the optional config file (YAML or TOML), TODO_* environment
+// variables and finally command-line flags.
+type Config struct {
+	Server    ServerConfig    `yaml:"server" toml:"server"`
+	API       APIConfig       `yaml:"api" toml:"api"`
+	Auth      AuthConfig      `yaml:"auth" toml:"auth"`
+	Storage   StorageConfig   `yaml:"storage" toml:"storage"`
+	Database  DatabaseConfig  `yaml:"database" toml:"database"`
+	Workflow  WorkflowConfig  `yaml:"workflow" toml:"workflow"`
+	Retention RetentionConfig `yaml:"retention" toml:"retention"`
+	Log       LogConfig       `yaml:"log" toml:"log"`
+}
+
+// ServerConfig controls the HTTP listener.
+type ServerConfig struct {
+	Addr              string        `yaml:"addr" toml:"addr"`
+	ReadTimeout       time.Duration `yaml:"read_timeout" toml:"read_timeout"`
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout" toml:"read_header_timeout"`
+	WriteTimeout      time.Duration `yaml:"write_timeout" toml:"write_timeout"`
+	IdleTimeout       time.Duration `yaml:"idle_timeout" toml:"idle_timeout"`
+	// ShutdownTimeout bounds how long in-flight requests may drain on SIGINT/SIGTERM.
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" toml:"shutdown_timeout"`
+	TLS             TLSConfig     `yaml:"tls" toml:"tls"`
+}
+
+// TLSConfig enables HTTPS when both files are set.
+type TLSConfig struct {
+	CertFile string `yaml:"cert_file" toml:"cert_file"`
+	KeyFile  string `yaml:"key_file" toml:"key_file"`
+}
+
+// Enabled reports whether the listener should serve TLS.
+func (t TLSConfig) Enabled() bool {
+	return t.CertFile != "" || t.KeyFile != ""
+}
+
+// APIConfig controls request handling behaviour.
+type APIConfig struct {
+	// RequireIfMatch makes If-Match mandatory on updates and deletes; without
+	// it the header is optional but still honoured when sent.
+	RequireIfMatch bool `yaml:"require_if_match" toml:"require_if_match"`
+	// AdminToken is a bearer token that acts with the admin role without
+	// belonging to a user, e.g. to promote the first admin. Empty disables it.
+	AdminToken string `yaml:"admin_token" toml:"admin_token"`
+	// MaxPageSize caps the limit query parameter of list endpoints.
+	MaxPageSize int `yaml:"max_page_size" toml:"max_page_size"`
+	// CursorSecret signs pagination cursors. When empty a random key is used,
+	// so cursors stop working when the server restarts.
+	CursorSecret string `yaml:"cursor_secret" toml:"cursor_secret"`
+}
+
+// AuthConfig controls user sign-in.
+type AuthConfig struct {
+	// JWTSecret signs access tokens. When empty a random key is used, so
+	// everyone has to sign in again when the server restarts.
+	JWTSecret string `yaml:"jwt_secret" toml:"jwt_secret"`
+	// AccessTokenTTL is how long an access token is accepted.
+	AccessTokenTTL time.Duration `yaml:"access_token_ttl" toml:"access_token_ttl"`
+	// RefreshTokenTTL is how long a refresh token can be exchanged for new
+	// tokens. Each exchange issues a fresh refresh token.
+	RefreshTokenTTL time.Duration `yaml:"refresh_token_ttl" toml:"refresh_token_ttl"`
+	// OIDC enables signing in with an OpenID Connect provider.
+	OIDC OIDCConfig `yaml:"oidc" toml:"oidc"`
+}
+
+// OIDCConfig registers the API as a client of an OpenID Connect provider.
+// Sign-in through the provider is disabled while Issuer is empty.
+type OIDCConfig struct {
+	Issuer       string `yaml:"issuer" toml:"issuer"`
+	ClientID     string `yaml:"client_id" toml:"client_id"`
+	ClientSecret string `yaml:"client_secret" toml:"client_secret"`
+	// RedirectURL is where the provider sends users back to: this API's
+	// /auth/oidc/callback as the provider knows it.
+	RedirectURL string `yaml:"redirect_url" toml:"redirect_url"`
+	// Scopes are requested besides openid.
+	Scopes []string `yaml:"scopes" toml:"scopes"`
+	// RoleClaim names the ID token claim, usually a list of groups, that
+	// Roles maps to API roles.
+	RoleClaim string `yaml:"role_claim" toml:"role_claim"`
+	// Roles maps values of RoleClaim to roles; a user gets the highest role
+	// any of their values maps to, or the default role when none does. The
+	// role is updated on every sign-in. When empty, roles are managed in the
+	// API only.
+	Roles map[string]string `yaml:"roles" toml:"roles"`
+}
+
+// Enabled reports whether sign-in through the provider is configured.
+func (o OIDCConfig) Enabled() bool {
+	return o.Issuer != ""
+}
+
+// StorageConfig selects where todos and logs are kept.
+type StorageConfig struct {
+	// Driver is "postgres" (the default) or "memory" for tests and local demos.
+	Driver string `yaml:"driver" toml:"driver"`
+}
+
+// DatabaseConfig holds the Postgres connection parts and pool sizes.
+type DatabaseConfig struct {
+	Host            string        `yaml:"host" toml:"host"`
+	Port            int           `yaml:"port" toml:"port"`
+	User            string        `yaml:"user" toml:"user"`
+	Password        string        `yaml:"password" toml:"password"`
+	Name            string        `yaml:"name" toml:"name"`
+	SSLMode         string        `yaml:"sslmode" toml:"sslmode"`
+	ConnectTimeout  time.Duration `yaml:"connect_timeout" toml:"connect_timeout"`
+	MaxOpenConns    int           `yaml:"max_open_conns" toml:"max_open_conns"`
+	MaxIdleConns    int           `yaml:"max_idle_conns" toml:"max_idle_conns"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime" toml:"conn_max_lifetime"`
+	ConnMaxIdleTime time.Duration `yaml:"conn_max_idle_time" toml:"conn_max_idle_time"`
+	// AutoMigrate applies pending schema migrations at startup.
+	AutoMigrate bool `yaml:"auto_migrate" toml:"auto_migrate"`
+	// RowLevelSecurity runs every request in a transaction limited to the
+	// caller's workspace by the row-level security policies on app.workspace_id.
+	// The API must then connect as a role the policies apply to: not the
+	// owner of the tables, a superuser or a BYPASSRLS role.
+	RowLevelSecurity bool `yaml:"row_level_security" toml:"row_level_security"`
+}
+
+// DSN builds the lib/pq connection string from the individual parts.
+func (d DatabaseConfig) DSN() string {
+	parts := []string{
+		"host=" + quoteDSN(d.Host),
+		"port=" + strconv.Itoa(d.Port),
+		"user=" + quoteDSN(d.User),
+		"password=" + quoteDSN(d.Password),
+		"dbname=" + quoteDSN(d.Name),
+		"sslmode=" + quoteDSN(d.SSLMode),
+	}
+	if d.ConnectTimeout > 0 {
+		parts = append(parts, "connect_timeout="+strconv.Itoa(int(d.ConnectTimeout.Seconds())))
+	}
+	return strings.Join(parts, " ")
+}
+
+// Redacted returns a connection URL without the password, for logging.
+func (d DatabaseConfig) Redacted() string {
+	u := url.URL{
+		Scheme: "postgres",
+		User:   url.User(d.User),
+		Host:   net.JoinHostPort(d.Host, strconv.Itoa(d.Port)),
+		Path:   d.Name,
+	}
+	return u.String()
+}
+
+// quoteDSN escapes a value for the key=value DSN format understood by lib/pq.
+func quoteDSN(v string) string {
+	if v != "" && !strings.ContainsAny(v, ` '\`) {
+		return v
+	}
+	v = strings.ReplaceAll(v, `\`, `\\`)
+	v = strings.ReplaceAll(v, `'`, `\'`)
+	return "'" + v + "'"
+}
+
+// WorkflowConfig customises the todo status lifecycle. It can only be set in
+// the config file.
+type WorkflowConfig struct {
+	// Transitions maps each status to the statuses it may move to. When empty,
+	// models.DefaultTransitions is used.
+	Transitions map[string][]string `yaml:"transitions" toml:"transitions"`
+}
+
+// RetentionConfig controls the background job that empties the trash.
+type RetentionConfig struct {
+	// TrashPeriod is how long a deleted todo stays restorable before it is
+	// purged for good. Zero keeps deleted todos forever.
+	TrashPeriod time.Duration `yaml:"trash_period" toml:"trash_period"`
+	// Interval is how often the job looks for todos to purge.
+	Interval time.Duration `yaml:"interval" toml:"interval"`
+}
+
+// LogConfig controls log verbosity.
+type LogConfig struct {
+	Level string `yaml:"level" toml:"level"`
+}
+
+// SlogLevel converts the configured level name into a slog.Level.
+func (l LogConfig) SlogLevel() slog.Level {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(l.Level)); err != nil {
+		return slog.LevelInfo
+	}
+	return level
+}
+
+// Default returns the settings used when nothing else is configured. They
+// match the values the API historically had hardcoded.
+func Default() *Config {
+	return &Config{
+		Server: ServerConfig{
+			Addr:              ":8080",
+			ReadTimeout:       15 * time.Second,
+			ReadHeaderTimeout: 5 * time.Second,
+			WriteTimeout:      30 * time.Second,
+			IdleTimeout:       60 * time.Second,
+			ShutdownTimeout:   20 * time.Second,
+		},
+		API: APIConfig{
+			MaxPageSize: 100,
+		},
+		Auth: AuthConfig{
+			AccessTokenTTL:  15 * time.Minute,
+			RefreshTokenTTL: 30 * 24 * time.Hour,
+			OIDC: OIDCConfig{
+				Scopes:    []string{"email", "profile"},
+				RoleClaim: "groups",
+			},
+		},
+		Storage: StorageConfig{
+			Driver: "postgres",
+		},
+		Database: DatabaseConfig{
+			Host:            "localhost",
+			Port:            5432,
+			User:            "postgres",
+			Password:        "root",
+			Name:            "tododb",
+			SSLMode:         "disable",
+			ConnectTimeout:  5 * time.Second,
+			MaxOpenConns:    25,
+			MaxIdleConns:    5,
+			ConnMaxLifetime: 30 * time.Minute,
+			ConnMaxIdleTime: 5 * time.Minute,
+			AutoMigrate:     true,
+		},
+		Retention: RetentionConfig{
+			Interval: time.Hour,
+		},
+		Log: LogConfig{
+			Level: "info",
+		},
+	}
+}
+
+// Load resolves the configuration from defaults, the config file, the
+// environment and the given command-line arguments, then validates it.
+func Load(args []string) (*Config, error) {
+	return load(args, os.LookupEnv, os.Stderr)
+}
+
+func load(args []string, lookupEnv func(string) (string, bool), output io.Writer) (*Config, error) {
+	cfg := Default()
+
+	fs := flag.NewFlagSet("todo-api", flag.ContinueOnError)
+	fs.SetOutput(output)
+	overrides := cfg.bindFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	// The file path itself may come from a flag or the environment.
+	path, _ := lookupEnv("TODO_CONFIG")
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == "config" {
+			path = f.Value.String()
+		}
+	})
+	if path != "" {
+		if err := cfg.loadFile(path); err != nil {
+			return nil, err
+		}
+	}
+
+	errs := &ValidationError{}
+	cfg.applyEnv(lookupEnv, errs)
+	fs.Visit(func(f *flag.Flag) {
+		if apply, ok := overrides[f.Name]; ok {
+			apply()
+		}
+	})
+	cfg.validate(errs)
+	if len(errs.Problems) > 0 {
+		return nil, errs
+	}
+	return cfg, nil
+}
+
+// loadFile merges a YAML or TOML file (chosen by extension) into cfg.
+func (c *Config) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("reading config file: %w", err)
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, c)
+	case ".toml":
+		err = toml.Unmarshal(data, c)
+	default:
+		return fmt.Errorf("config file %s: unsupported extension (use .yaml, .yml or .toml)", path)
+	}
+	if err != nil {
+		return fmt.Errorf("parsing config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// applyEnv overrides fields with any TODO_* environment variables that are set.
+func (c *Config) applyEnv(lookupEnv func(string) (string, bool), errs *ValidationError) {
+	str := func(key string, dst *string) {
+		if v, ok := lookupEnv(key); ok {
+			*dst = v
+		}
+	}
+	num := func(key string, dst *int) {
+		if v, ok := lookupEnv(key); ok {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				errs.add(key, "must be an integer, got %q", v)
+				return
+			}
+			*dst = n
+		}
+	}
+	boolean := func(key string, dst *bool) {
+		if v, ok := lookupEnv(key); ok {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				errs.add(key, "must be true or false, got %q", v)
+				return
+			}
+			*dst = b
+		}
+	}
+	dur := func(key string, dst *time.Duration) {
+		if v, ok := lookupEnv(key); ok {
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				errs.add(key, "must be a duration such as 10s or 1m, got %q", v)
+				return
+			}
+			*dst = d
+		}
+	}
+
+	str("TODO_HTTP_ADDR", &c.Server.Addr)
+	dur("TODO_HTTP_READ_TIMEOUT", &c.Server.ReadTimeout)
+	dur("TODO_HTTP_READ_HEADER_TIMEOUT", &c.Server.ReadHeaderTimeout)
+	dur("TODO_HTTP_WRITE_TIMEOUT", &c.Server.WriteTimeout)
+	dur("TODO_HTTP_IDLE_TIMEOUT", &c.Server.IdleTimeout)
+	dur("TODO_HTTP_SHUTDOWN_TIMEOUT", &c.Server.ShutdownTimeout)
+	str("TODO_TLS_CERT_FILE", &c.Server.TLS.CertFile)
+	str("TODO_TLS_KEY_FILE", &c.Server.TLS.KeyFile)
+
+	boolean("TODO_API_REQUIRE_IF_MATCH", &c.API.RequireIfMatch)
+	str("TODO_API_ADMIN_TOKEN", &c.API.AdminToken)
+	num("TODO_API_MAX_PAGE_SIZE", &c.API.MaxPageSize)
+	str("TODO_API_CURSOR_SECRET", &c.API.CursorSecret)
+
+	str("TODO_AUTH_JWT_SECRET", &c.Auth.JWTSecret)
+	dur("TODO_AUTH_ACCESS_TOKEN_TTL", &c.Auth.AccessTokenTTL)
+	dur("TODO_AUTH_REFRESH_TOKEN_TTL", &c.Auth.RefreshTokenTTL)
+	str("TODO_AUTH_OIDC_ISSUER", &c.Auth.OIDC.Issuer)
+	str("TODO_AUTH_OIDC_CLIENT_ID", &c.Auth.OIDC.ClientID)
+	str("TODO_AUTH_OIDC_CLIENT_SECRET", &c.Auth.OIDC.ClientSecret)
+	str("TODO_AUTH_OIDC_REDIRECT_URL", &c.Auth.OIDC.RedirectURL)
+	str("TODO_AUTH_OIDC_ROLE_CLAIM", &c.Auth.OIDC.RoleClaim)
+
+	str("TODO_STORAGE_DRIVER", &c.Storage.Driver)
+
+	str("TODO_DB_HOST", &c.Database.Host)
+	num("TODO_DB_PORT", &c.Database.Port)
+	str("TODO_DB_USER", &c.Database.User)
+	str("TODO_DB_PASSWORD", &c.Database.Password)
+	str("TODO_DB_NAME", &c.Database.Name)
+	str("TODO_DB_SSLMODE", &c.Database.SSLMode)
+	dur("TODO_DB_CONNECT_TIMEOUT", &c.Database.ConnectTimeout)
+	num("TODO_DB_MAX_OPEN_CONNS", &c.Database.MaxOpenConns)
+	num("TODO_DB_MAX_IDLE_CONNS", &c.Database.MaxIdleConns)
+	dur("TODO_DB_CONN_MAX_LIFETIME", &c.Database.ConnMaxLifetime)
+	dur("TODO_DB_CONN_MAX_IDLE_TIME", &c.Database.ConnMaxIdleTime)
+	boolean("TODO_DB_AUTO_MIGRATE", &c.Database.AutoMigrate)
+	boolean("TODO_DB_ROW_LEVEL_SECURITY", &c.Database.RowLevelSecurity)
+
+	dur("TODO_RETENTION_TRASH_PERIOD", &c.Retention.TrashPeriod)
+	dur("TODO_RETENTION_INTERVAL", &c.Retention.Interval)
+
+	str("TODO_LOG_LEVEL", &c.Log.Level)
+}
+
+// bindFlags registers a flag for every setting. Flags are parsed into
+// throwaway values and only copied into c (via the returned setters) once
+// the file and environment have been applied, so an explicit flag always wins.
+func (c *Config) bindFlags(fs *flag.FlagSet) map[string]func() {
+	overrides := map[string]func(){}
+	str := func(name string, dst *string, usage string) {
+		v := fs.String(name, *dst, usage)
+		overrides[name] = func() { *dst = *v }
+	}
+	num := func(name string, dst *int, usage string) {
+		v := fs.Int(name, *dst, usage)
+		overrides[name] = func() { *dst = *v }
+	}
+	boolean := func(name string, dst *bool, usage string) {
+		v := fs.Bool(name, *dst, usage)
+		overrides[name] = func() { *dst = *v }
+	}
+	dur := func(name string, dst *time.Duration, usage string) {
+		v := fs.Duration(name, *dst, usage)
+		overrides[name] = func() { *dst = *v }
+	}
+
+	fs.String("config", "", "path to a YAML or TOML config file (env TODO_CONFIG)")
+
+	str("addr", &c.Server.Addr, "HTTP listen address")
+	dur("read-timeout", &c.Server.ReadTimeout, "maximum duration for reading a request")
+	dur("read-header-timeout", &c.Server.ReadHeaderTimeout, "maximum duration for reading request headers")
+	dur("write-timeout", &c.Server.WriteTimeout, "maximum duration before timing out a response write")
+	dur("idle-timeout", &c.Server.IdleTimeout, "maximum keep-alive idle time")
+	dur("shutdown-timeout", &c.Server.ShutdownTimeout, "how long to drain in-flight requests on shutdown")
+	str("tls-cert", &c.Server.TLS.CertFile, "TLS certificate file")
+	str("tls-key", &c.Server.TLS.KeyFile, "TLS private key file")
+
+	boolean("require-if-match", &c.API.RequireIfMatch, "reject updates and deletes without an If-Match header")
+	str("admin-token", &c.API.AdminToken, "bearer token acting with the admin role (disabled when empty)")
+	num("max-page-size", &c.API.MaxPageSize, "largest page a list endpoint returns")
+	str("cursor-secret", &c.API.CursorSecret, "key that signs pagination cursors (random when empty)")
+
+	str("jwt-secret", &c.Auth.JWTSecret, "key that signs access tokens (random when empty)")
+	dur("access-token-ttl", &c.Auth.AccessTokenTTL, "how long an access token is valid")
+	dur("refresh-token-ttl", &c.Auth.RefreshTokenTTL, "how long a refresh token is valid")
+	str("oidc-issuer", &c.Auth.OIDC.Issuer, "OpenID Connect provider to sign in with (disabled when empty)")
+	str("oidc-client-id", &c.Auth.OIDC.ClientID, "client ID registered with the OpenID Connect provider")
+	str("oidc-client-secret", &c.Auth.OIDC.ClientSecret, "client secret registered with the OpenID Connect provider")
+	str("oidc-redirect-url", &c.Auth.OIDC.RedirectURL, "URL of /auth/oidc/callback registered with the provider")
+	str("oidc-role-claim", &c.Auth.OIDC.RoleClaim, "ID token claim mapped to roles by auth.oidc.roles")
+
+	str("storage", &c.Storage.Driver, "storage driver (postgres, memory)")
+
+	str("db-host", &c.Database.Host, "database host")
+	num("db-port", &c.Database.Port, "database port")
+	str("db-user", &c.Database.User, "database user")
+	str("db-password", &c.Database.Password, "database password")
+	str("db-name", &c.Database.Name, "database name")
+	str("db-sslmode", &c.Database.SSLMode, "database sslmode (disable, require, verify-ca, verify-full)")
+	dur("db-connect-timeout", &c.Database.ConnectTimeout, "database connect timeout")
+	num("db-max-open-conns", &c.Database.MaxOpenConns, "maximum open database connections")
+	num("db-max-idle-conns", &c.Database.MaxIdleConns, "maximum idle database connections")
+	dur("db-conn-max-lifetime", &c.Database.ConnMaxLifetime, "maximum lifetime of a database connection")
+	dur("db-conn-max-idle-time", &c.Database.ConnMaxIdleTime, "maximum idle time of a database connection")
+	boolean("db-auto-migrate", &c.Database.AutoMigrate, "apply pending schema migrations at startup")
+	boolean("db-row-level-security", &c.Database.RowLevelSecurity, "confine each request to its workspace with row-level security")
+
+	dur("trash-period", &c.Retention.TrashPeriod, "purge deleted todos after this long (0 keeps them forever)")
+	dur("retention-interval", &c.Retention.Interval, "how often to look for deleted todos to purge")
+
+	str("log-level", &c.Log.Level, "log level (debug, info, warn, error)")
+
+	return overrides
+}
+
+// validate checks the resolved settings and records every problem in errs.
+func (c *Config) validate(errs *ValidationError) {
+	if c.Server.Addr == "" {
+		errs.add("server.addr", "must not be empty")
+	} else if _, port, err := net.SplitHostPort(c.Server.Addr); err != nil {
+		errs.add("server.addr", "must be host:port, got %q", c.Server.Addr)
+	} else if n, err := strconv.Atoi(port); err != nil || n < 0 || n > 65535 {
+		errs.add("server.addr", "invalid port %q", port)
+	}
+	errs.nonNegative("server.read_timeout", c.Server.ReadTimeout)
+	errs.nonNegative("server.read_header_timeout", c.Server.ReadHeaderTimeout)
+	errs.nonNegative("server.write_timeout", c.Server.WriteTimeout)
+	errs.nonNegative("server.idle_timeout", c.Server.IdleTimeout)
+	errs.nonNegative("server.shutdown_timeout", c.Server.ShutdownTimeout)
+	if tls := c.Server.TLS; tls.Enabled() {
+		if tls.CertFile == "" || tls.KeyFile == "" {
+			errs.add("server.tls", "cert_file and key_file must be set together")
+		}
+		readable := func(name, path string) {
+			if path == "" {
+				return
+			}
+			if _, err := os.Stat(path); err != nil {
+				errs.add(name, "cannot read %s: %v", path, unwrapPathError(err))
+			}
+		}
+		readable("server.tls.cert_file", tls.CertFile)
+		readable("server.tls.key_file", tls.KeyFile)
+	}
+
+	if c.API.MaxPageSize < 1 {
+		errs.add("api.max_page_size", "must be at least 1, got %d", c.API.MaxPageSize)
+	}
+
+	if c.Auth.AccessTokenTTL <= 0 {
+		errs.add("auth.access_token_ttl", "must be positive")
+	}
+	if c.Auth.RefreshTokenTTL <= 0 {
+		errs.add("auth.refresh_token_ttl", "must be positive")
+	}
+	if o := c.Auth.OIDC; o.Enabled() {
+		if u, err := url.Parse(o.Issuer); err != nil || u.Host == "" || (u.Scheme != "https" && u.Scheme != "http") {
+			errs.add("auth.oidc.issuer", "must be an http(s) URL, got %q", o.Issuer)
+		}
+		if o.ClientID == "" {
+			errs.add("auth.oidc.client_id", "must be set when issuer is")
+		}
+		if u, err := url.Parse(o.RedirectURL); err != nil || !u.IsAbs() {
+			errs.add("auth.oidc.redirect_url", "must be an absolute URL, got %q", o.RedirectURL)
+		}
+		if len(o.Roles) > 0 && o.RoleClaim == "" {
+			errs.add("auth.oidc.role_claim", "must be set when roles are mapped")
+		}
+	}
+
+	switch c.Storage.Driver {
+	case "postgres":
+		c.Database.validate(errs)
+	case "memory":
+		// No database settings are needed.
+	default:
+		errs.add("storage.driver", "must be postgres or memory, got %q", c.Storage.Driver)
+	}
+
+	errs.nonNegative("retention.trash_period", c.Retention.TrashPeriod)
+	if c.Retention.TrashPeriod > 0 && c.Retention.Interval <= 0 {
+		errs.add("retention.interval", "must be positive when trash_period is set")
+	}
+
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(c.Log.Level)); err != nil {
+		errs.add("log.level", "must be one of debug, info, warn, error, got %q", c.Log.Level)
+	}
+}
+
+func (db DatabaseConfig) validate(errs *ValidationError) {
+	if db.Host == "" {
+		errs.add("database.host", "must not be empty")
+	}
+	if db.Port < 1 || db.Port > 65535 {
+		errs.add("database.port", "must be between 1 and 65535, got %d", db.Port)
+	}
+	if db.User == "" {
+		errs.add("database.user", "must not be empty")
+	}
+	if db.Name == "" {
+		errs.add("database.name", "must not be empty")
+	}
+	switch db.SSLMode {
+	case "disable", "allow", "prefer", "require", "verify-ca", "verify-full":
+	default:
+		errs.add("database.sslmode", "unknown mode %q", db.SSLMode)
+	}
+	errs.nonNegative("database.connect_timeout", db.ConnectTimeout)
+	if db.MaxOpenConns < 0 {
+		errs.add("database.max_open_conns", "must not be negative")
+	}
+	if db.MaxIdleConns < 0 {
+		errs.add("database.max_idle_conns", "must not be negative")
+	}
+	if db.MaxOpenConns > 0 && db.MaxIdleConns > db.MaxOpenConns {
+		errs.add("database.max_idle_conns", "must not exceed max_open_conns (%d)", db.MaxOpenConns)
+	}
+	errs.nonNegative("database.conn_max_lifetime", db.ConnMaxLifetime)
+	errs.nonNegative("database.conn_max_idle_time", db.ConnMaxIdleTime)
+}
+
+func unwrapPathError(err error) error {
+	if pe, ok := err.(*os.PathError); ok {
+		return pe.Err
+	}
+	return err
+}
@@ -0,0 +1,155 @@
+package config
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// env returns a lookupEnv reading from vars.
+func env(vars map[string]string) func(string) (string, bool) {
+	return func(key string) (string, bool) {
+		v, ok := vars[key]
+		return v, ok
+	}
+}
+
+// writeFile writes a config file named name into a temporary directory.
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	yamlFile := writeFile(t, "todo.yaml", "server:\n  addr: \":9000\"\ndatabase:\n  port: 6543\nlog:\n  level: warn\n")
+	tomlFile := writeFile(t, "todo.toml", "[server]\naddr = \":9100\"\n")
+
+	tests := []struct {
+		name  string
+		args  []string
+		env   map[string]string
+		addr  string
+		port  int
+		level string
+	}{
+		{name: "defaults", addr: ":8080", port: 5432, level: "info"},
+		{name: "file from flag", args: []string{"-config", yamlFile}, addr: ":9000", port: 6543, level: "warn"},
+		{name: "file from env", env: map[string]string{"TODO_CONFIG": yamlFile}, addr: ":9000", port: 6543, level: "warn"},
+		{name: "flag picks file over env", args: []string{"-config", tomlFile}, env: map[string]string{"TODO_CONFIG": yamlFile},
+			addr: ":9100", port: 5432, level: "info"},
+		{name: "env over file", args: []string{"-config", yamlFile}, env: map[string]string{"TODO_HTTP_ADDR": ":7000", "TODO_LOG_LEVEL": "error"},
+			addr: ":7000", port: 6543, level: "error"},
+		{name: "flag over env", args: []string{"-config", yamlFile, "-addr", ":7100", "-db-port", "7777"},
+			env: map[string]string{"TODO_HTTP_ADDR": ":7000", "TODO_DB_PORT": "6000"}, addr: ":7100", port: 7777, level: "warn"},
+		{name: "unset flag keeps env", args: []string{"-log-level", "debug"}, env: map[string]string{"TODO_HTTP_ADDR": ":7000"},
+			addr: ":7000", port: 5432, level: "debug"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := load(tt.args, env(tt.env), io.Discard)
+			if err != nil {
+				t.Fatalf("load: %v", err)
+			}
+			if cfg.Server.Addr != tt.addr {
+				t.Errorf("addr = %q, want %q", cfg.Server.Addr, tt.addr)
+			}
+			if cfg.Database.Port != tt.port {
+				t.Errorf("port = %d, want %d", cfg.Database.Port, tt.port)
+			}
+			if cfg.Log.Level != tt.level {
+				t.Errorf("log level = %q, want %q", cfg.Log.Level, tt.level)
+			}
+		})
+	}
+}
+
+func TestLoadValidation(t *testing.T) {
+	tests := []struct {
+		name   string
+		args   []string
+		env    map[string]string
+		fields []string // fields with problems, in order; none means valid
+	}{
+		{name: "memory storage needs no database", args: []string{"-storage", "memory", "-db-host", ""}},
+		{name: "bad env values", env: map[string]string{"TODO_DB_PORT": "five", "TODO_HTTP_READ_TIMEOUT": "soon", "TODO_DB_AUTO_MIGRATE": "maybe"},
+			fields: []string{"TODO_HTTP_READ_TIMEOUT", "TODO_DB_PORT", "TODO_DB_AUTO_MIGRATE"}},
+		{name: "bad address", args: []string{"-addr", "8080"}, fields: []string{"server.addr"}},
+		{name: "bad port", args: []string{"-addr", ":99999"}, fields: []string{"server.addr"}},
+		{name: "every problem at once", args: []string{"-read-timeout", "-1s", "-log-level", "loud", "-db-sslmode", "sometimes", "-db-user", ""},
+			fields: []string{"server.read_timeout", "database.user", "database.sslmode", "log.level"}},
+		{name: "negative shutdown timeout", args: []string{"-shutdown-timeout", "-1s"}, fields: []string{"server.shutdown_timeout"}},
+		{name: "page size", args: []string{"-max-page-size", "0"}, fields: []string{"api.max_page_size"}},
+		{name: "idle above open", args: []string{"-db-max-open-conns", "2", "-db-max-idle-conns", "3"}, fields: []string{"database.max_idle_conns"}},
+		{name: "unknown driver", args: []string{"-storage", "sqlite"}, fields: []string{"storage.driver"}},
+		{name: "tls needs both files", args: []string{"-tls-cert", "/nonexistent/cert.pem"},
+			fields: []string{"server.tls", "server.tls.cert_file"}},
+		{name: "retention interval", args: []string{"-trash-period", "24h", "-retention-interval", "0s"}, fields: []string{"retention.interval"}},
+		{name: "oidc", args: []string{"-oidc-issuer", "login.example.com", "-oidc-redirect-url", "/callback"},
+			fields: []string{"auth.oidc.issuer", "auth.oidc.client_id", "auth.oidc.redirect_url"}},
+		{name: "oidc complete", args: []string{"-oidc-issuer", "https://login.example.com", "-oidc-client-id", "todo",
+			"-oidc-redirect-url", "https://todo.example.com/auth/oidc/callback"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := load(tt.args, env(tt.env), io.Discard)
+			if len(tt.fields) == 0 {
+				if err != nil {
+					t.Fatalf("load: %v", err)
+				}
+				return
+			}
+			var verr *ValidationError
+			if !errors.As(err, &verr) {
+				t.Fatalf("load error = %v, want a ValidationError", err)
+			}
+			var fields []string
+			for _, p := range verr.Problems {
+				fields = append(fields, p.Field)
+			}
+			if strings.Join(fields, ",") != strings.Join(tt.fields, ",") {
+				t.Errorf("problems with %v, want %v", fields, tt.fields)
+			}
+		})
+	}
+}
+
+func TestLoadFileErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		path string
+		want string
+	}{
+		{name: "missing", path: filepath.Join(t.TempDir(), "missing.yaml"), want: "reading config file"},
+		{name: "extension", path: writeFile(t, "todo.json", "{}"), want: "unsupported extension"},
+		{name: "syntax", path: writeFile(t, "todo.yaml", "server: [\n"), want: "parsing config file"},
+		{name: "type", path: writeFile(t, "todo.toml", "[server]\nread_timeout = true\n"), want: "parsing config file"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := load([]string{"-config", tt.path}, env(nil), io.Discard)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("load error = %v, want it to mention %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadDurationsFromFile(t *testing.T) {
+	path := writeFile(t, "todo.yaml", "server:\n  read_timeout: 45s\ndatabase:\n  conn_max_lifetime: 2h\nretention:\n  trash_period: 720h\n")
+	cfg, err := load([]string{"-config", path}, env(nil), io.Discard)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if cfg.Server.ReadTimeout != 45*time.Second || cfg.Database.ConnMaxLifetime != 2*time.Hour || cfg.Retention.TrashPeriod != 720*time.Hour {
+		t.Errorf("read_timeout = %s, conn_max_lifetime = %s, trash_period = %s",
+			cfg.Server.ReadTimeout, cfg.Database.ConnMaxLifetime, cfg.Retention.TrashPeriod)
+	}
+}
@@ -0,0 +1,42 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Problem describes a single invalid setting.
+type Problem struct {
+	Field   string
+	Message string
+}
+
+// ValidationError collects every invalid setting found while loading, so
+// operators can fix them all in one go instead of one restart at a time.
+type ValidationError struct {
+	Problems []Problem
+}
+
+func (e *ValidationError) add(field, format string, args ...interface{}) {
+	e.Problems = append(e.Problems, Problem{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+func (e *ValidationError) nonNegative(field string, d time.Duration) {
+	if d < 0 {
+		e.add(field, "must not be negative")
+	}
+}
+
+func (e *ValidationError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "invalid configuration (%d problem", len(e.Problems))
+	if len(e.Problems) != 1 {
+		b.WriteString("s")
+	}
+	b.WriteString("):")
+	for _, p := range e.Problems {
+		fmt.Fprintf(&b, "\n  - %s: %s", p.Field, p.Message)
+	}
+	return b.String()
+}
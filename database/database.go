@@ -3,36 +3,54 @@ package database
 import (
 	"database/sql"
 	"fmt"
-	"log"
-	_ "github.com/lib/pq"
+	"log/slog"
 	"sync"
+	"todo-api/config"
+
+	_ "github.com/lib/pq"
 )
 
 var (
-	DB     *sql.DB
-	once   sync.Once
+	DB   *sql.DB
+	once sync.Once
 )
 
 // ConnectDB initializes and returns the database connection, using a singleton pattern.
-func ConnectDB() *sql.DB {
+// The connection string and pool sizes come from cfg; only the first call's cfg is used.
+func ConnectDB(cfg config.DatabaseConfig) (*sql.DB, error) {
+	var err error
 	// Ensure that the database connection is initialized only once
 	once.Do(func() {
-		connStr := "host=localhost port=5432 user=postgres password=root dbname=tododb sslmode=disable"
-		var err error
-		DB, err = sql.Open("postgres", connStr)
+		var conn *sql.DB
+		conn, err = sql.Open("postgres", cfg.DSN())
 		if err != nil {
-			log.Fatalf("Error opening database: %v", err)
+			err = fmt.Errorf("opening database: %w", err)
+			return
 		}
 
+		conn.SetMaxOpenConns(cfg.MaxOpenConns)
+		conn.SetMaxIdleConns(cfg.MaxIdleConns)
+		conn.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+		conn.SetConnMaxIdleTime(cfg.ConnMaxIdleTime)
+
 		// Ping the database to ensure the connection is valid
-		if err = DB.Ping(); err != nil {
-			log.Fatalf("Error connecting to the database: %v", err)
+		if err = conn.Ping(); err != nil {
+			conn.Close()
+			err = fmt.Errorf("connecting to %s: %w", cfg.Redacted(), err)
+			return
 		}
 
-		log.Println("Database connection established")
+		DB = conn
+		slog.Info("Database connection established", "database", cfg.Redacted())
 	})
+	if err != nil {
+		return nil, err
+	}
+	if DB == nil {
+		return nil, fmt.Errorf("database connection failed earlier")
+	}
 
-	return DB
+	return DB, nil
 }
 
 // CloseDB closes the database connection (should be called when the app exits)
@@ -42,4 +60,3 @@ func CloseDB() error {
 	}
 	return fmt.Errorf("no active database connection")
 }
-
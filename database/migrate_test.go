@@ -0,0 +1,49 @@
+package database
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMigrations(t *testing.T) {
+	migrations, err := Migrations()
+	if err != nil {
+		t.Fatalf("Migrations: %v", err)
+	}
+	if len(migrations) == 0 {
+		t.Fatal("no embedded migrations")
+	}
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			t.Errorf("migration %d_%s: versions must count up from 1 without gaps, want %d", m.Version, m.Name, i+1)
+		}
+		if strings.TrimSpace(m.Up) == "" || strings.TrimSpace(m.Down) == "" {
+			t.Errorf("migration %d_%s: needs both an up and a down script", m.Version, m.Name)
+		}
+		sum := sha256.Sum256([]byte(m.Up))
+		if m.Checksum != hex.EncodeToString(sum[:]) {
+			t.Errorf("migration %d_%s: checksum is not the sha256 of the up script", m.Version, m.Name)
+		}
+	}
+}
+
+func TestCheckDrift(t *testing.T) {
+	now := time.Now()
+	statuses := []MigrationStatus{
+		{Migration: Migration{Version: 1, Name: "create"}, AppliedAt: &now},
+		{Migration: Migration{Version: 2, Name: "alter"}},
+	}
+	if err := checkDrift(statuses); err != nil {
+		t.Errorf("checkDrift without drift = %v", err)
+	}
+
+	statuses[0].Drifted = true
+	err := checkDrift(statuses)
+	if !errors.Is(err, ErrDrift) || !strings.Contains(err.Error(), "1_create") {
+		t.Errorf("checkDrift = %v, want ErrDrift naming 1_create", err)
+	}
+}
@@ -0,0 +1,28 @@
+-- Initial schema: the columns the handlers have always read and written.
+-- IF NOT EXISTS lets databases created by hand before migrations existed adopt them.
+
+CREATE TABLE IF NOT EXISTS todos (
+    id          UUID PRIMARY KEY,
+    title       TEXT NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    status      TEXT NOT NULL DEFAULT '',
+    due_date    DATE,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    is_deleted  BOOLEAN NOT NULL DEFAULT FALSE
+);
+
+CREATE INDEX IF NOT EXISTS todos_created_at_idx ON todos (created_at);
+CREATE INDEX IF NOT EXISTS todos_status_idx ON todos (status);
+
+-- todo_id has no foreign key: failed requests are logged against the nil UUID.
+CREATE TABLE IF NOT EXISTS logs (
+    id        BIGSERIAL PRIMARY KEY,
+    action    TEXT NOT NULL,
+    todo_id   UUID NOT NULL,
+    message   TEXT NOT NULL DEFAULT '',
+    details   TEXT NOT NULL DEFAULT '',
+    timestamp TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS logs_timestamp_idx ON logs (timestamp DESC);
+CREATE INDEX IF NOT EXISTS logs_todo_id_idx ON logs (todo_id);
@@ -0,0 +1,3 @@
+ALTER TABLE todos ALTER COLUMN status SET DEFAULT '';
+ALTER TABLE todos DROP COLUMN IF EXISTS completed_at;
+ALTER TABLE todos DROP COLUMN IF EXISTS started_at;
@@ -0,0 +1,8 @@
+-- Status lifecycle: record when work started and finished.
+
+ALTER TABLE todos ADD COLUMN IF NOT EXISTS started_at TIMESTAMPTZ;
+ALTER TABLE todos ADD COLUMN IF NOT EXISTS completed_at TIMESTAMPTZ;
+
+-- Status used to be free-form; blank values become the initial state.
+UPDATE todos SET status = 'pending' WHERE status = '';
+ALTER TABLE todos ALTER COLUMN status SET DEFAULT 'pending';
@@ -0,0 +1,2 @@
+-- Optimistic concurrency: every write to a todo bumps its version.
+ALTER TABLE todos ADD COLUMN IF NOT EXISTS version INTEGER NOT NULL DEFAULT 1;
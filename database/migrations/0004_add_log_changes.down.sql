@@ -0,0 +1 @@
+ALTER TABLE logs DROP COLUMN IF EXISTS changes;
@@ -0,0 +1,3 @@
+-- Structured before/after values of the fields a write changed, replacing
+-- the formatted "[Prev] ... → [New]" text in details.
+ALTER TABLE logs ADD COLUMN IF NOT EXISTS changes JSONB;
@@ -0,0 +1,6 @@
+-- When a todo was moved to the trash, so the retention job knows when to
+-- purge it. Todos already deleted start their retention period now.
+ALTER TABLE todos ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+UPDATE todos SET deleted_at = NOW() WHERE is_deleted AND deleted_at IS NULL;
+
+CREATE INDEX IF NOT EXISTS todos_deleted_at_idx ON todos (deleted_at) WHERE is_deleted;
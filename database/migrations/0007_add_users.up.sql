@@ -0,0 +1,27 @@
+-- User accounts, the refresh tokens issued to them, and todo ownership.
+-- Todos created before accounts existed have no owner; only the admin token
+-- can reach them.
+CREATE TABLE IF NOT EXISTS users (
+    id            UUID PRIMARY KEY,
+    email         TEXT NOT NULL UNIQUE,
+    password_hash TEXT NOT NULL,
+    created_at    TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Only the SHA-256 of a refresh token is stored. Tokens rotate on every use;
+-- family ties together the tokens descended from one login so that reuse of
+-- a spent token can revoke them all.
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+    id         UUID PRIMARY KEY,
+    user_id    UUID NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    family     UUID NOT NULL,
+    token_hash TEXT NOT NULL UNIQUE,
+    expires_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    revoked_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS refresh_tokens_family_idx ON refresh_tokens (family);
+
+ALTER TABLE todos ADD COLUMN IF NOT EXISTS owner_id UUID REFERENCES users (id);
+CREATE INDEX IF NOT EXISTS todos_owner_id_idx ON todos (owner_id);
@@ -0,0 +1,3 @@
+-- Roles grant users their permissions; see auth/role.go for the matrix.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS role TEXT NOT NULL DEFAULT 'member'
+    CHECK (role IN ('viewer', 'member', 'admin'));
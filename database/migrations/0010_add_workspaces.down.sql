@@ -0,0 +1,11 @@
+DROP POLICY IF EXISTS logs_workspace_isolation ON logs;
+DROP POLICY IF EXISTS todos_workspace_isolation ON todos;
+ALTER TABLE logs DISABLE ROW LEVEL SECURITY;
+ALTER TABLE todos DISABLE ROW LEVEL SECURITY;
+DROP INDEX IF EXISTS logs_workspace_id_idx;
+DROP INDEX IF EXISTS todos_workspace_id_idx;
+ALTER TABLE logs DROP COLUMN IF EXISTS workspace_id;
+ALTER TABLE todos DROP COLUMN IF EXISTS workspace_id;
+DROP TABLE IF EXISTS workspace_invitations;
+DROP TABLE IF EXISTS workspace_members;
+DROP TABLE IF EXISTS workspaces;
@@ -0,0 +1,58 @@
+-- Workspaces isolate the todos and logs of one team from another. settings
+-- holds models.WorkspaceSettings as JSON.
+CREATE TABLE IF NOT EXISTS workspaces (
+    id         UUID PRIMARY KEY,
+    name       TEXT NOT NULL,
+    settings   JSONB NOT NULL DEFAULT '{}',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS workspace_members (
+    workspace_id UUID NOT NULL REFERENCES workspaces (id) ON DELETE CASCADE,
+    user_id      UUID NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    role         TEXT NOT NULL CHECK (role IN ('owner', 'member')),
+    joined_at    TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (workspace_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS workspace_members_user_id_idx ON workspace_members (user_id);
+
+-- Only the SHA-256 of an invitation token is stored, as for refresh tokens.
+CREATE TABLE IF NOT EXISTS workspace_invitations (
+    id           UUID PRIMARY KEY,
+    workspace_id UUID NOT NULL REFERENCES workspaces (id) ON DELETE CASCADE,
+    email        TEXT NOT NULL,
+    role         TEXT NOT NULL CHECK (role IN ('owner', 'member')),
+    token_hash   TEXT NOT NULL UNIQUE,
+    invited_by   UUID REFERENCES users (id) ON DELETE SET NULL,
+    expires_at   TIMESTAMPTZ NOT NULL,
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    accepted_at  TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS workspace_invitations_workspace_id_idx ON workspace_invitations (workspace_id);
+
+ALTER TABLE todos ADD COLUMN IF NOT EXISTS workspace_id UUID REFERENCES workspaces (id);
+ALTER TABLE logs ADD COLUMN IF NOT EXISTS workspace_id UUID REFERENCES workspaces (id);
+CREATE INDEX IF NOT EXISTS todos_workspace_id_idx ON todos (workspace_id);
+CREATE INDEX IF NOT EXISTS logs_workspace_id_idx ON logs (workspace_id);
+
+-- Existing users get a personal workspace sharing their ID, holding the todos
+-- they own. Unowned todos stay outside every workspace, for admins only.
+INSERT INTO workspaces (id, name) SELECT id, 'Personal' FROM users ON CONFLICT DO NOTHING;
+INSERT INTO workspace_members (workspace_id, user_id, role) SELECT id, id, 'owner' FROM users ON CONFLICT DO NOTHING;
+UPDATE todos SET workspace_id = owner_id WHERE workspace_id IS NULL AND owner_id IS NOT NULL;
+UPDATE logs SET workspace_id = todos.workspace_id FROM todos WHERE logs.todo_id = todos.id AND logs.workspace_id IS NULL;
+
+-- Row-level security confines roles other than the tables' owner to the
+-- workspace named by app.workspace_id, or to every workspace for '*'. It
+-- only guards the API when database.row_level_security is on and the API
+-- connects as such a role; the owner bypasses the policies.
+ALTER TABLE todos ENABLE ROW LEVEL SECURITY;
+ALTER TABLE logs ENABLE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS todos_workspace_isolation ON todos;
+DROP POLICY IF EXISTS logs_workspace_isolation ON logs;
+CREATE POLICY todos_workspace_isolation ON todos
+    USING (current_setting('app.workspace_id', true) = '*' OR workspace_id::text = current_setting('app.workspace_id', true));
+CREATE POLICY logs_workspace_isolation ON logs
+    USING (current_setting('app.workspace_id', true) = '*' OR workspace_id::text = current_setting('app.workspace_id', true));
@@ -0,0 +1,7 @@
+-- Users who sign in through an OpenID Connect provider are identified by
+-- the provider's issuer and their subject there. Empty means not linked.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS oidc_issuer TEXT NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN IF NOT EXISTS oidc_subject TEXT NOT NULL DEFAULT '';
+
+CREATE UNIQUE INDEX IF NOT EXISTS users_oidc_identity_idx
+    ON users (oidc_issuer, oidc_subject) WHERE oidc_subject <> '';
@@ -0,0 +1,27 @@
+-- Projects group the todos of a workspace. Names are unique within a
+-- workspace, ignoring case; projects outside every workspace share one
+-- namespace.
+CREATE TABLE IF NOT EXISTS projects (
+    id           UUID PRIMARY KEY,
+    workspace_id UUID REFERENCES workspaces (id) ON DELETE CASCADE,
+    name         TEXT NOT NULL,
+    description  TEXT NOT NULL DEFAULT '',
+    color        TEXT NOT NULL DEFAULT '',
+    archived     BOOLEAN NOT NULL DEFAULT FALSE,
+    archived_at  TIMESTAMPTZ,
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at   TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS projects_workspace_name_idx
+    ON projects (COALESCE(workspace_id, '00000000-0000-0000-0000-000000000000'), lower(name));
+
+-- A project can only be deleted once no todo, deleted or not, is in it.
+ALTER TABLE todos ADD COLUMN IF NOT EXISTS project_id UUID REFERENCES projects (id);
+CREATE INDEX IF NOT EXISTS todos_project_id_idx ON todos (project_id);
+
+-- Projects are confined to their workspace like todos and logs (see 0010).
+ALTER TABLE projects ENABLE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS projects_workspace_isolation ON projects;
+CREATE POLICY projects_workspace_isolation ON projects
+    USING (current_setting('app.workspace_id', true) = '*' OR workspace_id::text = current_setting('app.workspace_id', true));
@@ -0,0 +1,35 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// rlsTables are the tables with workspace isolation policies on
+// app.workspace_id.
+var rlsTables = []string{"todos", "logs", "projects"}
+
+// CheckRowLevelSecurity makes sure the workspace isolation policies apply to
+// the role db connects as, which database.row_level_security relies on. It
+// only reads the catalog: the policies are set up by the migrations.
+func CheckRowLevelSecurity(ctx context.Context, db *sql.DB) error {
+	for _, table := range rlsTables {
+		var on, bypass bool
+		err := db.QueryRowContext(ctx, `
+			SELECT c.relrowsecurity,
+			       r.rolsuper OR r.rolbypassrls OR (pg_has_role(current_user, c.relowner, 'USAGE') AND NOT c.relforcerowsecurity)
+			FROM pg_class c, pg_roles r
+			WHERE c.oid = $1::regclass AND r.rolname = current_user`, table).Scan(&on, &bypass)
+		if err != nil {
+			return fmt.Errorf("reading row-level security of %s: %w", table, err)
+		}
+		if !on {
+			return fmt.Errorf("row-level security is off for %s; apply the pending migrations", table)
+		}
+		if bypass {
+			return fmt.Errorf("the database role bypasses row-level security on %s; connect as a role that doesn't own the tables and has neither SUPERUSER nor BYPASSRLS", table)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,210 @@
+// Package filter parses the filter query language of list endpoints into an
+// AST, and evaluates it either as a parameterized SQL condition or against
+// in-memory records.
+//
+// The grammar, with keywords matched case-insensitively:
+//
+//	expr       = term { "or" term }
+//	term       = factor { "and" factor }
+//	factor     = "not" factor | "(" expr ")" | comparison
+//	comparison = field op value
+//	           | field [ "not" ] "in" "(" value { "," value } ")"
+//	           | field "is" [ "not" ] "null"
+//	op         = "=" | "!=" | "<" | "<=" | ">" | ">=" | "~"
+//	value      = word | "double-quoted string"
+//
+// "~" is a case-insensitive substring match. Comparisons against a missing
+// (null) value are false, so "not" and "!=" select rows without a value.
+package filter
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Kind is the type of a filterable field, which decides how values are
+// parsed and compared.
+type Kind int
+
+const (
+	String Kind = iota
+	Date        // a calendar day, written 2006-01-02
+	Time        // an instant, written RFC 3339 or as a day (midnight UTC)
+)
+
+// Field describes a filterable field.
+type Field struct {
+	Kind     Kind
+	Nullable bool // may be compared with "is null"
+}
+
+// Schema lists the fields a filter may name. Field names double as the SQL
+// column names.
+type Schema map[string]Field
+
+// Expr is a node of a parsed filter.
+type Expr interface {
+	sql(b *sqlBuilder) string
+	match(value func(field string) interface{}) bool
+}
+
+// And matches when both sides match.
+type And struct{ Left, Right Expr }
+
+// Or matches when either side matches.
+type Or struct{ Left, Right Expr }
+
+// Not matches when Expr does not.
+type Not struct{ Expr Expr }
+
+// Comparison tests one field. Op is one of =, !=, <, <=, >, >=, ~, "in" or
+// "is null"; Values holds one value (several for "in", none for "is null"),
+// typed by the field's Kind: string or time.Time.
+type Comparison struct {
+	Field    string
+	Kind     Kind
+	Nullable bool
+	Op       string
+	Values   []interface{}
+}
+
+// SQL compiles e into a condition over columns named like the fields. Values
+// become placeholders numbered from argIndex, returned in args.
+func SQL(e Expr, argIndex int) (clause string, args []interface{}) {
+	b := &sqlBuilder{next: argIndex}
+	return e.sql(b), b.args
+}
+
+// Match evaluates e against a record. value returns a field's value as a
+// string, a time.Time, or nil when it is unset.
+func Match(e Expr, value func(field string) interface{}) bool {
+	return e.match(value)
+}
+
+type sqlBuilder struct {
+	next int
+	args []interface{}
+}
+
+func (b *sqlBuilder) param(v interface{}) string {
+	b.args = append(b.args, v)
+	b.next++
+	return fmt.Sprintf("$%d", b.next-1)
+}
+
+func (e And) sql(b *sqlBuilder) string { return "(" + e.Left.sql(b) + " AND " + e.Right.sql(b) + ")" }
+func (e Or) sql(b *sqlBuilder) string  { return "(" + e.Left.sql(b) + " OR " + e.Right.sql(b) + ")" }
+func (e Not) sql(b *sqlBuilder) string { return "NOT " + e.Expr.sql(b) }
+
+func (e Comparison) sql(b *sqlBuilder) string {
+	// The field name comes from the schema, never from the raw input.
+	col := e.Field
+	if e.Op == "is null" {
+		return "(" + col + " IS NULL)"
+	}
+
+	var cond string
+	switch e.Op {
+	case "~":
+		cond = col + " ILIKE " + b.param("%"+escapeLike(e.Values[0].(string))+"%")
+	case "in":
+		params := make([]string, len(e.Values))
+		for i, v := range e.Values {
+			params[i] = b.param(sqlValue(e.Kind, v))
+		}
+		cond = col + " IN (" + strings.Join(params, ", ") + ")"
+	default:
+		op := e.Op
+		if op == "!=" {
+			op = "<>"
+		}
+		cond = col + " " + op + " " + b.param(sqlValue(e.Kind, e.Values[0]))
+	}
+	if !e.Nullable {
+		return "(" + cond + ")"
+	}
+	// Comparisons with NULL are false rather than unknown, so that NOT
+	// behaves the same here as in Match.
+	return "(" + col + " IS NOT NULL AND " + cond + ")"
+}
+
+func sqlValue(kind Kind, v interface{}) interface{} {
+	if kind == Date {
+		return v.(time.Time).Format("2006-01-02")
+	}
+	return v
+}
+
+// escapeLike escapes the LIKE wildcards in s.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+func (e And) match(value func(string) interface{}) bool {
+	return e.Left.match(value) && e.Right.match(value)
+}
+
+func (e Or) match(value func(string) interface{}) bool {
+	return e.Left.match(value) || e.Right.match(value)
+}
+
+func (e Not) match(value func(string) interface{}) bool { return !e.Expr.match(value) }
+
+func (e Comparison) match(value func(string) interface{}) bool {
+	v := value(e.Field)
+	if t, ok := v.(time.Time); ok && t.IsZero() {
+		v = nil
+	}
+	if e.Op == "is null" {
+		return v == nil
+	}
+	if v == nil {
+		return false
+	}
+
+	switch e.Op {
+	case "~":
+		s, _ := v.(string)
+		return strings.Contains(strings.ToLower(s), strings.ToLower(e.Values[0].(string)))
+	case "in":
+		for _, want := range e.Values {
+			if compare(e.Kind, v, want) == 0 {
+				return true
+			}
+		}
+		return false
+	}
+
+	c := compare(e.Kind, v, e.Values[0])
+	switch e.Op {
+	case "=":
+		return c == 0
+	case "!=":
+		return c != 0
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	case ">=":
+		return c >= 0
+	}
+	return false
+}
+
+// compare orders a record value against a filter value of the given kind.
+func compare(kind Kind, v, want interface{}) int {
+	switch kind {
+	case Date:
+		a, _ := v.(time.Time)
+		return strings.Compare(a.Format("2006-01-02"), want.(time.Time).Format("2006-01-02"))
+	case Time:
+		a, _ := v.(time.Time)
+		return a.Compare(want.(time.Time))
+	default:
+		a, _ := v.(string)
+		return strings.Compare(a, want.(string))
+	}
+}
@@ -0,0 +1,157 @@
+package filter_test
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+	"todo-api/filter"
+)
+
+var schema = filter.Schema{
+	"title":        {Kind: filter.String},
+	"status":       {Kind: filter.String},
+	"due_date":     {Kind: filter.Date, Nullable: true},
+	"created_at":   {Kind: filter.Time},
+	"started_at":   {Kind: filter.Time, Nullable: true},
+	"completed_at": {Kind: filter.Time, Nullable: true},
+}
+
+func TestSQL(t *testing.T) {
+	tests := []struct {
+		src      string
+		argIndex int
+		clause   string
+		args     []interface{}
+	}{
+		{src: "status = done", clause: "(status = $1)", args: []interface{}{"done"}},
+		{src: "status = done", argIndex: 3, clause: "(status = $3)", args: []interface{}{"done"}},
+		{src: `title = "buy milk"`, clause: "(title = $1)", args: []interface{}{"buy milk"}},
+		{src: `title = "say \"hi\""`, clause: "(title = $1)", args: []interface{}{`say "hi"`}},
+		{src: "STATUS != done AND NOT title ~ x", clause: "((status <> $1) AND NOT (title ILIKE $2))", args: []interface{}{"done", "%x%"}},
+		{src: `title ~ "50%_off\\"`, clause: "(title ILIKE $1)", args: []interface{}{`%50\%\_off\\%`}},
+		{src: "status in (pending, done)", clause: "(status IN ($1, $2))", args: []interface{}{"pending", "done"}},
+		{src: "status not in (done)", clause: "NOT (status IN ($1))", args: []interface{}{"done"}},
+		{src: "due_date < 2026-01-02", clause: "(due_date IS NOT NULL AND due_date < $1)", args: []interface{}{"2026-01-02"}},
+		{src: "due_date is null", clause: "(due_date IS NULL)"},
+		{src: "due_date is not null", clause: "NOT (due_date IS NULL)"},
+		{src: "created_at >= 2026-01-02T03:04:05Z", clause: "(created_at >= $1)",
+			args: []interface{}{time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)}},
+		{src: "created_at < 2026-01-02", clause: "(created_at < $1)", args: []interface{}{time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC)}},
+		{src: "status = a or status = b and title = c", clause: "((status = $1) OR ((status = $2) AND (title = $3)))",
+			args: []interface{}{"a", "b", "c"}},
+		{src: "not (status = a or status = b)", clause: "NOT ((status = $1) OR (status = $2))", args: []interface{}{"a", "b"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.src, func(t *testing.T) {
+			e, err := filter.Parse(tt.src, schema)
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			argIndex := tt.argIndex
+			if argIndex == 0 {
+				argIndex = 1
+			}
+			clause, args := filter.SQL(e, argIndex)
+			if clause != tt.clause || !reflect.DeepEqual(args, tt.args) {
+				t.Errorf("SQL = %s %v, want %s %v", clause, args, tt.clause, tt.args)
+			}
+		})
+	}
+}
+
+func TestMatch(t *testing.T) {
+	record := map[string]interface{}{
+		"title":        "Buy Milk",
+		"status":       "pending",
+		"due_date":     time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC),
+		"created_at":   time.Date(2026, 1, 1, 9, 30, 0, 0, time.UTC),
+		"completed_at": time.Time{}, // unset times are null too
+	}
+	value := func(field string) interface{} { return record[field] }
+
+	tests := []struct {
+		src  string
+		want bool
+	}{
+		{src: "title ~ milk", want: true},
+		{src: `title = "buy milk"`, want: false},
+		{src: "status in (done, pending)", want: true},
+		{src: "status not in (done, pending)", want: false},
+		{src: "due_date = 2026-03-01", want: true},
+		{src: "due_date < 2026-03-01", want: false},
+		{src: "due_date <= 2026-03-01", want: true},
+		{src: "created_at >= 2026-01-01T10:00:00+01:00", want: true},
+		{src: "created_at > 2026-01-01T09:30:00Z", want: false},
+		{src: "started_at is null", want: true},
+		{src: "completed_at is null", want: true},
+		{src: "due_date is not null", want: true},
+		{src: "started_at > 2000-01-01", want: false},
+		{src: "started_at != 2000-01-01", want: false},
+		{src: "not started_at > 2000-01-01", want: true},
+		{src: "status = done or title ~ buy and due_date is not null", want: true},
+		{src: "(status = done or title ~ buy) and due_date is null", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.src, func(t *testing.T) {
+			e, err := filter.Parse(tt.src, schema)
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			if got := filter.Match(e, value); got != tt.want {
+				t.Errorf("Match = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		src string
+		pos int
+		msg string
+	}{
+		{src: "", pos: 0, msg: "expected a field name"},
+		{src: "owner = x", pos: 0, msg: `unknown field "owner"`},
+		{src: "status =", pos: 8, msg: "expected a value, got end of filter"},
+		{src: `status = "open`, pos: 9, msg: "unterminated string"},
+		{src: "status ! done", pos: 7, msg: `expected "!="`},
+		{src: "status = a)", pos: 10, msg: `unexpected ")"`},
+		{src: "(status = a", pos: 11, msg: `expected ")"`},
+		{src: "status = a and", pos: 14, msg: "expected a field name"},
+		{src: "status done", pos: 7, msg: "expected an operator"},
+		{src: "title is null", pos: 6, msg: "title is never null"},
+		{src: "due_date is empty", pos: 12, msg: `expected "null"`},
+		{src: "due_date ~ 2026", pos: 9, msg: "~ only applies to text fields"},
+		{src: "due_date = tomorrow", pos: 11, msg: "expected a date"},
+		{src: "created_at > noon", pos: 13, msg: "expected a date or RFC 3339 time"},
+		{src: "status in (a b)", pos: 13, msg: `expected "," or ")"`},
+		{src: "status in a", pos: 10, msg: `expected "(" after in`},
+		// positions are byte offsets
+		{src: "title = é & x", pos: 11, msg: "unexpected character '&'"},
+		{src: strings.Repeat("(", 40) + "status = a" + strings.Repeat(")", 40), msg: "nested more than 32 levels"},
+		{src: strings.Repeat("not ", 40) + "status = a", msg: "nested more than 32 levels"},
+		{src: strings.Repeat("status = a or ", 100) + "status = a", msg: "more than 100 comparisons"},
+		{src: strings.Repeat(" ", 2001), pos: 2000, msg: "longer than 2000 characters"},
+	}
+	for _, tt := range tests {
+		name := tt.src
+		if len(name) > 40 {
+			name = name[:40]
+		}
+		t.Run(name, func(t *testing.T) {
+			_, err := filter.Parse(tt.src, schema)
+			var syntaxErr *filter.SyntaxError
+			if !errors.As(err, &syntaxErr) {
+				t.Fatalf("Parse error = %v, want a *SyntaxError", err)
+			}
+			if !strings.Contains(syntaxErr.Msg, tt.msg) {
+				t.Errorf("message = %q, want it to contain %q", syntaxErr.Msg, tt.msg)
+			}
+			if tt.pos != 0 && syntaxErr.Pos != tt.pos {
+				t.Errorf("position = %d, want %d", syntaxErr.Pos, tt.pos)
+			}
+		})
+	}
+}
@@ -0,0 +1,340 @@
+package filter
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Limits that keep hostile filters cheap to parse and to run.
+const (
+	maxLength = 2000
+	maxDepth  = 32
+	maxTerms  = 100
+)
+
+// SyntaxError reports where and why a filter could not be parsed. Pos is a
+// byte offset into the filter.
+type SyntaxError struct {
+	Pos int
+	Msg string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("filter: at position %d: %s", e.Pos, e.Msg)
+}
+
+// Parse parses src into an expression over the fields of schema.
+func Parse(src string, schema Schema) (Expr, error) {
+	if len(src) > maxLength {
+		return nil, &SyntaxError{Pos: maxLength, Msg: fmt.Sprintf("filter is longer than %d characters", maxLength)}
+	}
+	tokens, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens, schema: schema}
+	e, err := p.expr(0)
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, p.errorf(t, "unexpected %s", t)
+	}
+	return e, nil
+}
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokWord
+	tokString
+	tokOp
+	tokLParen
+	tokRParen
+	tokComma
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokEOF:
+		return "end of filter"
+	case tokString:
+		return fmt.Sprintf("string %q", t.text)
+	default:
+		return fmt.Sprintf("%q", t.text)
+	}
+}
+
+// is reports whether t is the given keyword.
+func (t token) is(keyword string) bool {
+	return t.kind == tokWord && strings.EqualFold(t.text, keyword)
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune("_-:.+", r)
+}
+
+func lex(src string) ([]token, error) {
+	var tokens []token
+	rs := []rune(src)
+	offset := func(i int) int { return len(string(rs[:i])) }
+
+	for i := 0; i < len(rs); {
+		r := rs[i]
+		start := i
+		switch {
+		case unicode.IsSpace(r):
+			i++
+			continue
+		case r == '(':
+			tokens = append(tokens, token{tokLParen, "(", offset(i)})
+			i++
+		case r == ')':
+			tokens = append(tokens, token{tokRParen, ")", offset(i)})
+			i++
+		case r == ',':
+			tokens = append(tokens, token{tokComma, ",", offset(i)})
+			i++
+		case r == '"':
+			var b strings.Builder
+			i++
+			for ; i < len(rs) && rs[i] != '"'; i++ {
+				if rs[i] == '\\' && i+1 < len(rs) {
+					i++
+				}
+				b.WriteRune(rs[i])
+			}
+			if i == len(rs) {
+				return nil, &SyntaxError{Pos: offset(start), Msg: "unterminated string"}
+			}
+			i++
+			tokens = append(tokens, token{tokString, b.String(), offset(start)})
+		case strings.ContainsRune("=!<>~", r):
+			op := string(r)
+			if i+1 < len(rs) && rs[i+1] == '=' && r != '=' && r != '~' {
+				op += "="
+			}
+			if op == "!" {
+				return nil, &SyntaxError{Pos: offset(i), Msg: `expected "!="`}
+			}
+			i += len(op)
+			tokens = append(tokens, token{tokOp, op, offset(start)})
+		case isWordRune(r):
+			for i < len(rs) && isWordRune(rs[i]) {
+				i++
+			}
+			tokens = append(tokens, token{tokWord, string(rs[start:i]), offset(start)})
+		default:
+			return nil, &SyntaxError{Pos: offset(i), Msg: fmt.Sprintf("unexpected character %q", r)}
+		}
+	}
+	return append(tokens, token{kind: tokEOF, pos: len(src)}), nil
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+	schema Schema
+	terms  int
+}
+
+func (p *parser) peek() token { return p.tokens[p.pos] }
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) errorf(t token, format string, args ...interface{}) error {
+	return &SyntaxError{Pos: t.pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+func (p *parser) expr(depth int) (Expr, error) {
+	if depth > maxDepth {
+		return nil, p.errorf(p.peek(), "filter is nested more than %d levels deep", maxDepth)
+	}
+	left, err := p.term(depth)
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().is("or") {
+		p.next()
+		right, err := p.term(depth)
+		if err != nil {
+			return nil, err
+		}
+		left = Or{left, right}
+	}
+	return left, nil
+}
+
+func (p *parser) term(depth int) (Expr, error) {
+	left, err := p.factor(depth)
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().is("and") {
+		p.next()
+		right, err := p.factor(depth)
+		if err != nil {
+			return nil, err
+		}
+		left = And{left, right}
+	}
+	return left, nil
+}
+
+func (p *parser) factor(depth int) (Expr, error) {
+	t := p.peek()
+	switch {
+	case t.is("not"):
+		p.next()
+		if depth+1 > maxDepth {
+			return nil, p.errorf(t, "filter is nested more than %d levels deep", maxDepth)
+		}
+		e, err := p.factor(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		return Not{e}, nil
+	case t.kind == tokLParen:
+		p.next()
+		e, err := p.expr(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		if t := p.next(); t.kind != tokRParen {
+			return nil, p.errorf(t, `expected ")", got %s`, t)
+		}
+		return e, nil
+	default:
+		return p.comparison()
+	}
+}
+
+func (p *parser) comparison() (Expr, error) {
+	t := p.next()
+	if t.kind != tokWord {
+		return nil, p.errorf(t, "expected a field name, got %s", t)
+	}
+	name := strings.ToLower(t.text)
+	field, ok := p.schema[name]
+	if !ok {
+		return nil, p.errorf(t, "unknown field %q (filterable fields: %s)", t.text, p.fieldNames())
+	}
+	if p.terms++; p.terms > maxTerms {
+		return nil, p.errorf(t, "filter has more than %d comparisons", maxTerms)
+	}
+	c := Comparison{Field: name, Kind: field.Kind, Nullable: field.Nullable}
+
+	op := p.next()
+	switch {
+	case op.is("is"):
+		negate := false
+		if p.peek().is("not") {
+			p.next()
+			negate = true
+		}
+		if t := p.next(); !t.is("null") {
+			return nil, p.errorf(t, `expected "null", got %s`, t)
+		}
+		if !field.Nullable {
+			return nil, p.errorf(op, "%s is never null", name)
+		}
+		c.Op = "is null"
+		if negate {
+			return Not{c}, nil
+		}
+		return c, nil
+
+	case op.is("in"), op.is("not") && p.peek().is("in"):
+		negate := op.is("not")
+		if negate {
+			p.next()
+		}
+		if t := p.next(); t.kind != tokLParen {
+			return nil, p.errorf(t, `expected "(" after in, got %s`, t)
+		}
+		for {
+			v, err := p.value(field.Kind)
+			if err != nil {
+				return nil, err
+			}
+			c.Values = append(c.Values, v)
+			t := p.next()
+			if t.kind == tokRParen {
+				break
+			}
+			if t.kind != tokComma {
+				return nil, p.errorf(t, `expected "," or ")", got %s`, t)
+			}
+		}
+		c.Op = "in"
+		if negate {
+			return Not{c}, nil
+		}
+		return c, nil
+
+	case op.kind == tokOp:
+		if op.text == "~" && field.Kind != String {
+			return nil, p.errorf(op, "~ only applies to text fields, not %s", name)
+		}
+		v, err := p.value(field.Kind)
+		if err != nil {
+			return nil, err
+		}
+		c.Op = op.text
+		c.Values = []interface{}{v}
+		return c, nil
+	}
+	return nil, p.errorf(op, "expected an operator after %s, got %s", name, op)
+}
+
+// value parses the next token as a value of the given kind.
+func (p *parser) value(kind Kind) (interface{}, error) {
+	t := p.next()
+	if t.kind != tokWord && t.kind != tokString {
+		return nil, p.errorf(t, "expected a value, got %s", t)
+	}
+	switch kind {
+	case Date:
+		d, err := time.Parse("2006-01-02", t.text)
+		if err != nil {
+			return nil, p.errorf(t, "expected a date like 2006-01-02, got %s", t)
+		}
+		return d, nil
+	case Time:
+		if d, err := time.Parse("2006-01-02", t.text); err == nil {
+			return d, nil
+		}
+		ts, err := time.Parse(time.RFC3339, t.text)
+		if err != nil {
+			return nil, p.errorf(t, "expected a date or RFC 3339 time, got %s", t)
+		}
+		return ts, nil
+	default:
+		return t.text, nil
+	}
+}
+
+func (p *parser) fieldNames() string {
+	names := make([]string, 0, len(p.schema))
+	for name := range p.schema {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
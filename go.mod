@@ -3,6 +3,9 @@ module todo-api
 go 1.23.5
 
 require (
-	github.com/google/uuid v1.6.0	
+	github.com/BurntSushi/toml v1.6.0
+	github.com/google/uuid v1.6.0
 	github.com/lib/pq v1.10.9
+	golang.org/x/crypto v0.36.0
+	gopkg.in/yaml.v3 v3.0.1
 )
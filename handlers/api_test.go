@@ -0,0 +1,178 @@
+package handlers_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"todo-api/config"
+	"todo-api/handlers"
+	"todo-api/routes"
+	"todo-api/store"
+)
+
+// adminToken is the admin token of every test API.
+const adminToken = "test-admin-token"
+
+// testPassword is the password of every test account.
+const testPassword = "correct horse battery"
+
+// testAPI serves the whole API, middleware included, from an in-memory
+// store.
+type testAPI struct {
+	t       *testing.T
+	cfg     *config.Config
+	store   *store.Memory
+	handler http.Handler
+}
+
+// newTestAPI builds a test API from the default configuration, changed by
+// configure.
+func newTestAPI(t *testing.T, configure ...func(*config.Config)) *testAPI {
+	t.Helper()
+	cfg := config.Default()
+	cfg.Storage.Driver = "memory"
+	cfg.API.AdminToken = adminToken
+	// Fixed secrets keep tokens and cursors valid when wrapStore rebuilds
+	// the server
+	cfg.Auth.JWTSecret = "test-jwt-secret"
+	cfg.API.CursorSecret = "test-cursor-secret"
+	for _, f := range configure {
+		f(cfg)
+	}
+	a := &testAPI{t: t, cfg: cfg, store: store.NewMemory()}
+	a.serve(a.store)
+	return a
+}
+
+// wrapStore makes the API use wrap(a.store) from now on, for tests that
+// need the store to misbehave.
+func (a *testAPI) wrapStore(wrap func(store.Store) store.Store) {
+	a.t.Helper()
+	a.serve(wrap(a.store))
+}
+
+func (a *testAPI) serve(st store.Store) {
+	a.t.Helper()
+	srv, err := handlers.NewServer(a.cfg, st)
+	if err != nil {
+		a.t.Fatalf("NewServer: %v", err)
+	}
+	a.t.Cleanup(func() { srv.Close(context.Background()) })
+	a.handler = handlers.RequestID(handlers.ProblemErrors(srv.Authenticate(handlers.RequireScopes(routes.SetupRoutes(srv), routes.Scopes))))
+}
+
+// response is a recorded response with its JSON body decoded.
+type response struct {
+	Code   int
+	Header http.Header
+	Body   map[string]interface{}
+}
+
+// do sends a request as the holder of token, if any. body is sent as is if
+// it is a string and as JSON otherwise; header holds name and value pairs.
+func (a *testAPI) do(method, path, token string, body interface{}, header ...string) response {
+	a.t.Helper()
+	var reader io.Reader
+	switch b := body.(type) {
+	case nil:
+	case string:
+		reader = bytes.NewReader([]byte(b))
+	default:
+		data, err := json.Marshal(b)
+		if err != nil {
+			a.t.Fatal(err)
+		}
+		reader = bytes.NewReader(data)
+	}
+	req := httptest.NewRequest(method, path, reader)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	rec := httptest.NewRecorder()
+	a.handler.ServeHTTP(rec, req)
+
+	res := response{Code: rec.Code, Header: rec.Header()}
+	if rec.Body.Len() > 0 {
+		if err := json.Unmarshal(rec.Body.Bytes(), &res.Body); err != nil {
+			a.t.Fatalf("%s %s: response is not a JSON object: %s", method, path, rec.Body)
+		}
+	}
+	return res
+}
+
+// expect fails the test unless res has the status code want.
+func (a *testAPI) expect(res response, want int) response {
+	a.t.Helper()
+	if res.Code != want {
+		a.t.Fatalf("status = %d, want %d; body %v", res.Code, want, res.Body)
+	}
+	return res
+}
+
+// user is a signed-up account.
+type user struct {
+	ID    string
+	Token string
+}
+
+// signUp registers an account and, unless role is empty, gives it role and
+// signs it in again so its token carries the role.
+func (a *testAPI) signUp(email, role string) user {
+	a.t.Helper()
+	res := a.expect(a.do("POST", "/auth/register", "", map[string]string{"email": email, "password": testPassword}), http.StatusCreated)
+	u := user{ID: str(res.Body, "user", "id"), Token: str(res.Body, "access_token")}
+	if role == "" {
+		return u
+	}
+	a.expect(a.do("PUT", "/users/"+u.ID+"/role", adminToken, map[string]string{"role": role}), http.StatusOK)
+	res = a.expect(a.do("POST", "/auth/login", "", map[string]string{"email": email, "password": testPassword}), http.StatusOK)
+	u.Token = str(res.Body, "access_token")
+	return u
+}
+
+// workspace returns the ID of the first workspace of u.
+func (a *testAPI) workspace(u user) string {
+	a.t.Helper()
+	res := a.expect(a.do("GET", "/workspaces", u.Token, nil), http.StatusOK)
+	list, _ := res.Body["workspaces"].([]interface{})
+	if len(list) == 0 {
+		a.t.Fatalf("user %s has no workspace", u.ID)
+	}
+	return str(list[0].(map[string]interface{}), "workspace_id")
+}
+
+// str returns the string at the path of keys in v, or "" if there is none.
+func str(v map[string]interface{}, keys ...string) string {
+	var cur interface{} = v
+	for _, k := range keys {
+		m, ok := cur.(map[string]interface{})
+		if !ok {
+			return ""
+		}
+		cur = m[k]
+	}
+	s, _ := cur.(string)
+	return s
+}
+
+// items returns the array at key in v.
+func items(v map[string]interface{}, key string) []map[string]interface{} {
+	list, _ := v[key].([]interface{})
+	out := []map[string]interface{}{}
+	for _, item := range list {
+		if m, ok := item.(map[string]interface{}); ok {
+			out = append(out, m)
+		}
+	}
+	return out
+}
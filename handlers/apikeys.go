@@ -0,0 +1,151 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+	"todo-api/auth"
+	"todo-api/models"
+	"todo-api/store"
+
+	"github.com/google/uuid"
+)
+
+// maxAPIKeyName is the longest name an API key can be given.
+const maxAPIKeyName = 100
+
+// apiKeyRequest is the body of a request creating an API key.
+type apiKeyRequest struct {
+	Name      string     `json:"name"`
+	Scopes    []string   `json:"scopes"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// CreateAPIKey creates an API key for the signed-in user. The key itself is
+// only ever returned in this response; afterwards only its prefix is shown.
+func (s *Server) CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	c, ok := s.requireSession(w, r, "manage API keys")
+	if !ok {
+		return
+	}
+	var body apiKeyRequest
+	if err := decodeJSON(w, r, &body); err != nil {
+		return
+	}
+	now := time.Now()
+	if errs := validateAPIKey(body, now); len(errs) > 0 {
+		writeValidationError(w, r, errs)
+		return
+	}
+
+	secret, hash, prefix, err := auth.NewAPIKey()
+	if err != nil {
+		writeStoreError(w, r, err, "Failed to create API key")
+		return
+	}
+	key := models.APIKey{
+		ID:        uuid.New(),
+		UserID:    c.UserID,
+		Name:      body.Name,
+		Prefix:    prefix,
+		KeyHash:   hash,
+		Scopes:    body.Scopes,
+		ExpiresAt: body.ExpiresAt,
+		CreatedAt: now,
+	}
+	if err := s.store.CreateAPIKey(r.Context(), &key); err != nil {
+		writeStoreError(w, r, err, "Failed to create API key")
+		return
+	}
+
+	response := struct {
+		models.APIKey
+		Key string `json:"key"`
+	}{key, secret}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Location", "/auth/keys/"+key.ID.String())
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(response)
+}
+
+// ListAPIKeys lists the signed-in user's API keys, revoked ones included.
+func (s *Server) ListAPIKeys(w http.ResponseWriter, r *http.Request) {
+	c, ok := s.requireSession(w, r, "manage API keys")
+	if !ok {
+		return
+	}
+	keys, err := s.store.ListAPIKeys(r.Context(), c.UserID)
+	if err != nil {
+		writeStoreError(w, r, err, "Unable to fetch API keys")
+		return
+	}
+	if keys == nil {
+		keys = []models.APIKey{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"keys": keys})
+}
+
+// RevokeAPIKey revokes one of the signed-in user's API keys. Requests made
+// with it fail from then on.
+func (s *Server) RevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	c, ok := s.requireSession(w, r, "manage API keys")
+	if !ok {
+		return
+	}
+	id, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidID, "Invalid ID format")
+		return
+	}
+	err = s.store.RevokeAPIKey(r.Context(), c.UserID, id, time.Now())
+	if errors.Is(err, store.ErrConflict) {
+		writeError(w, r, http.StatusConflict, CodeConflict, "API key is already revoked")
+		return
+	}
+	if err != nil {
+		writeStoreError(w, r, err, "API key not found")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// requireSession checks that the request was made by a user signed in with
+// a password rather than with an API key or the admin token, and writes 403
+// otherwise, saying that only they can do what.
+func (s *Server) requireSession(w http.ResponseWriter, r *http.Request, what string) (caller, bool) {
+	c := callerFrom(r.Context())
+	if c.adminToken() || c.APIKey {
+		writeError(w, r, http.StatusForbidden, CodeForbidden, "Only a signed-in user can "+what)
+		return c, false
+	}
+	return c, true
+}
+
+// validateAPIKey checks the body of a request creating an API key.
+func validateAPIKey(body apiKeyRequest, now time.Time) []models.FieldError {
+	var errs []models.FieldError
+	switch {
+	case body.Name == "":
+		errs = append(errs, models.FieldError{Field: "name", Code: "required", Message: "name is required"})
+	case len(body.Name) > maxAPIKeyName:
+		errs = append(errs, models.FieldError{Field: "name", Code: "max",
+			Message: fmt.Sprintf("name must be at most %d characters long", maxAPIKeyName)})
+	}
+	if len(body.Scopes) == 0 {
+		errs = append(errs, models.FieldError{Field: "scopes", Code: "required", Message: "scopes must list at least one scope"})
+	}
+	for i, name := range body.Scopes {
+		if _, err := auth.ParseScope(name); err != nil {
+			errs = append(errs, models.FieldError{Field: fmt.Sprintf("scopes[%d]", i), Code: "oneof",
+				Message: fmt.Sprintf("scope must be one of %v", auth.Scopes)})
+		}
+	}
+	if body.ExpiresAt != nil && !body.ExpiresAt.After(now) {
+		errs = append(errs, models.FieldError{Field: "expires_at", Code: "future", Message: "expires_at must be in the future"})
+	}
+	return errs
+}
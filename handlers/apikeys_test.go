@@ -0,0 +1,131 @@
+package handlers_test
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+	"todo-api/auth"
+	"todo-api/models"
+
+	"github.com/google/uuid"
+)
+
+// apiKey creates an API key for u with the given scopes and returns it.
+func (a *testAPI) apiKey(u user, scopes ...string) (key, id string) {
+	a.t.Helper()
+	res := a.expect(a.do("POST", "/auth/keys", u.Token, map[string]interface{}{"name": "ci", "scopes": scopes}), http.StatusCreated)
+	return str(res.Body, "key"), str(res.Body, "id")
+}
+
+func TestAPIKeyScopes(t *testing.T) {
+	api := newTestAPI(t)
+	u := api.signUp("keys@example.com", "")
+	readOnly, _ := api.apiKey(u, "todos:read")
+	readWrite, _ := api.apiKey(u, "todos:read", "todos:write")
+
+	tests := []struct {
+		name         string
+		key          string
+		method, path string
+		body         interface{}
+		code         int
+		scope        string // the scope a 403 asks for, if any
+	}{
+		{name: "read with todos:read", key: readOnly, method: "GET", path: "/todos", code: http.StatusOK},
+		{name: "write with todos:read", key: readOnly, method: "POST", path: "/todos", body: map[string]string{"title": "x"},
+			code: http.StatusForbidden, scope: "todos:write"},
+		{name: "write with todos:write", key: readWrite, method: "POST", path: "/todos", body: map[string]string{"title": "x"},
+			code: http.StatusCreated},
+		{name: "logs without logs:read", key: readWrite, method: "GET", path: "/logs", code: http.StatusForbidden, scope: "logs:read"},
+		{name: "admin route", key: readWrite, method: "GET", path: "/users", code: http.StatusForbidden, scope: "admin"},
+		{name: "key management", key: readWrite, method: "GET", path: "/auth/keys", code: http.StatusForbidden},
+		{name: "sign-in routes", key: readWrite, method: "GET", path: "/auth/me", code: http.StatusForbidden},
+		{name: "unscoped route", key: readOnly, method: "GET", path: "/auth/permissions", code: http.StatusOK},
+		{name: "unknown key", key: auth.APIKeyPrefix + "made-up", method: "GET", path: "/todos", code: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := api.expect(api.do(tt.method, tt.path, tt.key, tt.body), tt.code)
+			if str(res.Body, "required_scope") != tt.scope {
+				t.Errorf("required_scope = %q, want %q", str(res.Body, "required_scope"), tt.scope)
+			}
+		})
+	}
+}
+
+// Scopes narrow what a key may do but never widen its user's role.
+func TestAPIKeyKeepsTheRoleOfItsUser(t *testing.T) {
+	api := newTestAPI(t)
+	viewer := api.signUp("viewer-key@example.com", "viewer")
+	key, _ := api.apiKey(viewer, "todos:read", "todos:write", "logs:read", "admin")
+	api.expect(api.do("GET", "/todos", key, nil), http.StatusOK)
+	api.expect(api.do("POST", "/todos", key, map[string]string{"title": "x"}), http.StatusForbidden)
+	api.expect(api.do("GET", "/users", key, nil), http.StatusForbidden)
+}
+
+func TestAPIKeyLifecycle(t *testing.T) {
+	api := newTestAPI(t)
+	u := api.signUp("lifecycle@example.com", "")
+	key, id := api.apiKey(u, "todos:read")
+
+	list := api.expect(api.do("GET", "/auth/keys", u.Token, nil), http.StatusOK)
+	keys := items(list.Body, "keys")
+	if len(keys) != 1 || str(keys[0], "id") != id || str(keys[0], "prefix") != key[:len(auth.APIKeyPrefix)+6] {
+		t.Fatalf("keys = %v, want the new key by its prefix", keys)
+	}
+	if _, shown := keys[0]["key"]; shown {
+		t.Error("listing keys returned the secret")
+	}
+
+	api.expect(api.do("GET", "/todos", key, nil), http.StatusOK)
+	api.expect(api.do("DELETE", "/auth/keys/"+id, u.Token, nil), http.StatusNoContent)
+	api.expect(api.do("GET", "/todos", key, nil), http.StatusUnauthorized)
+	api.expect(api.do("DELETE", "/auth/keys/"+id, u.Token, nil), http.StatusConflict)
+
+	other := api.signUp("someone@example.com", "")
+	_, otherID := api.apiKey(other, "todos:read")
+	api.expect(api.do("DELETE", "/auth/keys/"+otherID, u.Token, nil), http.StatusNotFound)
+
+	// Expired keys stop working
+	expiredKey, hash, prefix, _ := auth.NewAPIKey()
+	past := time.Now().Add(-time.Minute)
+	err := api.store.CreateAPIKey(context.Background(), &models.APIKey{
+		ID: uuid.New(), UserID: uuid.MustParse(u.ID), Name: "old", Prefix: prefix, KeyHash: hash,
+		Scopes: []string{"todos:read"}, ExpiresAt: &past, CreatedAt: past.Add(-time.Hour),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	api.expect(api.do("GET", "/todos", expiredKey, nil), http.StatusUnauthorized)
+}
+
+func TestCreateAPIKeyValidation(t *testing.T) {
+	api := newTestAPI(t)
+	u := api.signUp("validate-key@example.com", "")
+	tests := []struct {
+		name   string
+		body   map[string]interface{}
+		errors []string
+	}{
+		{name: "empty", body: map[string]interface{}{}, errors: []string{"name:required", "scopes:required"}},
+		{name: "unknown scope", body: map[string]interface{}{"name": "k", "scopes": []string{"todos:read", "root"}},
+			errors: []string{"scopes[1]:oneof"}},
+		{name: "expired", body: map[string]interface{}{"name": "k", "scopes": []string{"todos:read"}, "expires_at": "2020-01-01T00:00:00Z"},
+			errors: []string{"expires_at:future"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := api.expect(api.do("POST", "/auth/keys", u.Token, tt.body), http.StatusUnprocessableEntity)
+			var got []string
+			for _, fe := range items(res.Body, "errors") {
+				got = append(got, str(fe, "field")+":"+str(fe, "code"))
+			}
+			if !reflect.DeepEqual(got, tt.errors) {
+				t.Errorf("errors = %v, want %v", got, tt.errors)
+			}
+		})
+	}
+	api.expect(api.do("POST", "/auth/keys", adminToken, map[string]interface{}{"name": "k", "scopes": []string{"admin"}}), http.StatusForbidden)
+}
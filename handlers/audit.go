@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"todo-api/models"
+	"todo-api/store"
+
+	"github.com/google/uuid"
+)
+
+// auditQueueSize is how many log entries may wait to be written before
+// LogAction falls back to writing inline.
+const auditQueueSize = 256
+
+// auditWriter writes LogAction entries in the background so requests don't
+// wait on the logs insert. Close drains whatever is still queued.
+type auditWriter struct {
+	logs    store.Store
+	scoped  bool // write through logs.Scope, for row-level security
+	entries chan models.LogEntry
+	done    chan struct{}
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+func newAuditWriter(logs store.Store, scoped bool) *auditWriter {
+	a := &auditWriter{
+		logs:    logs,
+		scoped:  scoped,
+		entries: make(chan models.LogEntry, auditQueueSize),
+		done:    make(chan struct{}),
+	}
+	go a.run()
+	return a
+}
+
+func (a *auditWriter) run() {
+	defer close(a.done)
+	for entry := range a.entries {
+		a.write(entry)
+	}
+}
+
+func (a *auditWriter) write(entry models.LogEntry) {
+	add := func(ctx context.Context) error { return a.logs.AddLog(ctx, entry) }
+	var err error
+	if a.scoped {
+		err = a.logs.Scope(context.Background(), uuid.Nil, add)
+	} else {
+		err = add(context.Background())
+	}
+	if err != nil {
+		slog.Error("Failed to log action", "action", entry.Action, "err", err)
+	}
+}
+
+// Add queues entry, or writes it immediately if the queue is full or closed.
+func (a *auditWriter) Add(entry models.LogEntry) {
+	a.mu.RLock()
+	if !a.closed {
+		select {
+		case a.entries <- entry:
+			a.mu.RUnlock()
+			return
+		default:
+		}
+	}
+	a.mu.RUnlock()
+	a.write(entry)
+}
+
+// Close stops accepting queued entries and waits until the pending ones are
+// written or ctx expires.
+func (a *auditWriter) Close(ctx context.Context) error {
+	a.mu.Lock()
+	if !a.closed {
+		a.closed = true
+		close(a.entries)
+	}
+	a.mu.Unlock()
+
+	select {
+	case <-a.done:
+		return nil
+	case <-ctx.Done():
+		slog.Warn("Gave up flushing audit log entries", "pending", len(a.entries), "err", ctx.Err())
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+	"todo-api/models"
+	"todo-api/store"
+)
+
+// blockedLogs is a log store whose writes wait until release is closed.
+type blockedLogs struct {
+	*store.Memory
+	release chan struct{}
+}
+
+func (b blockedLogs) AddLog(ctx context.Context, entry models.LogEntry) error {
+	<-b.release
+	return b.Memory.AddLog(ctx, entry)
+}
+
+func countLogs(t *testing.T, st *store.Memory) int {
+	t.Helper()
+	_, total, err := st.ListLogs(context.Background(), store.LogListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return total
+}
+
+func TestAuditWriterCloseFlushes(t *testing.T) {
+	st := store.NewMemory()
+	logs := blockedLogs{Memory: st, release: make(chan struct{})}
+	a := newAuditWriter(logs, false)
+	for i := 0; i < 10; i++ {
+		a.Add(models.LogEntry{Action: "create", Message: "queued"})
+	}
+	close(logs.release)
+
+	if err := a.Close(context.Background()); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if n := countLogs(t, st); n != 10 {
+		t.Errorf("%d entries written by Close, want 10", n)
+	}
+
+	// Entries added after Close are written inline
+	a.Add(models.LogEntry{Action: "create", Message: "late"})
+	if n := countLogs(t, st); n != 11 {
+		t.Errorf("%d entries after a late Add, want 11", n)
+	}
+	if err := a.Close(context.Background()); err != nil {
+		t.Errorf("second Close: %v", err)
+	}
+}
+
+func TestAuditWriterCloseGivesUp(t *testing.T) {
+	logs := blockedLogs{Memory: store.NewMemory(), release: make(chan struct{})}
+	defer close(logs.release)
+	a := newAuditWriter(logs, false)
+	a.Add(models.LogEntry{Action: "create", Message: "stuck"})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := a.Close(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Close = %v, want the context's error", err)
+	}
+}
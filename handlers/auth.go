@@ -0,0 +1,232 @@
+package handlers
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+	"todo-api/auth"
+	"todo-api/models"
+	"todo-api/store"
+
+	"github.com/google/uuid"
+)
+
+// caller is who a request acts for: a signed-in user, a user's API key, or
+// the holder of the admin token, who acts for no user and has the admin role.
+type caller struct {
+	UserID uuid.UUID
+	Role   auth.Role
+
+	// WorkspaceID is the workspace the request works in; uuid.Nil for
+	// callers with auth.PermTodosAll working across every workspace.
+	WorkspaceID uuid.UUID
+	// WorkspaceRole is the caller's role in WorkspaceID, if they are a
+	// member of it.
+	WorkspaceRole string
+	// NoWorkspace is set for users who belong to no workspace.
+	NoWorkspace bool
+
+	// APIKey is set for requests made with an API key, which can only do
+	// what its Scopes allow.
+	APIKey bool
+	Scopes []auth.Scope
+}
+
+// adminToken reports whether the caller used the admin token.
+func (c caller) adminToken() bool {
+	return c.UserID == uuid.Nil
+}
+
+// can reports whether the caller's credentials allow scope. Only API keys
+// are limited.
+func (c caller) can(scope auth.Scope) bool {
+	return !c.APIKey || slices.Contains(c.Scopes, scope)
+}
+
+// scopes are the scopes limiting the caller, or nil if there are none.
+func (c caller) scopes() []auth.Scope {
+	if !c.APIKey {
+		return nil
+	}
+	return append([]auth.Scope{}, c.Scopes...) // never nil, which means unlimited
+}
+
+// allowed reports whether the caller has perm.
+func (c caller) allowed(perm auth.Permission) bool {
+	return auth.Allowed(c.Role, c.scopes(), perm)
+}
+
+// errUnauthenticated is returned by authenticate for requests without valid
+// credentials.
+var errUnauthenticated = errors.New("unauthenticated")
+
+// publicRoutes are the requests Authenticate lets through without a token.
+var publicRoutes = map[string]bool{
+	"POST /auth/register":     true,
+	"POST /auth/login":        true,
+	"POST /auth/refresh":      true,
+	"POST /auth/logout":       true,
+	"GET /auth/oidc/login":    true,
+	"GET /auth/oidc/callback": true,
+}
+
+// Authenticate requires every request outside publicRoutes to carry an
+// access token, an API key or the admin token as a Bearer token. It wraps
+// the mux returned by routes.SetupRoutes.
+func (s *Server) Authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if publicRoutes[r.Method+" "+r.URL.Path] {
+			next.ServeHTTP(w, r)
+			return
+		}
+		c, err := s.authenticate(r)
+		ok := err == nil
+		if errors.Is(err, errUnauthenticated) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="todo-api"`)
+			writeError(w, r, http.StatusUnauthorized, CodeUnauthorized, "A valid access token or API key is required; sign in at /auth/login")
+			return
+		}
+		if err != nil {
+			writeStoreError(w, r, err, "Failed to check credentials")
+			return
+		}
+		if c, ok = s.selectWorkspace(w, r, c); !ok {
+			return
+		}
+		s.serveScoped(next, w, r.WithContext(context.WithValue(r.Context(), callerKey, c)))
+	})
+}
+
+// authenticate identifies the caller from the Authorization header.
+func (s *Server) authenticate(r *http.Request) (caller, error) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		return caller{}, errUnauthenticated
+	}
+	if admin := s.cfg.API.AdminToken; admin != "" && subtle.ConstantTimeCompare([]byte(token), []byte(admin)) == 1 {
+		return caller{Role: auth.RoleAdmin}, nil
+	}
+	if auth.IsAPIKey(token) {
+		return s.authenticateKey(r, token)
+	}
+	claims, err := s.tokens.Verify(token, time.Now())
+	if err != nil {
+		return caller{}, errUnauthenticated
+	}
+	return caller{UserID: claims.Subject, Role: claims.Role}, nil
+}
+
+// authenticateKey identifies the caller from an API key and records its use.
+func (s *Server) authenticateKey(r *http.Request, token string) (caller, error) {
+	now := time.Now()
+	key, err := s.store.GetAPIKeyByHash(r.Context(), auth.HashAPIKey(token))
+	if errors.Is(err, store.ErrNotFound) {
+		return caller{}, errUnauthenticated
+	}
+	if err != nil {
+		return caller{}, err
+	}
+	if key.RevokedAt != nil || key.ExpiresAt != nil && !now.Before(*key.ExpiresAt) {
+		return caller{}, errUnauthenticated
+	}
+	// Keys act with the current role of their user.
+	user, err := s.store.GetUser(r.Context(), key.UserID)
+	if err != nil {
+		return caller{}, err
+	}
+
+	// Recording every use would turn each read into a write; to the minute
+	// is precise enough.
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) >= time.Minute {
+		if err := s.store.TouchAPIKey(r.Context(), key.ID, now); err != nil {
+			slog.Warn("Failed to record use of API key", "key", key.ID, "err", err)
+		}
+	}
+
+	c := caller{UserID: key.UserID, Role: auth.Role(user.Role), APIKey: true}
+	for _, name := range key.Scopes {
+		if scope, err := auth.ParseScope(name); err == nil {
+			c.Scopes = append(c.Scopes, scope)
+		}
+	}
+	return c, nil
+}
+
+// RequireScopes refuses API key requests whose key lacks the scope that
+// scopes gives for the route, keyed by the pattern the route was registered
+// with on mux. Routes missing from scopes are closed to API keys; routes
+// mapped to the empty scope are open to every key.
+func RequireScopes(mux *http.ServeMux, scopes map[string]auth.Scope) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c := callerFrom(r.Context())
+		// Unmatched requests fall through to the mux's 404 and 405.
+		if _, pattern := mux.Handler(r); c.APIKey && pattern != "" {
+			scope, ok := scopes[pattern]
+			if !ok {
+				writeError(w, r, http.StatusForbidden, CodeForbidden, "API keys cannot be used for this endpoint; sign in instead")
+				return
+			}
+			if scope != "" && !c.can(scope) {
+				writeProblem(w, r, NewProblem(http.StatusForbidden, CodeForbidden, "The API key lacks the "+string(scope)+" scope").
+					With("required_scope", scope))
+				return
+			}
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// callerFrom returns the caller set by Authenticate.
+func callerFrom(ctx context.Context) caller {
+	c, _ := ctx.Value(callerKey).(caller)
+	return c
+}
+
+// workspace is the ListOptions.Workspace for the caller of r: the workspace
+// they work in, or uuid.Nil for every workspace.
+func workspace(r *http.Request) uuid.UUID {
+	return callerFrom(r.Context()).WorkspaceID
+}
+
+// canAccess reports whether the caller of r may reach todo: whether it is in
+// the workspace they work in. What they may do with it is up to their
+// permissions and canChange.
+func canAccess(r *http.Request, todo models.Todo) bool {
+	return reachable(r, todo.WorkspaceID)
+}
+
+// canChange reports whether the caller of r may change todo, which
+// canAccess lets them see: members only change the todos they own, while
+// owners of the workspace and callers with auth.PermTodosAll change anyone's.
+func canChange(r *http.Request, todo models.Todo) bool {
+	c := callerFrom(r.Context())
+	if c.WorkspaceRole == models.WorkspaceOwner || c.allowed(auth.PermTodosAll) {
+		return true
+	}
+	return todo.OwnerID != nil && *todo.OwnerID == c.UserID
+}
+
+// reachable reports whether the caller of r may reach things in workspace
+// ws, nil meaning none.
+func reachable(r *http.Request, ws *uuid.UUID) bool {
+	c := callerFrom(r.Context())
+	if c.WorkspaceID == uuid.Nil {
+		return c.allowed(auth.PermTodosAll)
+	}
+	return ws != nil && *ws == c.WorkspaceID
+}
+
+// getTodo is store.GetTodo limited to the todos the caller of r may access;
+// other people's todos are reported as missing.
+func (s *Server) getTodo(r *http.Request, id uuid.UUID, vis store.Visibility) (models.Todo, error) {
+	todo, err := s.store.GetTodo(r.Context(), id, vis)
+	if err == nil && !canAccess(r, todo) {
+		return models.Todo{}, store.ErrNotFound
+	}
+	return todo, err
+}
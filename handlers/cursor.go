@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"todo-api/store"
+)
+
+// errInvalidCursor is returned for cursors that are malformed, forged, or
+// were issued for a different query.
+var errInvalidCursor = errors.New("invalid cursor")
+
+// cursorCodec turns store positions into opaque page tokens and back. Tokens
+// are signed so clients can't forge positions, and bound to the query they
+// were issued for so they can't be replayed against other filters.
+type cursorCodec struct {
+	key []byte
+}
+
+// cursorToken is the signed payload of a page token.
+type cursorToken struct {
+	Keys     []string `json:"k"`
+	ID       string   `json:"i"`
+	Backward bool     `json:"b,omitempty"`
+	Query    string   `json:"q"`
+}
+
+// newCursorCodec signs with secret, or with a random key when it is empty.
+func newCursorCodec(secret string) (*cursorCodec, error) {
+	key := []byte(secret)
+	if secret == "" {
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+	}
+	return &cursorCodec{key: key}, nil
+}
+
+// encode returns the token for the page after pos (before it when backward)
+// of the list described by query.
+func (c *cursorCodec) encode(pos store.Cursor, backward bool, query string) string {
+	payload, _ := json.Marshal(cursorToken{Keys: pos.Keys, ID: pos.ID, Backward: backward, Query: fingerprint(query)})
+	enc := base64.RawURLEncoding
+	return enc.EncodeToString(payload) + "." + enc.EncodeToString(c.sign(payload))
+}
+
+// decode verifies token and returns the keyset it selects.
+func (c *cursorCodec) decode(token, query string) (store.Keyset, error) {
+	enc := base64.RawURLEncoding
+	p, s, ok := strings.Cut(token, ".")
+	if !ok {
+		return store.Keyset{}, errInvalidCursor
+	}
+	payload, err := enc.DecodeString(p)
+	if err != nil {
+		return store.Keyset{}, errInvalidCursor
+	}
+	sig, err := enc.DecodeString(s)
+	if err != nil || !hmac.Equal(sig, c.sign(payload)) {
+		return store.Keyset{}, errInvalidCursor
+	}
+
+	var t cursorToken
+	if err := json.Unmarshal(payload, &t); err != nil || t.Query != fingerprint(query) {
+		return store.Keyset{}, errInvalidCursor
+	}
+	return store.Keyset{After: &store.Cursor{Keys: t.Keys, ID: t.ID}, Backward: t.Backward}, nil
+}
+
+func (c *cursorCodec) sign(payload []byte) []byte {
+	mac := hmac.New(sha256.New, c.key)
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
+
+// fingerprint shortens a query description for embedding in tokens.
+func fingerprint(query string) string {
+	sum := sha256.Sum256([]byte(query))
+	return base64.RawURLEncoding.EncodeToString(sum[:9])
+}
@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"reflect"
+	"strings"
+	"testing"
+	"todo-api/store"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	codec, err := newCursorCodec("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pos := store.Cursor{Keys: []string{"2026-01-02", "title"}, ID: "42"}
+	for _, backward := range []bool{false, true} {
+		token := codec.encode(pos, backward, "todos|pending")
+		keyset, err := codec.decode(token, "todos|pending")
+		if err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		if !reflect.DeepEqual(*keyset.After, pos) || keyset.Backward != backward {
+			t.Errorf("decode = %+v backward %v, want %+v backward %v", *keyset.After, keyset.Backward, pos, backward)
+		}
+	}
+}
+
+func TestCursorRejected(t *testing.T) {
+	codec, _ := newCursorCodec("secret")
+	other, _ := newCursorCodec("other secret")
+	random, _ := newCursorCodec("")
+	pos := store.Cursor{Keys: []string{"b"}, ID: "7"}
+	token := codec.encode(pos, false, "todos|pending")
+	payload, sig, _ := strings.Cut(token, ".")
+	enc := base64.RawURLEncoding
+
+	// forged swaps the position in the payload but keeps the signature
+	raw, _ := enc.DecodeString(payload)
+	forged := enc.EncodeToString([]byte(strings.Replace(string(raw), `"7"`, `"8"`, 1))) + "." + sig
+
+	tests := []struct {
+		name  string
+		codec *cursorCodec
+		token string
+		query string
+	}{
+		{name: "other query", codec: codec, token: token, query: "todos|done"},
+		{name: "other key", codec: other, token: token, query: "todos|pending"},
+		{name: "random key", codec: random, token: token, query: "todos|pending"},
+		{name: "forged payload", codec: codec, token: forged, query: "todos|pending"},
+		{name: "truncated signature", codec: codec, token: token[:len(token)-2], query: "todos|pending"},
+		{name: "no signature", codec: codec, token: payload, query: "todos|pending"},
+		{name: "not base64", codec: codec, token: "!!." + sig, query: "todos|pending"},
+		{name: "signed garbage", codec: codec, token: enc.EncodeToString([]byte("{")) + "." + enc.EncodeToString(codec.sign([]byte("{"))),
+			query: "todos|pending"},
+		{name: "empty", codec: codec, token: "", query: "todos|pending"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tt.codec.decode(tt.token, tt.query); err != errInvalidCursor {
+				t.Errorf("decode error = %v, want errInvalidCursor", err)
+			}
+		})
+	}
+}
+
+func TestTrimPage(t *testing.T) {
+	after := &store.Cursor{ID: "x"}
+	tests := []struct {
+		name             string
+		items            []int
+		keyset           store.Keyset
+		want             []int
+		hasNext, hasPrev bool
+	}{
+		{name: "first page, more", items: []int{1, 2, 3, 4}, want: []int{1, 2, 3}, hasNext: true},
+		{name: "first page, last", items: []int{1, 2}, want: []int{1, 2}},
+		{name: "first page, exactly full", items: []int{1, 2, 3}, want: []int{1, 2, 3}},
+		{name: "empty", items: nil, want: nil},
+		{name: "forward, more", items: []int{4, 5, 6, 7}, keyset: store.Keyset{After: after}, want: []int{4, 5, 6}, hasNext: true, hasPrev: true},
+		{name: "forward, last", items: []int{4, 5}, keyset: store.Keyset{After: after}, want: []int{4, 5}, hasPrev: true},
+		{name: "backward, more", items: []int{0, 1, 2, 3}, keyset: store.Keyset{After: after, Backward: true}, want: []int{1, 2, 3},
+			hasNext: true, hasPrev: true},
+		{name: "backward, first", items: []int{1, 2}, keyset: store.Keyset{After: after, Backward: true}, want: []int{1, 2}, hasNext: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page, hasNext, hasPrev := trimPage(tt.items, pageRequest{Limit: 3, Keyset: tt.keyset})
+			if !reflect.DeepEqual(page, tt.want) || hasNext != tt.hasNext || hasPrev != tt.hasPrev {
+				t.Errorf("trimPage = %v next %v prev %v, want %v next %v prev %v", page, hasNext, hasPrev, tt.want, tt.hasNext, tt.hasPrev)
+			}
+		})
+	}
+}
@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"todo-api/models"
+	"todo-api/store"
+)
+
+// Error codes returned in the "code" member of a Problem.
+const (
+	CodeBadRequest           = "bad_request"
+	CodeInvalidID            = "invalid_id"
+	CodeInvalidPayload       = "invalid_payload"
+	CodeInvalidCursor        = "invalid_cursor"
+	CodeInvalidFilter        = "invalid_filter"
+	CodeInvalidPatch         = "invalid_patch"
+	CodeValidation           = "validation_failed"
+	CodeUnauthorized         = "unauthorized"
+	CodeForbidden            = "forbidden"
+	CodeNoWorkspace          = "no_workspace"
+	CodeNotFound             = "not_found"
+	CodeGone                 = "gone"
+	CodeConflict             = "conflict"
+	CodeInvalidTransition    = "invalid_transition"
+	CodeMethodNotAllowed     = "method_not_allowed"
+	CodeUnsupportedMediaType = "unsupported_media_type"
+	CodePreconditionFailed   = "precondition_failed"
+	CodePreconditionRequired = "precondition_required"
+	CodeBadGateway           = "bad_gateway"
+	CodeInternal             = "internal_error"
+)
+
+// Problem is the error body every endpoint returns, following RFC 9457
+// (application/problem+json). Code is a stable machine-readable identifier;
+// Title and Detail are for humans.
+type Problem struct {
+	Type      string              `json:"type"`
+	Title     string              `json:"title"`
+	Status    int                 `json:"status"`
+	Detail    string              `json:"detail,omitempty"`
+	Instance  string              `json:"instance,omitempty"`
+	Code      string              `json:"code"`
+	RequestID string              `json:"request_id,omitempty"`
+	Errors    []models.FieldError `json:"errors,omitempty"`
+
+	// Extensions are extra members merged into the top-level object.
+	Extensions map[string]interface{} `json:"-"`
+}
+
+// MarshalJSON flattens Extensions into the problem object as RFC 9457 allows.
+func (p Problem) MarshalJSON() ([]byte, error) {
+	type plain Problem
+	body, err := json.Marshal(plain(p))
+	if err != nil || len(p.Extensions) == 0 {
+		return body, err
+	}
+
+	merged := map[string]interface{}{}
+	for k, v := range p.Extensions {
+		merged[k] = v
+	}
+	if err := json.Unmarshal(body, &merged); err != nil {
+		return nil, err
+	}
+	return json.Marshal(merged)
+}
+
+// NewProblem returns a Problem for status with the given code and detail.
+func NewProblem(status int, code, detail string) Problem {
+	return Problem{
+		Type:   "about:blank",
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+		Code:   code,
+	}
+}
+
+// With adds an extension member to the problem.
+func (p Problem) With(key string, value interface{}) Problem {
+	ext := make(map[string]interface{}, len(p.Extensions)+1)
+	for k, v := range p.Extensions {
+		ext[k] = v
+	}
+	ext[key] = value
+	p.Extensions = ext
+	return p
+}
+
+// writeProblem sends p, filling in the request ID and instance from r.
+func writeProblem(w http.ResponseWriter, r *http.Request, p Problem) {
+	if p.RequestID == "" {
+		p.RequestID = RequestIDFrom(r.Context())
+	}
+	if p.Instance == "" {
+		p.Instance = r.URL.Path
+	}
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(p.Status)
+	json.NewEncoder(w).Encode(p)
+}
+
+// writeError is shorthand for writeProblem(w, r, NewProblem(status, code, detail)).
+func writeError(w http.ResponseWriter, r *http.Request, status int, code, detail string) {
+	writeProblem(w, r, NewProblem(status, code, detail))
+}
+
+// writeStoreError maps an error returned by the store to a response. Unknown
+// errors are logged and reported as 500 without leaking their text.
+func writeStoreError(w http.ResponseWriter, r *http.Request, err error, detail string) {
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		writeError(w, r, http.StatusNotFound, CodeNotFound, detail)
+	case errors.Is(err, store.ErrDeleted):
+		writeError(w, r, http.StatusGone, CodeGone, "Todo has been deleted; restore it before changing it")
+	case errors.Is(err, store.ErrConflict):
+		writeError(w, r, http.StatusConflict, CodeConflict, detail)
+	case errors.Is(err, store.ErrInvalid):
+		writeError(w, r, http.StatusUnprocessableEntity, CodeValidation, err.Error())
+	default:
+		slog.Error(detail, "method", r.Method, "path", r.URL.Path, "err", err)
+		writeError(w, r, http.StatusInternalServerError, CodeInternal, detail)
+	}
+}
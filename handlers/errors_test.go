@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"todo-api/store"
+)
+
+func TestProblemJSON(t *testing.T) {
+	p := NewProblem(http.StatusConflict, CodeConflict, "Taken").With("field", "name").With("code", "overridden")
+	body, err := json.Marshal(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got map[string]interface{}
+	json.Unmarshal(body, &got)
+	want := map[string]interface{}{
+		"type": "about:blank", "title": "Conflict", "status": float64(409), "detail": "Taken",
+		"code": "conflict", "field": "name",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("problem = %s, want the members of %v", body, want)
+	}
+	if other := p.With("extra", true); len(p.Extensions) != 2 || len(other.Extensions) != 3 {
+		t.Error("With changed the problem it was called on")
+	}
+}
+
+func TestWriteStoreError(t *testing.T) {
+	tests := []struct {
+		err    error
+		status int
+		code   string
+		detail string
+	}{
+		{err: store.ErrNotFound, status: http.StatusNotFound, code: CodeNotFound, detail: "Todo not found"},
+		{err: fmt.Errorf("wrapped: %w", store.ErrNotFound), status: http.StatusNotFound, code: CodeNotFound, detail: "Todo not found"},
+		{err: store.ErrDeleted, status: http.StatusGone, code: CodeGone, detail: "Todo has been deleted; restore it before changing it"},
+		{err: store.ErrConflict, status: http.StatusConflict, code: CodeConflict, detail: "Todo not found"},
+		{err: fmt.Errorf("%w: bad sort", store.ErrInvalid), status: http.StatusUnprocessableEntity, code: CodeValidation, detail: "store: invalid input: bad sort"},
+		{err: errors.New("connection refused"), status: http.StatusInternalServerError, code: CodeInternal, detail: "Todo not found"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.err.Error(), func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			writeStoreError(rec, httptest.NewRequest("GET", "/todos/1", nil), tt.err, "Todo not found")
+			var p Problem
+			json.Unmarshal(rec.Body.Bytes(), &p)
+			if rec.Code != tt.status || p.Code != tt.code || p.Detail != tt.detail {
+				t.Errorf("response = %d %s %q, want %d %s %q", rec.Code, p.Code, p.Detail, tt.status, tt.code, tt.detail)
+			}
+			if ct := rec.Header().Get("Content-Type"); ct != "application/problem+json" {
+				t.Errorf("Content-Type = %q", ct)
+			}
+		})
+	}
+}
+
+func TestProblemErrors(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /text", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Write([]byte("fine"))
+	})
+	mux.HandleFunc("GET /own", func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, r, http.StatusTeapot, CodeBadRequest, "Own problem")
+	})
+	h := RequestID(ProblemErrors(mux))
+
+	tests := []struct {
+		method, path string
+		status       int
+		code         string
+	}{
+		{method: "GET", path: "/missing", status: http.StatusNotFound, code: CodeNotFound},
+		{method: "POST", path: "/text", status: http.StatusMethodNotAllowed, code: CodeMethodNotAllowed},
+		{method: "GET", path: "/own", status: http.StatusTeapot, code: CodeBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			req.Header.Set("X-Request-ID", "req-1")
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			var p Problem
+			if err := json.Unmarshal(rec.Body.Bytes(), &p); err != nil {
+				t.Fatalf("body %q is not a problem: %v", rec.Body, err)
+			}
+			if rec.Code != tt.status || p.Code != tt.code || p.RequestID != "req-1" || p.Instance != tt.path {
+				t.Errorf("problem = %d %+v, want status %d, code %s, request ID req-1 and instance %s", rec.Code, p, tt.status, tt.code, tt.path)
+			}
+			if ct := rec.Header().Get("Content-Type"); ct != "application/problem+json" {
+				t.Errorf("Content-Type = %q", ct)
+			}
+		})
+	}
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/text", nil))
+	if rec.Code != http.StatusOK || rec.Body.String() != "fine" || rec.Header().Get("X-Request-ID") == "" {
+		t.Errorf("plain-text success = %d %q, want it untouched with a request ID", rec.Code, rec.Body)
+	}
+	if !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/plain") {
+		t.Errorf("plain-text success Content-Type = %q", rec.Header().Get("Content-Type"))
+	}
+}
@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"todo-api/models"
+	"todo-api/store"
+
+	"github.com/google/uuid"
+)
+
+// etag is the entity tag of a todo: its version, which every write bumps.
+func etag(todo models.Todo) string {
+	return `"` + strconv.Itoa(todo.Version) + `"`
+}
+
+// matchesETag reports whether a comma-separated If-Match / If-None-Match
+// header value lists tag or is "*". Weak tags never match.
+func matchesETag(header, tag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || candidate == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// checkIfMatch enforces the If-Match precondition for writes to todo. It
+// writes 428 when the header is required but missing, 412 when it names a
+// different version, and reports whether the handler may continue.
+func (s *Server) checkIfMatch(w http.ResponseWriter, r *http.Request, todo models.Todo) bool {
+	header := r.Header.Get("If-Match")
+	if header == "" {
+		if s.cfg.API.RequireIfMatch {
+			writeError(w, r, http.StatusPreconditionRequired, CodePreconditionRequired,
+				"This request must include an If-Match header with the todo's current ETag")
+			return false
+		}
+		return true
+	}
+	if !matchesETag(header, etag(todo)) {
+		writeStale(w, r, todo)
+		return false
+	}
+	return true
+}
+
+// writeStale reports that the todo changed since the client (or this
+// request) read it: 412 if the client sent If-Match, otherwise 409.
+func writeStale(w http.ResponseWriter, r *http.Request, current models.Todo) {
+	status, code := http.StatusConflict, CodeConflict
+	if r.Header.Get("If-Match") != "" {
+		status, code = http.StatusPreconditionFailed, CodePreconditionFailed
+	}
+	p := NewProblem(status, code, "The todo has been modified since it was read; fetch it again and retry")
+	if current.Version > 0 {
+		w.Header().Set("ETag", etag(current))
+		p = p.With("current_version", current.Version)
+	}
+	writeProblem(w, r, p)
+}
+
+// writeStaleTodo answers a write that lost the race for todo id with its
+// current version, or with the error reading it back.
+func (s *Server) writeStaleTodo(w http.ResponseWriter, r *http.Request, id uuid.UUID) {
+	current, err := s.store.GetTodo(r.Context(), id, store.IncludeDeleted)
+	if err != nil {
+		writeStoreError(w, r, err, "Todo not found")
+		return
+	}
+	writeStale(w, r, current)
+}
@@ -0,0 +1,99 @@
+package handlers_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"todo-api/config"
+	"todo-api/models"
+	"todo-api/store"
+
+	"github.com/google/uuid"
+)
+
+func TestETags(t *testing.T) {
+	api := newTestAPI(t)
+	u := api.signUp("etag@example.com", "")
+	created := api.expect(api.do("POST", "/todos", u.Token, map[string]string{"title": "v1"}), http.StatusCreated)
+	path := "/todos/" + str(created.Body, "id")
+
+	get := api.expect(api.do("GET", path, u.Token, nil), http.StatusOK)
+	if etag := get.Header.Get("ETag"); etag != `"1"` {
+		t.Fatalf("ETag = %s, want \"1\"", etag)
+	}
+	api.expect(api.do("GET", path, u.Token, nil, "If-None-Match", `"1"`), http.StatusNotModified)
+	api.expect(api.do("GET", path, u.Token, nil, "If-None-Match", `"0"`), http.StatusOK)
+
+	res := api.expect(api.do("PATCH", path, u.Token, `{"title":"v2"}`, "If-Match", `"7", "1"`), http.StatusOK)
+	if etag := res.Header.Get("ETag"); etag != `"2"` {
+		t.Errorf("ETag after an update = %s, want \"2\"", etag)
+	}
+
+	// A client still holding version 1 is told about version 2
+	for _, method := range []string{"PATCH", "PUT", "DELETE"} {
+		res := api.expect(api.do(method, path, u.Token, `{"title":"lost update"}`, "If-Match", `"1"`), http.StatusPreconditionFailed)
+		if str(res.Body, "code") != "precondition_failed" || res.Body["current_version"] != float64(2) || res.Header.Get("ETag") != `"2"` {
+			t.Errorf("%s with a stale If-Match: %v %v, want precondition_failed at version 2", method, res.Header, res.Body)
+		}
+	}
+	if res := api.expect(api.do("GET", path, u.Token, nil), http.StatusOK); str(res.Body, "data", "title") != "v2" {
+		t.Errorf("title = %q after rejected writes, want v2", str(res.Body, "data", "title"))
+	}
+
+	api.expect(api.do("PATCH", path, u.Token, `{"title":"v3"}`, "If-Match", `W/"2"`), http.StatusPreconditionFailed)
+	api.expect(api.do("DELETE", path, u.Token, nil, "If-Match", "*"), http.StatusOK)
+}
+
+func TestRequireIfMatch(t *testing.T) {
+	api := newTestAPI(t, func(cfg *config.Config) { cfg.API.RequireIfMatch = true })
+	u := api.signUp("strict@example.com", "")
+	created := api.expect(api.do("POST", "/todos", u.Token, map[string]string{"title": "todo"}), http.StatusCreated)
+	path := "/todos/" + str(created.Body, "id")
+
+	for _, method := range []string{"PATCH", "PUT", "DELETE"} {
+		res := api.expect(api.do(method, path, u.Token, `{"title":"blind write"}`), http.StatusPreconditionRequired)
+		if str(res.Body, "code") != "precondition_required" {
+			t.Errorf("%s without If-Match: code %q, want precondition_required", method, str(res.Body, "code"))
+		}
+	}
+	api.expect(api.do("PATCH", path, u.Token, `{"title":"informed write"}`, "If-Match", `"1"`), http.StatusOK)
+}
+
+// lostRace is a store whose writes always lose to a concurrent one, after
+// which the todo can't be read back.
+type lostRace struct {
+	store.Store
+	raced bool
+}
+
+func (l *lostRace) Atomic(ctx context.Context, fn func(tx store.Store) error) error {
+	l.raced = true
+	return store.ErrStale
+}
+
+func (l *lostRace) GetTodo(ctx context.Context, id uuid.UUID, vis store.Visibility) (models.Todo, error) {
+	if l.raced {
+		return models.Todo{}, errors.New("connection reset")
+	}
+	return l.Store.GetTodo(ctx, id, vis)
+}
+
+// A write that lost the race reports the error reading the winner back
+// instead of a conflict without a version.
+func TestStaleWriteReadBackFails(t *testing.T) {
+	api := newTestAPI(t)
+	u := api.signUp("race@example.com", "")
+	created := api.expect(api.do("POST", "/todos", u.Token, map[string]string{"title": "contended"}), http.StatusCreated)
+	path := "/todos/" + str(created.Body, "id")
+
+	race := &lostRace{}
+	api.wrapStore(func(st store.Store) store.Store { race.Store = st; return race })
+	for _, method := range []string{"PATCH", "DELETE"} {
+		race.raced = false
+		res := api.expect(api.do(method, path, u.Token, `{"title":"lost update"}`), http.StatusInternalServerError)
+		if str(res.Body, "code") != "internal_error" || res.Header.Get("ETag") != "" {
+			t.Errorf("%s: %v %v, want internal_error without an ETag", method, res.Header, res.Body)
+		}
+	}
+}
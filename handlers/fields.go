@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"todo-api/models"
+	"todo-api/store"
+)
+
+// parseSort reads the sort order of a todo listing. The sort parameter takes
+// comma separated fields, each optionally prefixed with - for descending
+// order and suffixed with :nulls_first or :nulls_last, as in
+// sort=-due_date:nulls_last,title. Without it the older sort_by and
+// sort_order parameters apply, defaulting to created_at descending. On
+// failure the error response has been written and ok is false.
+func parseSort(w http.ResponseWriter, r *http.Request) (terms []store.SortTerm, ok bool) {
+	params := r.URL.Query()
+	src := params.Get("sort")
+	if src == "" {
+		sortBy := params.Get("sort_by")
+		if !store.SortFields[sortBy] {
+			sortBy = "created_at" // Default sort field
+		}
+		return []store.SortTerm{{Field: sortBy, Desc: params.Get("sort_order") != "ASC"}}, true
+	}
+
+	seen := map[string]bool{}
+	for _, part := range strings.Split(src, ",") {
+		// A + for ascending arrives as a space unless it was escaped.
+		part = strings.TrimSpace(part)
+		var term store.SortTerm
+		switch {
+		case strings.HasPrefix(part, "-"):
+			term.Desc = true
+			part = part[1:]
+		case strings.HasPrefix(part, "+"):
+			part = part[1:]
+		}
+		field, nulls, _ := strings.Cut(part, ":")
+		switch nulls {
+		case "":
+		case "nulls_first":
+			term.Nulls = store.NullsFirst
+		case "nulls_last":
+			term.Nulls = store.NullsLast
+		default:
+			writeError(w, r, http.StatusBadRequest, CodeBadRequest, "Invalid sort: null placement must be nulls_first or nulls_last")
+			return nil, false
+		}
+		if !store.SortFields[field] {
+			writeProblem(w, r, NewProblem(http.StatusBadRequest, CodeBadRequest, fmt.Sprintf("Invalid sort: cannot sort by %q", field)).
+				With("sortable_fields", sortedKeys(store.SortFields)))
+			return nil, false
+		}
+		if seen[field] {
+			writeError(w, r, http.StatusBadRequest, CodeBadRequest, fmt.Sprintf("Invalid sort: %q is listed twice", field))
+			return nil, false
+		}
+		seen[field] = true
+		term.Field = field
+		terms = append(terms, term)
+	}
+	return terms, true
+}
+
+// parseFields reads the fields parameter, a comma separated list of the
+// todo fields to return. On failure the error response has been written and
+// ok is false.
+func parseFields(w http.ResponseWriter, r *http.Request) (fields []string, ok bool) {
+	src := r.URL.Query().Get("fields")
+	if src == "" {
+		return nil, true
+	}
+	seen := map[string]bool{}
+	for _, field := range strings.Split(src, ",") {
+		field = strings.TrimSpace(field)
+		if !store.SelectFields[field] {
+			writeProblem(w, r, NewProblem(http.StatusBadRequest, CodeBadRequest, fmt.Sprintf("Invalid fields: unknown field %q", field)).
+				With("fields", sortedKeys(store.SelectFields)))
+			return nil, false
+		}
+		if !seen[field] {
+			seen[field] = true
+			fields = append(fields, field)
+		}
+	}
+	return fields, true
+}
+
+// project narrows each todo to fields, or returns todos unchanged when no
+// fields were asked for.
+func project(todos []models.Todo, fields []string) interface{} {
+	if len(fields) == 0 {
+		return todos
+	}
+	items := make([]map[string]json.RawMessage, 0, len(todos))
+	for _, todo := range todos {
+		var all map[string]json.RawMessage
+		b, _ := json.Marshal(todo)
+		json.Unmarshal(b, &all)
+
+		item := make(map[string]json.RawMessage, len(fields))
+		for _, f := range fields {
+			if v, ok := all[f]; ok {
+				item[f] = v
+			} else {
+				item[f] = json.RawMessage("null") // omitted when empty
+			}
+		}
+		items = append(items, item)
+	}
+	return items
+}
+
+// sortedKeys lists the names in set, for error messages.
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for k := range set {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
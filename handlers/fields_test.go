@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+	"todo-api/models"
+	"todo-api/store"
+)
+
+func TestParseSort(t *testing.T) {
+	tests := []struct {
+		query string
+		want  []store.SortTerm // nil when the sort is rejected
+	}{
+		{query: "", want: []store.SortTerm{{Field: "created_at", Desc: true}}},
+		{query: "sort_by=title&sort_order=ASC", want: []store.SortTerm{{Field: "title"}}},
+		{query: "sort_by=owner_id", want: []store.SortTerm{{Field: "created_at", Desc: true}}},
+		{query: "sort=title", want: []store.SortTerm{{Field: "title"}}},
+		{query: "sort=-due_date:nulls_last,+title", want: []store.SortTerm{{Field: "due_date", Desc: true, Nulls: store.NullsLast}, {Field: "title"}}},
+		{query: "sort=" + url.QueryEscape(" due_date:nulls_first , -id"),
+			want: []store.SortTerm{{Field: "due_date", Nulls: store.NullsFirst}, {Field: "id", Desc: true}}},
+		{query: "sort=status+", want: []store.SortTerm{{Field: "status"}}},
+		{query: "sort=owner_id"},
+		{query: "sort=title,-title"},
+		{query: "sort=due_date:nulls_middle"},
+		{query: "sort=title,"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			terms, ok := parseSort(rec, httptest.NewRequest("GET", "/todos?"+tt.query, nil))
+			if tt.want == nil {
+				if ok || rec.Code != http.StatusBadRequest {
+					t.Errorf("parseSort = %+v, %v (%d), want a 400", terms, ok, rec.Code)
+				}
+				return
+			}
+			if !ok || !reflect.DeepEqual(terms, tt.want) {
+				t.Errorf("parseSort = %+v, %v, want %+v", terms, ok, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseFields(t *testing.T) {
+	tests := []struct {
+		query string
+		want  []string
+		ok    bool
+	}{
+		{query: "", ok: true},
+		{query: "fields=title", want: []string{"title"}, ok: true},
+		{query: "fields=" + url.QueryEscape("title, status,title"), want: []string{"title", "status"}, ok: true},
+		{query: "fields=title,password_hash"},
+		{query: "fields=title,"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			fields, ok := parseFields(rec, httptest.NewRequest("GET", "/todos?"+tt.query, nil))
+			if ok != tt.ok || !reflect.DeepEqual(fields, tt.want) {
+				t.Errorf("parseFields = %v, %v, want %v, %v", fields, ok, tt.want, tt.ok)
+			}
+			if !ok && rec.Code != http.StatusBadRequest {
+				t.Errorf("status = %d, want 400", rec.Code)
+			}
+		})
+	}
+}
+
+func TestProject(t *testing.T) {
+	todos := []models.Todo{{Title: "a", Status: "done"}}
+	if got := project(todos, nil); !reflect.DeepEqual(got, todos) {
+		t.Errorf("project without fields = %v, want the todos unchanged", got)
+	}
+	b, _ := json.Marshal(project(todos, []string{"status", "deleted_at", "title"}))
+	if string(b) != `[{"deleted_at":null,"status":"done","title":"a"}]` {
+		t.Errorf("project = %s", b)
+	}
+}
@@ -0,0 +1,178 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"todo-api/auth"
+	"todo-api/models"
+)
+
+// listMediaType is the media type of a models.TodoList.
+const listMediaType = "application/vnd.todo-api.list+json"
+
+// legacyMediaType asks GET /todos for the route's original response, which
+// clients can opt into while they migrate to the models.TodoList.
+const legacyMediaType = "application/vnd.todo-api.legacy+json"
+
+// GetTodos serves GET /todos: a models.TodoList, or the original response
+// for clients that accept legacyMediaType. That lists up to the max page
+// size of matches, with a next_cursor for the rest. Either way an empty
+// list is a 200, not a 404.
+func (s *Server) GetTodos(w http.ResponseWriter, r *http.Request) {
+	if !s.authorize(w, r, auth.PermTodosRead) {
+		return
+	}
+	w.Header().Add("Vary", "Accept")
+	if !strings.Contains(r.Header.Get("Accept"), legacyMediaType) {
+		s.writeTodoList(w, r)
+		return
+	}
+
+	list, fields, ok := s.todoList(w, r, true)
+	if !ok {
+		return
+	}
+	response := map[string]interface{}{
+		"status":        "200 OK",
+		"todos":         project(list.Items, fields),
+		"total_todos":   *list.TotalItems,
+		"server_status": "OK",
+	}
+	if list.Page.NextCursor != "" {
+		response["next_cursor"] = list.Page.NextCursor
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// GetTodosWithFilterSortPagination serves the deprecated /todoss route with
+// the list in that route's original response shape.
+func (s *Server) GetTodosWithFilterSortPagination(w http.ResponseWriter, r *http.Request) {
+	if !s.authorize(w, r, auth.PermTodosRead) {
+		return
+	}
+	list, fields, ok := s.todoList(w, r, false)
+	if !ok {
+		return
+	}
+
+	response := map[string]interface{}{
+		"status": 200,
+		"todos":  project(list.Items, fields),
+	}
+	if list.Page.Number > 0 {
+		response["current_page"] = list.Page.Number
+		response["total_pages"] = *list.Page.TotalPages
+		response["total_todos"] = *list.TotalItems
+	} else {
+		response["page_size"] = list.Page.Size
+		if list.Page.NextCursor != "" {
+			response["next_cursor"] = list.Page.NextCursor
+		}
+		if list.Page.PrevCursor != "" {
+			response["prev_cursor"] = list.Page.PrevCursor
+		}
+		if len(list.Items) > 0 {
+			response["links"] = list.Page.Links
+		}
+		if list.TotalItems != nil {
+			response["total_todos"] = *list.TotalItems
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// writeTodoList responds with the models.TodoList for r, narrowed to the
+// requested fields.
+func (s *Server) writeTodoList(w http.ResponseWriter, r *http.Request) {
+	list, fields, ok := s.todoList(w, r, false)
+	if !ok {
+		return
+	}
+	response := struct {
+		Items interface{} `json:"items"`
+		models.TodoList
+	}{project(list.Items, fields), list}
+
+	w.Header().Set("Content-Type", listMediaType)
+	json.NewEncoder(w).Encode(response)
+}
+
+// todoList runs the todo list query of r: the filters, sort order and
+// fields, and a page picked by cursor, or by number when page is given.
+// original is set for the original GET /todos response, which used to list
+// every match: its pages default to the max page size and always count the
+// matches. On failure the error response has been written and ok is false.
+func (s *Server) todoList(w http.ResponseWriter, r *http.Request, original bool) (list models.TodoList, fields []string, ok bool) {
+	params := r.URL.Query()
+
+	opts, ok := s.listFilters(w, r)
+	if !ok {
+		return list, nil, false
+	}
+	if opts.Sort, ok = parseSort(w, r); !ok {
+		return list, nil, false
+	}
+	if opts.Fields, ok = parseFields(w, r); !ok {
+		return list, nil, false
+	}
+	list.Items = []models.Todo{} // encodes as [] when nothing matches
+	pageSize := defaultPageSize
+	if original {
+		pageSize = s.cfg.API.MaxPageSize
+	}
+
+	switch {
+	case params.Get("page") != "":
+		page, err := strconv.Atoi(params.Get("page"))
+		if err != nil || page < 1 {
+			page = 1 // Default page = 1
+		}
+		limit := s.pageLimit(r, pageSize)
+		opts.Limit = limit
+		opts.Offset = (page - 1) * limit
+
+		todos, total, err := s.store.ListTodos(r.Context(), opts)
+		if err != nil {
+			writeStoreError(w, r, err, "Unable to fetch todos")
+			return list, nil, false
+		}
+		list.Items = append(list.Items, todos...)
+		totalPages := (total + limit - 1) / limit
+		list.Page.Size, list.Page.Number, list.Page.TotalPages = limit, page, &totalPages
+		list.TotalItems = &total
+
+	default:
+		query := fmt.Sprintf("todos|%s|%v|%d|%v|%s|%s|%t", opts.Status, opts.DueDate, opts.Deleted, opts.Sort, params.Get("filter"),
+			opts.Project, opts.Archived)
+		req, ok := s.parsePage(w, r, query, pageSize)
+		if !ok {
+			return list, nil, false
+		}
+		req.IncludeTotal = req.IncludeTotal || original
+		opts.Limit = req.Limit + 1 // one extra tells whether there is a next page
+		opts.Page = req.Keyset
+		opts.SkipCount = !req.IncludeTotal
+
+		todos, total, err := s.store.ListTodos(r.Context(), opts)
+		if err != nil {
+			writeStoreError(w, r, err, "Unable to fetch todos")
+			return list, nil, false
+		}
+		todos, hasNext, hasPrev := trimPage(todos, req)
+		list.Items = append(list.Items, todos...)
+		list.Page.Size = req.Limit
+		if len(todos) > 0 {
+			list.Page.NextCursor, list.Page.PrevCursor, list.Page.Links = s.pageLinks(w, r, req,
+				opts.Cursor(todos[0]), opts.Cursor(todos[len(todos)-1]), hasNext, hasPrev)
+		}
+		if req.IncludeTotal {
+			list.TotalItems = &total
+		}
+	}
+	return list, opts.Fields, true
+}
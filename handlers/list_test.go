@@ -0,0 +1,193 @@
+package handlers_test
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// legacyMediaType asks GET /todos for its original response.
+const legacyMediaType = "application/vnd.todo-api.legacy+json"
+
+// list fetches a page of the todo list and returns the titles on it and
+// its page info.
+func (a *testAPI) list(token, path string) (titles []string, page map[string]interface{}) {
+	a.t.Helper()
+	res := a.expect(a.do("GET", path, token, nil), http.StatusOK)
+	for _, item := range items(res.Body, "items") {
+		titles = append(titles, str(item, "title"))
+	}
+	page, _ = res.Body["page"].(map[string]interface{})
+	return titles, page
+}
+
+func TestCursorPagination(t *testing.T) {
+	api := newTestAPI(t)
+	u := api.signUp("pages@example.com", "")
+	for _, title := range []string{"e", "c", "a", "d", "b"} {
+		api.expect(api.do("POST", "/todos", u.Token, map[string]string{"title": title}), http.StatusCreated)
+	}
+
+	// Walk forward by next links, then back by prev links
+	var pages []string
+	path := "/todos?sort=title&limit=2"
+	for path != "" {
+		titles, page := api.list(u.Token, path)
+		pages = append(pages, strings.Join(titles, ""))
+		path = str(page, "links", "next")
+	}
+	if got := strings.Join(pages, "|"); got != "ab|cd|e" {
+		t.Fatalf("forward pages = %s, want ab|cd|e", got)
+	}
+
+	_, page := api.list(u.Token, "/todos?sort=title&limit=2")
+	_, page = api.list(u.Token, str(page, "links", "next"))
+	titles, page := api.list(u.Token, str(page, "links", "next"))
+	if strings.Join(titles, "") != "e" || str(page, "links", "next") != "" {
+		t.Fatalf("last page = %v %v", titles, page)
+	}
+	titles, page = api.list(u.Token, str(page, "links", "prev"))
+	if strings.Join(titles, "") != "cd" {
+		t.Errorf("page before the last = %v, want c d", titles)
+	}
+	titles, page = api.list(u.Token, str(page, "links", "prev"))
+	if strings.Join(titles, "") != "ab" || str(page, "links", "prev") != "" {
+		t.Errorf("first page going back = %v %v, want a b and no prev link", titles, page)
+	}
+
+	// Cursors only work for the query they were issued for
+	_, page = api.list(u.Token, "/todos?sort=title&limit=2")
+	cursor := url.QueryEscape(str(page, "next_cursor"))
+	for _, path := range []string{
+		"/todos?sort=-title&limit=2&cursor=" + cursor,
+		"/todos?sort=title&status=done&limit=2&cursor=" + cursor,
+		"/todos?sort=title&limit=2&cursor=" + cursor + "x",
+	} {
+		res := api.expect(api.do("GET", path, u.Token, nil), http.StatusBadRequest)
+		if str(res.Body, "code") != "invalid_cursor" {
+			t.Errorf("GET %s: code %q, want invalid_cursor", path, str(res.Body, "code"))
+		}
+	}
+	// but the page size may change
+	if titles, _ := api.list(u.Token, "/todos?sort=title&limit=3&cursor="+cursor); strings.Join(titles, "") != "cde" {
+		t.Errorf("next page with a larger limit = %v, want c d e", titles)
+	}
+}
+
+func TestListFilter(t *testing.T) {
+	api := newTestAPI(t)
+	u := api.signUp("filter@example.com", "")
+	for _, todo := range []map[string]string{
+		{"title": "Buy milk", "due_date": "2099-01-01"},
+		{"title": "Buy bread"},
+		{"title": "Walk the dog", "status": "in_progress"},
+	} {
+		api.expect(api.do("POST", "/todos", u.Token, todo), http.StatusCreated)
+	}
+
+	tests := []struct {
+		filter string
+		want   string
+	}{
+		{filter: "title ~ buy", want: "Buy bread,Buy milk"},
+		{filter: "title ~ buy and due_date is null", want: "Buy bread"},
+		{filter: "not status = pending or due_date > 2098-12-31", want: "Buy milk,Walk the dog"},
+		{filter: `title in ("Walk the dog", "Swim")`, want: "Walk the dog"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.filter, func(t *testing.T) {
+			titles, _ := api.list(u.Token, "/todos?sort=title&filter="+url.QueryEscape(tt.filter))
+			if got := strings.Join(titles, ","); got != tt.want {
+				t.Errorf("titles = %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	res := api.expect(api.do("GET", "/todos?filter="+url.QueryEscape("status = done and"), u.Token, nil), http.StatusBadRequest)
+	if str(res.Body, "code") != "invalid_filter" || res.Body["position"] != float64(17) {
+		t.Errorf("invalid filter: body %v, want code invalid_filter at position 17", res.Body)
+	}
+}
+
+func TestListFields(t *testing.T) {
+	api := newTestAPI(t)
+	u := api.signUp("fields@example.com", "")
+	api.expect(api.do("POST", "/todos", u.Token, map[string]string{"title": "sparse", "description": "left out"}), http.StatusCreated)
+
+	res := api.expect(api.do("GET", "/todos?fields=title,status", u.Token, nil), http.StatusOK)
+	list := items(res.Body, "items")
+	if len(list) != 1 || len(list[0]) != 2 || str(list[0], "title") != "sparse" || str(list[0], "status") != "pending" {
+		t.Errorf("items = %v, want only the title and status", list)
+	}
+	res = api.expect(api.do("GET", "/todos?fields=title,owner_password", u.Token, nil), http.StatusBadRequest)
+	if fields, _ := res.Body["fields"].([]interface{}); len(fields) == 0 {
+		t.Errorf("unknown field: %v, want the selectable fields listed", res.Body)
+	}
+}
+
+func TestListResponseShapes(t *testing.T) {
+	api := newTestAPI(t)
+	u := api.signUp("shapes@example.com", "")
+
+	// An empty list is a 200 in every shape
+	res := api.expect(api.do("GET", "/todos", u.Token, nil), http.StatusOK)
+	if todos, ok := res.Body["items"].([]interface{}); !ok || len(todos) != 0 || !strings.Contains(res.Header.Get("Vary"), "Accept") ||
+		res.Header.Get("Content-Type") != "application/vnd.todo-api.list+json" {
+		t.Errorf("empty GET /todos = %v %v, want an empty list and Vary: Accept", res.Header, res.Body)
+	}
+	res = api.expect(api.do("GET", "/todos", u.Token, nil, "Accept", legacyMediaType), http.StatusOK)
+	if todos, ok := res.Body["todos"].([]interface{}); !ok || len(todos) != 0 {
+		t.Errorf("empty original GET /todos = %v, want an empty todos array", res.Body)
+	}
+	for _, title := range []string{"a", "b", "c"} {
+		api.expect(api.do("POST", "/todos", u.Token, map[string]string{"title": title}), http.StatusCreated)
+	}
+
+	tests := []struct {
+		name, path, accept string
+		keys               []string
+	}{
+		{name: "original GET /todos", path: "/todos", accept: legacyMediaType, keys: []string{"status", "todos", "total_todos", "server_status"}},
+		{name: "original GET /todos page", path: "/todos?limit=1", accept: legacyMediaType, keys: []string{"status", "todos", "total_todos", "server_status", "next_cursor"}},
+		{name: "list", path: "/todos?limit=2", keys: []string{"items", "page"}},
+		{name: "numbered list", path: "/todos?page=2&limit=2", keys: []string{"items", "page", "total_items"}},
+		{name: "legacy numbered", path: "/todoss?page=1&limit=2", keys: []string{"status", "todos", "current_page", "total_pages", "total_todos"}},
+		{name: "legacy cursor", path: "/todoss?limit=2", keys: []string{"status", "todos", "page_size", "next_cursor", "links"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := api.expect(api.do("GET", tt.path, u.Token, nil, "Accept", tt.accept), http.StatusOK)
+			var keys []string
+			for k := range res.Body {
+				keys = append(keys, k)
+			}
+			if len(keys) != len(tt.keys) {
+				t.Errorf("members = %v, want %v", keys, tt.keys)
+			}
+			for _, k := range tt.keys {
+				if _, ok := res.Body[k]; !ok {
+					t.Errorf("no %q member in %v", k, res.Body)
+				}
+			}
+		})
+	}
+
+	// The original response lists up to the max page size, and counts every
+	// match
+	api.cfg.API.MaxPageSize = 2
+	api.serve(api.store)
+	res = api.expect(api.do("GET", "/todos", u.Token, nil, "Accept", legacyMediaType), http.StatusOK)
+	if len(items(res.Body, "todos")) != 2 || res.Body["total_todos"] != float64(3) || str(res.Body, "next_cursor") == "" {
+		t.Errorf("original GET /todos = %v, want two of three todos and a cursor", res.Body)
+	}
+	res = api.expect(api.do("GET", "/todos?cursor="+url.QueryEscape(str(res.Body, "next_cursor")), u.Token, nil, "Accept", legacyMediaType), http.StatusOK)
+	if len(items(res.Body, "todos")) != 1 || res.Body["next_cursor"] != nil {
+		t.Errorf("next page = %v, want the last todo", res.Body)
+	}
+	res = api.expect(api.do("GET", "/todos?page=2&limit=2", u.Token, nil), http.StatusOK)
+	if page, _ := res.Body["page"].(map[string]interface{}); page["number"] != float64(2) || page["total_pages"] != float64(2) ||
+		len(items(res.Body, "items")) != 1 {
+		t.Errorf("page 2 = %v, want the last todo of two pages", res.Body)
+	}
+}
@@ -0,0 +1,88 @@
+package handlers_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"todo-api/models"
+	"todo-api/store"
+
+	"github.com/google/uuid"
+)
+
+// mutationLogs returns the actions logged for a todo by writes to it,
+// oldest first, and their changes.
+func (a *testAPI) mutationLogs(id string) ([]string, []map[string]models.Change) {
+	a.t.Helper()
+	todoID := uuid.MustParse(id)
+	logs, _, err := a.store.ListLogs(context.Background(), store.LogListOptions{TodoID: &todoID})
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	var actions []string
+	var changes []map[string]models.Change
+	for i := len(logs) - 1; i >= 0; i-- {
+		if logs[i].Action == "fetch" {
+			continue
+		}
+		actions = append(actions, logs[i].Action)
+		changes = append(changes, logs[i].Changes)
+	}
+	return actions, changes
+}
+
+func TestWritesAreLogged(t *testing.T) {
+	api := newTestAPI(t)
+	u := api.signUp("audit@example.com", "")
+	id := str(api.expect(api.do("POST", "/todos", u.Token, map[string]string{"title": "draft"}), http.StatusCreated).Body, "id")
+	api.expect(api.do("PATCH", "/todos/"+id, u.Token, `{"title":"final"}`), http.StatusOK)
+	api.expect(api.do("DELETE", "/todos/"+id, u.Token, nil), http.StatusOK)
+
+	actions, changes := api.mutationLogs(id)
+	if strings.Join(actions, ",") != "create,update,delete" {
+		t.Fatalf("logged actions = %v, want create, update and delete", actions)
+	}
+	if c := changes[0]["title"]; c.Before != nil || c.After != "draft" {
+		t.Errorf("create changes = %v, want the title set", changes[0])
+	}
+	if c := changes[1]["title"]; c.Before != "draft" || c.After != "final" || len(changes[1]) != 1 {
+		t.Errorf("update changes = %v, want only the title from draft to final", changes[1])
+	}
+	if c := changes[2]["is_deleted"]; c.Before != false || c.After != true {
+		t.Errorf("delete changes = %v, want is_deleted from false to true", changes[2])
+	}
+}
+
+// failingLogs is a store that can't write log entries inside transactions.
+type failingLogs struct{ store.Store }
+
+func (f failingLogs) Atomic(ctx context.Context, fn func(tx store.Store) error) error {
+	return f.Store.Atomic(ctx, func(tx store.Store) error { return fn(failingLogs{tx}) })
+}
+
+func (f failingLogs) AddLog(ctx context.Context, entry models.LogEntry) error {
+	return errors.New("logs table is full")
+}
+
+// A write whose log entry can't be recorded doesn't happen either.
+func TestWritesRollBackWithoutTheirLog(t *testing.T) {
+	api := newTestAPI(t)
+	u := api.signUp("rollback@example.com", "")
+	id := str(api.expect(api.do("POST", "/todos", u.Token, map[string]string{"title": "kept"}), http.StatusCreated).Body, "id")
+	path := "/todos/" + id
+	api.wrapStore(func(st store.Store) store.Store { return failingLogs{st} })
+
+	api.expect(api.do("POST", "/todos", u.Token, map[string]string{"title": "lost"}), http.StatusInternalServerError)
+	api.expect(api.do("PATCH", path, u.Token, `{"title":"changed"}`), http.StatusInternalServerError)
+	api.expect(api.do("DELETE", path, u.Token, nil), http.StatusInternalServerError)
+
+	todos, _, _ := api.store.ListTodos(context.Background(), store.ListOptions{Deleted: store.IncludeDeleted})
+	if len(todos) != 1 || todos[0].Title != "kept" || todos[0].IsDeleted || todos[0].Version != 1 {
+		t.Errorf("todos = %+v, want only the untouched first todo", todos)
+	}
+	if actions, _ := api.mutationLogs(id); len(actions) != 1 {
+		t.Errorf("logged actions = %v, want only the create", actions)
+	}
+}
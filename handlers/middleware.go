@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+type contextKey int
+
+const (
+	requestIDKey contextKey = iota
+	callerKey
+)
+
+// RequestID tags every request with an ID, taken from the incoming
+// X-Request-ID header when present, and echoes it in the response.
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-ID")
+		if id == "" || len(id) > 128 {
+			id = uuid.NewString()
+		}
+		w.Header().Set("X-Request-ID", id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey, id)))
+	})
+}
+
+// RequestIDFrom returns the ID assigned by RequestID, if any.
+func RequestIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+// ProblemErrors turns the plain-text errors produced outside the handlers
+// (such as the mux's 404 and 405 responses) into problem+json bodies.
+func ProblemErrors(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(&problemWriter{ResponseWriter: w, r: r}, r)
+	})
+}
+
+type problemWriter struct {
+	http.ResponseWriter
+	r           *http.Request
+	wroteHeader bool
+	swallow     bool
+}
+
+func (pw *problemWriter) WriteHeader(status int) {
+	if pw.wroteHeader {
+		return
+	}
+	pw.wroteHeader = true
+
+	h := pw.Header()
+	if status < 400 || !strings.HasPrefix(h.Get("Content-Type"), "text/plain") {
+		pw.ResponseWriter.WriteHeader(status)
+		return
+	}
+
+	code := CodeBadRequest
+	switch status {
+	case http.StatusNotFound:
+		code = CodeNotFound
+	case http.StatusMethodNotAllowed:
+		code = CodeMethodNotAllowed
+	case http.StatusInternalServerError:
+		code = CodeInternal
+	}
+	// The plain-text body that follows is replaced by the problem.
+	pw.swallow = true
+	h.Del("Content-Length")
+	h.Del("X-Content-Type-Options")
+	writeProblem(pw.ResponseWriter, pw.r, NewProblem(status, code, http.StatusText(status)))
+}
+
+func (pw *problemWriter) Write(b []byte) (int, error) {
+	if !pw.wroteHeader {
+		pw.WriteHeader(http.StatusOK)
+	}
+	if pw.swallow {
+		return len(b), nil
+	}
+	return pw.ResponseWriter.Write(b)
+}
+
+func (pw *problemWriter) Unwrap() http.ResponseWriter {
+	return pw.ResponseWriter
+}
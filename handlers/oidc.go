@@ -0,0 +1,259 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+	"todo-api/auth"
+	"todo-api/models"
+	"todo-api/oidc"
+	"todo-api/store"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// providerTimeout bounds each request to the OpenID Connect provider.
+	providerTimeout = 10 * time.Second
+	// oidcLoginTTL is how long a user has to sign in at the provider.
+	oidcLoginTTL = 10 * time.Minute
+	// oidcCookie carries the state of a sign-in from /auth/oidc/login to
+	// the callback, sealed so the client can't change it.
+	oidcCookie = "oidc_login"
+)
+
+// oidcLogin is the state of a sign-in in progress.
+type oidcLogin struct {
+	State     string `json:"state"`
+	Nonce     string `json:"nonce"`
+	Verifier  string `json:"verifier"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+// OIDCLogin starts signing in with the OpenID Connect provider: it
+// redirects to the provider, which redirects back to OIDCCallback.
+func (s *Server) OIDCLogin(w http.ResponseWriter, r *http.Request) {
+	if !s.oidcEnabled(w, r) {
+		return
+	}
+	var login oidcLogin
+	for _, v := range []*string{&login.State, &login.Nonce, &login.Verifier} {
+		var err error
+		if *v, err = oidc.NewVerifier(); err != nil {
+			writeStoreError(w, r, err, "Failed to start sign-in")
+			return
+		}
+	}
+	login.ExpiresAt = time.Now().Add(oidcLoginTTL).Unix()
+
+	target, err := s.provider.AuthCodeURL(r.Context(), login.State, login.Nonce, login.Verifier)
+	if err != nil {
+		s.providerError(w, r, err)
+		return
+	}
+	payload, _ := json.Marshal(login)
+	s.setLoginCookie(w, s.tokens.Seal(oidcCookie, payload), int(oidcLoginTTL.Seconds()))
+	http.Redirect(w, r, target, http.StatusFound)
+}
+
+// OIDCCallback finishes signing in: it exchanges the code the provider
+// redirected back with for the user's identity, finds or creates their
+// account and returns tokens as Login does.
+func (s *Server) OIDCCallback(w http.ResponseWriter, r *http.Request) {
+	if !s.oidcEnabled(w, r) {
+		return
+	}
+	login, ok := s.loginState(w, r)
+	if !ok {
+		return
+	}
+	q := r.URL.Query()
+	if e := q.Get("error"); e != "" {
+		writeProblem(w, r, NewProblem(http.StatusUnauthorized, CodeUnauthorized, "The identity provider did not sign you in").
+			With("provider_error", e).With("provider_error_description", q.Get("error_description")))
+		return
+	}
+
+	claims, err := s.provider.Exchange(r.Context(), q.Get("code"), login.Verifier, login.Nonce)
+	if errors.Is(err, oidc.ErrRejected) || errors.Is(err, oidc.ErrInvalidToken) {
+		writeError(w, r, http.StatusUnauthorized, CodeUnauthorized, "The identity provider's response is invalid or expired; sign in again")
+		return
+	}
+	if err != nil {
+		s.providerError(w, r, err)
+		return
+	}
+
+	user, ok := s.oidcUser(w, r, claims)
+	if !ok {
+		return
+	}
+	tokens, err := s.issueTokens(r, s.store, user, uuid.New())
+	if err != nil {
+		writeStoreError(w, r, err, "Failed to sign in")
+		return
+	}
+	tokens.User = &user
+	writeTokens(w, http.StatusOK, tokens)
+}
+
+// oidcEnabled writes 404 unless sign-in through OIDC is configured.
+func (s *Server) oidcEnabled(w http.ResponseWriter, r *http.Request) bool {
+	if s.provider == nil {
+		writeError(w, r, http.StatusNotFound, CodeNotFound, "Sign-in with an identity provider is not configured")
+		return false
+	}
+	return true
+}
+
+// loginState reads the sign-in state from its cookie, which it clears, and
+// checks that the callback belongs to it.
+func (s *Server) loginState(w http.ResponseWriter, r *http.Request) (oidcLogin, bool) {
+	var login oidcLogin
+	cookie, err := r.Cookie(oidcCookie)
+	if err == nil {
+		s.setLoginCookie(w, "", -1)
+		var payload []byte
+		if payload, err = s.tokens.Open(oidcCookie, cookie.Value); err == nil {
+			err = json.Unmarshal(payload, &login)
+		}
+	}
+	if err != nil || time.Now().Unix() >= login.ExpiresAt || r.URL.Query().Get("state") != login.State {
+		writeError(w, r, http.StatusBadRequest, CodeBadRequest, "Sign-in expired or was started elsewhere; start again at /auth/oidc/login")
+		return login, false
+	}
+	return login, true
+}
+
+// setLoginCookie sets the sign-in state cookie, or clears it when maxAge
+// is negative. It only goes back to the callback.
+func (s *Server) setLoginCookie(w http.ResponseWriter, value string, maxAge int) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcCookie,
+		Value:    value,
+		Path:     "/auth/oidc",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(s.cfg.Auth.OIDC.RedirectURL, "https:"),
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+func (s *Server) providerError(w http.ResponseWriter, r *http.Request, err error) {
+	slog.Error("Identity provider failed", "method", r.Method, "path", r.URL.Path, "err", err)
+	writeError(w, r, http.StatusBadGateway, CodeBadGateway, "The identity provider is unavailable")
+}
+
+// oidcUser returns the account of the user the provider signed in. Users
+// are found by their identity at the provider; on their first sign-in an
+// account with the same, verified, email is linked to it, or else a new
+// account is created.
+func (s *Server) oidcUser(w http.ResponseWriter, r *http.Request, claims oidc.Claims) (models.User, bool) {
+	ctx := r.Context()
+	role, mapped := s.oidcRole(claims)
+
+	user, err := s.store.GetUserByOIDC(ctx, claims.Issuer, claims.Subject)
+	if errors.Is(err, store.ErrNotFound) {
+		email := normalizeEmail(claims.Email)
+		if email == "" {
+			writeError(w, r, http.StatusUnauthorized, CodeUnauthorized, "The identity provider did not share your email address")
+			return user, false
+		}
+		user, err = s.store.GetUserByEmail(ctx, email)
+		switch {
+		case err == nil && !claims.EmailVerified:
+			writeError(w, r, http.StatusConflict, CodeConflict,
+				"An account with this email already exists, and the identity provider has not verified the email")
+			return user, false
+		case err == nil:
+			err = s.store.LinkOIDC(ctx, user.ID, claims.Issuer, claims.Subject)
+			if errors.Is(err, store.ErrConflict) {
+				writeError(w, r, http.StatusConflict, CodeConflict, "The account with this email is linked to another identity")
+				return user, false
+			}
+		case errors.Is(err, store.ErrNotFound):
+			return s.provisionUser(w, r, claims, email, role)
+		}
+	}
+	if err != nil {
+		writeStoreError(w, r, err, "Failed to sign in")
+		return user, false
+	}
+
+	if mapped && user.Role != string(role) {
+		if err := s.store.SetUserRole(ctx, user.ID, string(role)); err != nil {
+			writeStoreError(w, r, err, "Failed to sign in")
+			return user, false
+		}
+		user.Role = string(role)
+	}
+	return user, true
+}
+
+// provisionUser creates the account of a user signing in for the first
+// time, with a personal workspace as Register gives.
+func (s *Server) provisionUser(w http.ResponseWriter, r *http.Request, claims oidc.Claims, email string, role auth.Role) (models.User, bool) {
+	user := models.User{
+		ID:          uuid.New(),
+		Email:       email,
+		Role:        string(role),
+		OIDCIssuer:  claims.Issuer,
+		OIDCSubject: claims.Subject,
+	}
+	err := s.store.Atomic(r.Context(), func(tx store.Store) error {
+		if err := tx.CreateUser(r.Context(), &user); err != nil {
+			return err
+		}
+		_, err := createPersonalWorkspace(r.Context(), tx, user.ID)
+		return err
+	})
+	if err != nil {
+		// ErrConflict: the same user signing in twice at once.
+		writeStoreError(w, r, err, "Failed to create account; sign in again")
+		return user, false
+	}
+	return user, true
+}
+
+// parseOIDCRoles converts auth.oidc.roles, which maps role claim values to
+// role names.
+func parseOIDCRoles(names map[string]string) (map[string]auth.Role, error) {
+	roles := make(map[string]auth.Role, len(names))
+	for value, name := range names {
+		role, err := auth.ParseRole(name)
+		if err != nil {
+			return nil, fmt.Errorf("auth.oidc.roles: %q maps to unknown role %q", value, name)
+		}
+		roles[value] = role
+	}
+	return roles, nil
+}
+
+// oidcRole maps the role claim to a role: the highest one any of its values
+// maps to, or the default role. mapped is false when no mapping is
+// configured, in which case roles are left to the API's admins.
+func (s *Server) oidcRole(claims oidc.Claims) (role auth.Role, mapped bool) {
+	if len(s.oidcRoles) == 0 {
+		return auth.DefaultRole, false
+	}
+	rank := -1
+	for _, v := range claims.Values(s.cfg.Auth.OIDC.RoleClaim) {
+		mappedRole, ok := s.oidcRoles[v]
+		if !ok {
+			continue
+		}
+		for i, r := range auth.Roles {
+			if r == mappedRole && i > rank {
+				rank = i
+			}
+		}
+	}
+	if rank < 0 {
+		return auth.DefaultRole, true
+	}
+	return auth.Roles[rank], true
+}
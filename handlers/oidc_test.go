@@ -0,0 +1,281 @@
+package handlers_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+	"todo-api/config"
+	"todo-api/oidc/oidctest"
+)
+
+const redirectURL = "http://api.example.com/auth/oidc/callback"
+
+// invalidResponse is the detail of the 401 for codes and ID tokens the API
+// refuses.
+const invalidResponse = "The identity provider's response is invalid or expired; sign in again"
+
+// oidcAPI is a test API signing users in with a fake provider.
+type oidcAPI struct {
+	*testAPI
+	provider *oidctest.Provider
+}
+
+func newOIDCAPI(t *testing.T, configure ...func(*config.Config)) *oidcAPI {
+	t.Helper()
+	srv, provider, err := oidctest.NewServer("todo-api", "client-secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(srv.Close)
+	o := provider.Config(redirectURL)
+	api := newTestAPI(t, append([]func(*config.Config){func(cfg *config.Config) {
+		cfg.Auth.OIDC.Issuer = o.Issuer
+		cfg.Auth.OIDC.ClientID = o.ClientID
+		cfg.Auth.OIDC.ClientSecret = o.ClientSecret
+		cfg.Auth.OIDC.RedirectURL = o.RedirectURL
+	}}, configure...)...)
+	return &oidcAPI{testAPI: api, provider: provider}
+}
+
+// start begins a sign-in and returns the provider URL it redirects to and
+// the cookie holding its state.
+func (a *oidcAPI) start() (*url.URL, string) {
+	a.t.Helper()
+	rec := httptest.NewRecorder()
+	a.handler.ServeHTTP(rec, httptest.NewRequest("GET", "/auth/oidc/login", nil))
+	if rec.Code != http.StatusFound {
+		a.t.Fatalf("login: status = %d, want 302; body %s", rec.Code, rec.Body)
+	}
+	target, err := url.Parse(rec.Header().Get("Location"))
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 || !cookies[0].HttpOnly {
+		a.t.Fatalf("login cookies = %v, want one HttpOnly cookie", cookies)
+	}
+	return target, cookies[0].Name + "=" + cookies[0].Value
+}
+
+// authorize follows target at the provider and returns the query it
+// redirects back to the callback with.
+func (a *oidcAPI) authorize(target *url.URL) url.Values {
+	a.t.Helper()
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	res, err := client.Get(target.String())
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	res.Body.Close()
+	back, err := url.Parse(res.Header.Get("Location"))
+	if err != nil || res.StatusCode != http.StatusFound {
+		a.t.Fatalf("authorize: status = %d, want a redirect", res.StatusCode)
+	}
+	return back.Query()
+}
+
+// signIn signs in as whoever claims describes and returns the response of
+// the callback.
+func (a *oidcAPI) signIn(claims map[string]interface{}) response {
+	a.t.Helper()
+	a.provider.SetClaims(claims)
+	target, cookie := a.start()
+	return a.do("GET", "/auth/oidc/callback?"+a.authorize(target).Encode(), "", nil, "Cookie", cookie)
+}
+
+func TestOIDCLogin(t *testing.T) {
+	api := newOIDCAPI(t)
+	target, _ := api.start()
+	q := target.Query()
+	for param, want := range map[string]string{
+		"response_type":         "code",
+		"client_id":             "todo-api",
+		"redirect_uri":          redirectURL,
+		"code_challenge_method": "S256",
+	} {
+		if q.Get(param) != want {
+			t.Errorf("%s = %q, want %q", param, q.Get(param), want)
+		}
+	}
+	if q.Get("state") == "" || q.Get("nonce") == "" || q.Get("code_challenge") == "" {
+		t.Errorf("authorization URL %s lacks a state, nonce or code challenge", target)
+	}
+	if scope := q.Get("scope"); scope != "openid email profile" {
+		t.Errorf("scope = %q, want openid and the configured scopes", scope)
+	}
+
+	api.expect(newTestAPI(t).do("GET", "/auth/oidc/callback", "", nil), http.StatusNotFound)
+}
+
+func TestOIDCCallback(t *testing.T) {
+	api := newOIDCAPI(t)
+	api.provider.SetClaims(map[string]interface{}{"sub": "new-user", "email": "New@Example.com", "email_verified": true})
+	target, cookie := api.start()
+	back := api.authorize(target)
+
+	res := api.expect(api.do("GET", "/auth/oidc/callback?"+back.Encode(), "", nil, "Cookie", cookie), http.StatusOK)
+	if str(res.Body, "user", "email") != "new@example.com" || str(res.Body, "user", "role") != "member" {
+		t.Errorf("user = %v, want a new member", res.Body["user"])
+	}
+	api.expect(api.do("GET", "/todos", str(res.Body, "access_token"), nil), http.StatusOK)
+
+	// The code is used up, and signing in again finds the same account
+	api.expect(api.do("GET", "/auth/oidc/callback?"+back.Encode(), "", nil, "Cookie", cookie), http.StatusUnauthorized)
+	again := api.expect(api.signIn(map[string]interface{}{"sub": "new-user", "email": "changed@example.com"}), http.StatusOK)
+	if str(again.Body, "user", "id") != str(res.Body, "user", "id") {
+		t.Error("signing in again created another account")
+	}
+}
+
+func TestOIDCStateMismatch(t *testing.T) {
+	api := newOIDCAPI(t)
+	target, cookie := api.start()
+	back := api.authorize(target)
+
+	tests := []struct {
+		name   string
+		query  url.Values
+		cookie string
+	}{
+		{name: "no cookie", query: back},
+		{name: "other state", query: url.Values{"code": {back.Get("code")}, "state": {"forged"}}, cookie: cookie},
+		{name: "tampered cookie", query: back, cookie: cookie + "x"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var header []string
+			if tt.cookie != "" {
+				header = []string{"Cookie", tt.cookie}
+			}
+			api.expect(api.do("GET", "/auth/oidc/callback?"+tt.query.Encode(), "", nil, header...), http.StatusBadRequest)
+		})
+	}
+}
+
+// A code is only exchanged with the verifier of the sign-in it was issued
+// to, so a code stolen from one sign-in doesn't work in another.
+func TestOIDCPKCE(t *testing.T) {
+	api := newOIDCAPI(t)
+	api.provider.SetClaims(map[string]interface{}{"sub": "pkce", "email": "pkce@example.com"})
+	first, _ := api.start()
+	stolen := api.authorize(first)
+	second, cookie := api.start()
+	q := api.authorize(second)
+
+	if first.Query().Get("code_challenge") == second.Query().Get("code_challenge") {
+		t.Error("two sign-ins used the same code challenge")
+	}
+	q.Set("code", stolen.Get("code"))
+	res := api.expect(api.do("GET", "/auth/oidc/callback?"+q.Encode(), "", nil, "Cookie", cookie), http.StatusUnauthorized)
+	if detail := str(res.Body, "detail"); detail != invalidResponse {
+		t.Errorf("detail = %q, want %q", detail, invalidResponse)
+	}
+}
+
+func TestOIDCRejectsTokens(t *testing.T) {
+	api := newOIDCAPI(t)
+	now := time.Now()
+	tests := []struct {
+		name   string
+		claims map[string]interface{}
+	}{
+		{name: "nonce mismatch", claims: map[string]interface{}{"sub": "u", "email": "u@example.com", "nonce": "replayed"}},
+		{name: "expired", claims: map[string]interface{}{"sub": "u", "email": "u@example.com", "exp": now.Add(-time.Hour).Unix(), "iat": now.Add(-2 * time.Hour).Unix()}},
+		{name: "issued in the future", claims: map[string]interface{}{"sub": "u", "email": "u@example.com", "iat": now.Add(time.Hour).Unix()}},
+		{name: "other audience", claims: map[string]interface{}{"sub": "u", "email": "u@example.com", "aud": "another-client"}},
+		{name: "other issuer", claims: map[string]interface{}{"sub": "u", "email": "u@example.com", "iss": "https://evil.example.com"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := api.expect(api.signIn(tt.claims), http.StatusUnauthorized)
+			if detail := str(res.Body, "detail"); detail != invalidResponse {
+				t.Errorf("detail = %q, want %q", detail, invalidResponse)
+			}
+		})
+	}
+	if users, _ := api.store.ListUsers(context.Background()); len(users) != 0 {
+		t.Errorf("users = %v, want no account from rejected tokens", users)
+	}
+}
+
+func TestOIDCKeyRotation(t *testing.T) {
+	api := newOIDCAPI(t)
+	claims := map[string]interface{}{"sub": "rotating", "email": "rotating@example.com"}
+	api.expect(api.signIn(claims), http.StatusOK)
+	for range 2 {
+		if err := api.provider.RotateKey(); err != nil {
+			t.Fatal(err)
+		}
+		api.expect(api.signIn(claims), http.StatusOK)
+	}
+}
+
+func TestOIDCLinksAccounts(t *testing.T) {
+	api := newOIDCAPI(t)
+	existing := api.signUp("linked@example.com", "")
+	api.signUp("unverified@example.com", "")
+
+	res := api.expect(api.signIn(map[string]interface{}{"sub": "a", "email": "unverified@example.com"}), http.StatusConflict)
+	if str(res.Body, "code") != "conflict" {
+		t.Errorf("code = %q, want conflict", str(res.Body, "code"))
+	}
+	res = api.expect(api.signIn(map[string]interface{}{"sub": "b", "email": "Linked@example.com", "email_verified": true}), http.StatusOK)
+	if str(res.Body, "user", "id") != existing.ID {
+		t.Errorf("signed in as %s, want the existing account %s", str(res.Body, "user", "id"), existing.ID)
+	}
+	// Once linked, the identity finds the account, whatever its email says
+	res = api.expect(api.signIn(map[string]interface{}{"sub": "b"}), http.StatusOK)
+	if str(res.Body, "user", "id") != existing.ID {
+		t.Error("the linked identity did not find its account")
+	}
+	api.expect(api.signIn(map[string]interface{}{"sub": "c", "email": "linked@example.com", "email_verified": true}), http.StatusConflict)
+	api.expect(api.signIn(map[string]interface{}{"sub": "d"}), http.StatusUnauthorized)
+	api.expect(api.do("POST", "/auth/login", "", map[string]string{"email": "linked@example.com", "password": testPassword}), http.StatusOK)
+}
+
+func TestOIDCRoleMapping(t *testing.T) {
+	api := newOIDCAPI(t, func(cfg *config.Config) {
+		cfg.Auth.OIDC.Roles = map[string]string{"readers": "viewer", "staff": "member", "ops": "admin"}
+	})
+	tests := []struct {
+		name   string
+		groups interface{}
+		role   string
+	}{
+		{name: "highest role wins", groups: []string{"staff", "ops", "readers"}, role: "admin"},
+		{name: "demoted on the next sign-in", groups: []string{"readers"}, role: "viewer"},
+		{name: "single string", groups: "staff", role: "member"},
+		{name: "unmapped groups", groups: []string{"interns"}, role: "member"},
+		{name: "no groups", role: "member"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := map[string]interface{}{"sub": "mapped", "email": "mapped@example.com"}
+			if tt.groups != nil {
+				claims["groups"] = tt.groups
+			}
+			res := api.expect(api.signIn(claims), http.StatusOK)
+			if str(res.Body, "user", "role") != tt.role {
+				t.Errorf("role = %q, want %q", str(res.Body, "user", "role"), tt.role)
+			}
+			perms := api.expect(api.do("GET", "/auth/permissions", str(res.Body, "access_token"), nil), http.StatusOK)
+			if str(perms.Body, "role") != tt.role {
+				t.Errorf("token role = %q, want %q", str(perms.Body, "role"), tt.role)
+			}
+		})
+	}
+}
+
+// Without a mapping, roles set in the API survive signing in.
+func TestOIDCWithoutRoleMapping(t *testing.T) {
+	api := newOIDCAPI(t)
+	u := api.signUp("kept@example.com", "admin")
+	res := api.expect(api.signIn(map[string]interface{}{"sub": "k", "email": "kept@example.com", "email_verified": true,
+		"groups": []string{"ops"}}), http.StatusOK)
+	if str(res.Body, "user", "id") != u.ID || str(res.Body, "user", "role") != "admin" {
+		t.Errorf("user = %v, want the admin account unchanged", res.Body["user"])
+	}
+}
@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"todo-api/models"
+	"todo-api/store"
+)
+
+// defaultPageSize is used when a list request has no valid limit.
+const defaultPageSize = 10
+
+// pageRequest holds the cursor pagination parameters of a list request.
+type pageRequest struct {
+	Limit        int
+	Keyset       store.Keyset
+	IncludeTotal bool
+	query        string // what the cursor is bound to
+}
+
+// pageLimit reads the limit query parameter of r, using def when it is
+// missing or invalid, and caps it at the configured max page size.
+func (s *Server) pageLimit(r *http.Request, def int) int {
+	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	if err != nil || limit < 1 {
+		limit = def
+	}
+	return min(limit, s.cfg.API.MaxPageSize)
+}
+
+// parsePage reads limit, cursor and include_total, with def as the default
+// limit. query describes the filters and sort order of the list, so a cursor
+// only works for the list it came from. On failure the error response has
+// been written and ok is false.
+func (s *Server) parsePage(w http.ResponseWriter, r *http.Request, query string, def int) (req pageRequest, ok bool) {
+	params := r.URL.Query()
+	req.query = query
+	req.Limit = s.pageLimit(r, def)
+
+	if token := params.Get("cursor"); token != "" {
+		keyset, err := s.cursors.decode(token, query)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, CodeInvalidCursor,
+				"Invalid or expired cursor; cursors only work with the filters and sort order they were issued for")
+			return req, false
+		}
+		req.Keyset = keyset
+	}
+
+	if v := params.Get("include_total"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, CodeBadRequest, "include_total must be true or false")
+			return req, false
+		}
+		req.IncludeTotal = b
+	}
+	return req, true
+}
+
+// trimPage drops the extra item fetched past the page limit (the store is
+// asked for Limit+1) and reports whether pages exist on either side.
+func trimPage[T any](items []T, req pageRequest) (page []T, hasNext, hasPrev bool) {
+	over := len(items) > req.Limit
+	if req.Keyset.After != nil && req.Keyset.Backward {
+		if over {
+			items = items[1:]
+		}
+		return items, true, over
+	}
+	if over {
+		items = items[:req.Limit]
+	}
+	return items, over, req.Keyset.After != nil
+}
+
+// pageLinks builds the tokens and URLs for the pages around the current
+// one, given the positions of its first and last items, and advertises them
+// in a Link header.
+func (s *Server) pageLinks(w http.ResponseWriter, r *http.Request, req pageRequest, first, last store.Cursor, hasNext, hasPrev bool) (next, prev string, links models.PageLinks) {
+	var header []string
+	if hasNext {
+		next = s.cursors.encode(last, false, req.query)
+		links.Next = pageURL(r, next)
+		header = append(header, "<"+links.Next+`>; rel="next"`)
+	}
+	if hasPrev {
+		prev = s.cursors.encode(first, true, req.query)
+		links.Prev = pageURL(r, prev)
+		header = append(header, "<"+links.Prev+`>; rel="prev"`)
+	}
+	if len(header) > 0 {
+		w.Header().Add("Link", strings.Join(header, ", "))
+	}
+	return next, prev, links
+}
+
+// pageURL is the request URL pointing at the page of cursor.
+func pageURL(r *http.Request, cursor string) string {
+	params := r.URL.Query()
+	params.Set("cursor", cursor)
+	params.Del("page")
+	return (&url.URL{Path: r.URL.Path, RawQuery: params.Encode()}).String()
+}
@@ -0,0 +1,103 @@
+package handlers_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+	"todo-api/jsonpatch"
+	"todo-api/models"
+	"todo-api/store"
+
+	"github.com/google/uuid"
+)
+
+func TestPatchTodo(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		patch       string
+		code        int
+		title       string // of the updated todo
+		description string
+		status      string
+	}{
+		{name: "merge patch", contentType: jsonpatch.MergePatchType, patch: `{"title":"renamed"}`,
+			code: http.StatusOK, title: "renamed", description: "details", status: "pending"},
+		{name: "merge patch null clears", contentType: jsonpatch.MergePatchType, patch: `{"description":null}`,
+			code: http.StatusOK, title: "todo", status: "pending"},
+		{name: "plain json is a merge patch", contentType: "application/json", patch: `{"status":"in_progress"}`,
+			code: http.StatusOK, title: "todo", description: "details", status: "in_progress"},
+		{name: "json patch", contentType: jsonpatch.JSONPatchType,
+			patch: `[{"op":"test","path":"/title","value":"todo"},{"op":"replace","path":"/title","value":"patched"},{"op":"remove","path":"/description"}]`,
+			code:  http.StatusOK, title: "patched", status: "pending"},
+		{name: "failed test", contentType: jsonpatch.JSONPatchType, patch: `[{"op":"test","path":"/title","value":"other"}]`,
+			code: http.StatusConflict},
+		{name: "invalid patch", contentType: jsonpatch.JSONPatchType, patch: `[{"op":"remove","path":"/nope"}]`,
+			code: http.StatusBadRequest},
+		{name: "unknown field", contentType: jsonpatch.JSONPatchType, patch: `[{"op":"add","path":"/owner_id","value":"x"}]`,
+			code: http.StatusUnprocessableEntity},
+		{name: "invalid result", contentType: jsonpatch.MergePatchType, patch: `{"title":""}`,
+			code: http.StatusUnprocessableEntity},
+		{name: "unsupported type", contentType: "text/plain", patch: `title=x`,
+			code: http.StatusUnsupportedMediaType},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := newTestAPI(t)
+			u := api.signUp("patch@example.com", "")
+			todo := api.expect(api.do("POST", "/todos", u.Token, map[string]string{"title": "todo", "description": "details"}), http.StatusCreated)
+			id := str(todo.Body, "id")
+
+			res := api.do("PATCH", "/todos/"+id, u.Token, tt.patch, "Content-Type", tt.contentType)
+			api.expect(res, tt.code)
+			if tt.code != http.StatusOK {
+				return
+			}
+			updated, _ := res.Body["updated"].(map[string]interface{})
+			if str(updated, "title") != tt.title || str(updated, "description") != tt.description || str(updated, "status") != tt.status {
+				t.Errorf("updated = %v, want title %q, description %q, status %q", updated, tt.title, tt.description, tt.status)
+			}
+		})
+	}
+}
+
+// Updates that change nothing are answered with the todo as it is, even when
+// it would no longer pass validation, and are not logged.
+func TestNoOpUpdate(t *testing.T) {
+	api := newTestAPI(t)
+	u := api.signUp("noop@example.com", "")
+	ws := uuid.MustParse(api.workspace(u))
+	old := models.Todo{
+		ID: uuid.New(), Title: "old", Status: models.StatusPending, WorkspaceID: &ws,
+		DueDate: models.CustomDate{Time: time.Now().AddDate(-2, 0, 0).Truncate(24 * time.Hour)},
+	}
+	if err := api.store.CreateTodo(context.Background(), &old); err != nil {
+		t.Fatal(err)
+	}
+	path := "/todos/" + old.ID.String()
+	etag := api.expect(api.do("GET", path, u.Token, nil), http.StatusOK).Header.Get("ETag")
+
+	for _, req := range []struct {
+		method, contentType, body string
+	}{
+		{"PATCH", jsonpatch.MergePatchType, `{}`},
+		{"PATCH", jsonpatch.MergePatchType, `{"title":"old"}`},
+		{"PATCH", jsonpatch.JSONPatchType, `[]`},
+		{"PUT", "application/json", `{"title":"old","status":"pending","due_date":"` + old.DueDate.Format("2006-01-02") + `"}`},
+	} {
+		res := api.expect(api.do(req.method, path, u.Token, req.body, "Content-Type", req.contentType), http.StatusOK)
+		if str(res.Body, "message") != "Todo unchanged" || res.Header.Get("ETag") != etag {
+			t.Errorf("%s %s: message %q, ETag %q; want Todo unchanged with ETag %q", req.method, req.body, str(res.Body, "message"), res.Header.Get("ETag"), etag)
+		}
+	}
+	if _, total, _ := api.store.ListLogs(context.Background(), store.LogListOptions{TodoID: &old.ID, Action: "update"}); total != 0 {
+		t.Errorf("no-op updates wrote %d log entries", total)
+	}
+
+	// Real changes validate only the changed fields
+	res := api.expect(api.do("PATCH", path, u.Token, `{"title":"renamed"}`, "Content-Type", jsonpatch.MergePatchType), http.StatusOK)
+	if res.Header.Get("ETag") == etag {
+		t.Error("a real update kept the ETag")
+	}
+}
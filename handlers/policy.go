@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"todo-api/auth"
+)
+
+// authorize checks that the caller of r has perm under the policy in
+// auth/role.go, limited by the scopes of the API key they used, if any. It
+// writes 403 otherwise and reports whether the handler may continue.
+// Everything but user administration happens in a workspace, so callers
+// without one are refused.
+func (s *Server) authorize(w http.ResponseWriter, r *http.Request, perm auth.Permission) bool {
+	c := callerFrom(r.Context())
+	if !c.allowed(perm) {
+		writeProblem(w, r, NewProblem(http.StatusForbidden, CodeForbidden, "You don't have the "+string(perm)+" permission").
+			With("required_permission", perm))
+		return false
+	}
+	if c.NoWorkspace && perm != auth.PermUsersAdmin {
+		writeProblem(w, r, NewProblem(http.StatusForbidden, CodeNoWorkspace,
+			"You don't belong to any workspace; create one or accept an invitation to one").
+			With("workspaces", "/workspaces").
+			With("accept_invitation", "/invitations/accept"))
+		return false
+	}
+	return true
+}
+
+// GetPermissions returns the role of the caller and the permissions it has
+// with the credentials of this request.
+func (s *Server) GetPermissions(w http.ResponseWriter, r *http.Request) {
+	c := callerFrom(r.Context())
+	response := map[string]interface{}{
+		"role":        c.Role,
+		"permissions": auth.Effective(c.Role, c.scopes()),
+	}
+	if c.APIKey {
+		response["scopes"] = c.Scopes
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
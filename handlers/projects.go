@@ -0,0 +1,246 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"todo-api/auth"
+	"todo-api/models"
+	"todo-api/store"
+
+	"github.com/google/uuid"
+)
+
+// projectRequest is the body of a request creating a project.
+type projectRequest struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Color       string `json:"color"`
+}
+
+// projectPatch is the body of a request changing a project; only the fields
+// present change.
+type projectPatch struct {
+	Name        *string `json:"name"`
+	Description *string `json:"description"`
+	Color       *string `json:"color"`
+	Archived    *bool   `json:"archived"`
+}
+
+// moveRequest is the body of a request moving a todo; a null project_id
+// takes it out of its project.
+type moveRequest struct {
+	ProjectID *uuid.UUID `json:"project_id"`
+}
+
+// ListProjects lists the projects of the caller's workspace by name.
+// Archived projects are left out unless include_archived=true.
+func (s *Server) ListProjects(w http.ResponseWriter, r *http.Request) {
+	if !s.authorize(w, r, auth.PermTodosRead) {
+		return
+	}
+	opts := store.ProjectListOptions{Workspace: workspace(r)}
+	if v := r.URL.Query().Get("include_archived"); v != "" {
+		var err error
+		if opts.Archived, err = strconv.ParseBool(v); err != nil {
+			writeError(w, r, http.StatusBadRequest, CodeBadRequest, "include_archived must be true or false")
+			return
+		}
+	}
+	projects, err := s.store.ListProjects(r.Context(), opts)
+	if err != nil {
+		writeStoreError(w, r, err, "Unable to fetch projects")
+		return
+	}
+	if projects == nil {
+		projects = []models.Project{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"projects": projects})
+}
+
+// CreateProject creates a project in the caller's workspace.
+func (s *Server) CreateProject(w http.ResponseWriter, r *http.Request) {
+	if !s.authorize(w, r, auth.PermTodosWrite) {
+		return
+	}
+	var body projectRequest
+	if err := decodeJSON(w, r, &body); err != nil {
+		return
+	}
+	project := models.Project{ID: uuid.New(), Name: body.Name, Description: body.Description, Color: body.Color}
+	if errs := models.Validate(project); len(errs) > 0 {
+		writeValidationError(w, r, errs)
+		return
+	}
+	if ws := workspace(r); ws != uuid.Nil {
+		project.WorkspaceID = &ws
+	}
+
+	if err := s.store.CreateProject(r.Context(), &project); err != nil {
+		writeStoreError(w, r, err, "A project with this name already exists")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/projects/"+project.ID.String())
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(project)
+}
+
+// GetProject returns a project of the caller's workspace.
+func (s *Server) GetProject(w http.ResponseWriter, r *http.Request) {
+	if !s.authorize(w, r, auth.PermTodosRead) {
+		return
+	}
+	project, ok := s.loadProject(w, r)
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(project)
+}
+
+// UpdateProject renames, recolours, archives or unarchives a project.
+// Archiving hides the project's todos from lists; they are not changed.
+func (s *Server) UpdateProject(w http.ResponseWriter, r *http.Request) {
+	if !s.authorize(w, r, auth.PermTodosWrite) {
+		return
+	}
+	project, ok := s.loadProject(w, r)
+	if !ok {
+		return
+	}
+	var body projectPatch
+	if err := decodeJSON(w, r, &body); err != nil {
+		return
+	}
+
+	// Only the fields being changed are validated
+	next := project
+	var fields []string
+	if body.Name != nil {
+		next.Name = *body.Name
+		fields = append(fields, "name")
+	}
+	if body.Description != nil {
+		next.Description = *body.Description
+		fields = append(fields, "description")
+	}
+	if body.Color != nil {
+		next.Color = *body.Color
+		fields = append(fields, "color")
+	}
+	if len(fields) > 0 {
+		if errs := models.Validate(next, fields...); len(errs) > 0 {
+			writeValidationError(w, r, errs)
+			return
+		}
+	}
+
+	updated, err := s.store.UpdateProject(r.Context(), project.ID, store.ProjectUpdate{
+		Name:        body.Name,
+		Description: body.Description,
+		Color:       body.Color,
+		Archived:    body.Archived,
+	})
+	if errors.Is(err, store.ErrConflict) {
+		writeError(w, r, http.StatusConflict, CodeConflict, "A project with this name already exists")
+		return
+	}
+	if err != nil {
+		writeStoreError(w, r, err, "Project not found")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(updated)
+}
+
+// DeleteProject removes a project that has no todos left, deleted ones
+// included. Projects still holding todos can be archived instead.
+func (s *Server) DeleteProject(w http.ResponseWriter, r *http.Request) {
+	if !s.authorize(w, r, auth.PermTodosDelete) {
+		return
+	}
+	project, ok := s.loadProject(w, r)
+	if !ok {
+		return
+	}
+	err := s.store.DeleteProject(r.Context(), project.ID)
+	if errors.Is(err, store.ErrConflict) {
+		writeProblem(w, r, NewProblem(http.StatusConflict, CodeConflict,
+			"Project still has todos; move them out, purge them or archive the project instead").
+			With("todos", "/todos?project_id="+project.ID.String()+"&include_deleted=true"))
+		return
+	}
+	if err != nil {
+		writeStoreError(w, r, err, "Project not found")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// MoveTodo handles PUT /todos/{id}/project: it puts a todo in another
+// project, or in none, and records the move in the audit log.
+func (s *Server) MoveTodo(w http.ResponseWriter, r *http.Request) {
+	if !s.authorize(w, r, auth.PermTodosWrite) {
+		return
+	}
+	prevTodo, ok := s.loadTodo(w, r, true)
+	if !ok {
+		return
+	}
+	var body moveRequest
+	if err := decodeJSON(w, r, &body); err != nil {
+		return
+	}
+
+	next := prevTodo
+	next.ProjectID = body.ProjectID
+	if !s.checkProject(w, r, next) {
+		return
+	}
+	s.saveTodo(w, r, prevTodo, next)
+}
+
+// loadProject loads the project named by the id path value if it is in the
+// caller's workspace, and writes 404 otherwise.
+func (s *Server) loadProject(w http.ResponseWriter, r *http.Request) (project models.Project, ok bool) {
+	id, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidID, "Invalid project ID")
+		return project, false
+	}
+	project, err = s.store.GetProject(r.Context(), id)
+	if err == nil && !reachable(r, project.WorkspaceID) {
+		err = store.ErrNotFound
+	}
+	if err != nil {
+		writeStoreError(w, r, err, "Project not found")
+		return project, false
+	}
+	return project, true
+}
+
+// checkProject checks that the project todo is being put in, if any, is a
+// live project of the todo's workspace, and writes 422 or 409 otherwise.
+func (s *Server) checkProject(w http.ResponseWriter, r *http.Request, todo models.Todo) bool {
+	if todo.ProjectID == nil {
+		return true
+	}
+	project, err := s.store.GetProject(r.Context(), *todo.ProjectID)
+	if errors.Is(err, store.ErrNotFound) || err == nil && !models.SameID(project.WorkspaceID, todo.WorkspaceID) {
+		writeValidationError(w, r, []models.FieldError{{Field: "project_id", Code: "not_found",
+			Message: "project_id must name a project in the todo's workspace"}})
+		return false
+	}
+	if err != nil {
+		writeStoreError(w, r, err, "Failed to load project")
+		return false
+	}
+	if project.Archived {
+		writeError(w, r, http.StatusConflict, CodeConflict, "Project is archived; unarchive it before adding todos to it")
+		return false
+	}
+	return true
+}
@@ -0,0 +1,131 @@
+package handlers_test
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// project creates a project called name for u and returns its ID.
+func (a *testAPI) project(u user, name string) string {
+	a.t.Helper()
+	return str(a.expect(a.do("POST", "/projects", u.Token, map[string]string{"name": name}), http.StatusCreated).Body, "id")
+}
+
+func TestProjects(t *testing.T) {
+	api := newTestAPI(t)
+	u := api.signUp("projects@example.com", "")
+
+	res := api.expect(api.do("POST", "/projects", u.Token, map[string]string{"name": "Home", "color": "#3366ff"}), http.StatusCreated)
+	id := str(res.Body, "id")
+	if res.Header.Get("Location") != "/projects/"+id || str(res.Body, "workspace_id") != api.workspace(u) {
+		t.Errorf("created %v at %s, want it in the user's workspace", res.Body, res.Header.Get("Location"))
+	}
+	api.expect(api.do("POST", "/projects", u.Token, map[string]string{"name": "home"}), http.StatusConflict)
+
+	tests := []struct {
+		name   string
+		body   map[string]string
+		errors []string
+	}{
+		{name: "no name", body: map[string]string{}, errors: []string{"name:required"}},
+		{name: "name too long", body: map[string]string{"name": strings.Repeat("n", 101)}, errors: []string{"name:too_long"}},
+		{name: "invalid color", body: map[string]string{"name": "x", "color": "blue"}, errors: []string{"color:invalid_color"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := api.expect(api.do("POST", "/projects", u.Token, tt.body), http.StatusUnprocessableEntity)
+			var got []string
+			for _, fe := range items(res.Body, "errors") {
+				got = append(got, str(fe, "field")+":"+str(fe, "code"))
+			}
+			if strings.Join(got, ",") != strings.Join(tt.errors, ",") {
+				t.Errorf("errors = %v, want %v", got, tt.errors)
+			}
+		})
+	}
+
+	api.project(u, "Work")
+	res = api.expect(api.do("PATCH", "/projects/"+id, u.Token, `{"color":"#00ff00"}`), http.StatusOK)
+	if str(res.Body, "name") != "Home" || str(res.Body, "color") != "#00ff00" {
+		t.Errorf("updated = %v, want only the color changed", res.Body)
+	}
+	api.expect(api.do("PATCH", "/projects/"+id, u.Token, `{"name":"WORK"}`), http.StatusConflict)
+	api.expect(api.do("PATCH", "/projects/"+id, u.Token, `{"color":"red"}`), http.StatusUnprocessableEntity)
+
+	// Projects of other workspaces don't exist for u
+	other := api.signUp("other-projects@example.com", "")
+	api.expect(api.do("GET", "/projects/"+id, other.Token, nil), http.StatusNotFound)
+	if list := items(api.expect(api.do("GET", "/projects", other.Token, nil), http.StatusOK).Body, "projects"); len(list) != 0 {
+		t.Errorf("projects = %v, want none of another workspace's", list)
+	}
+	api.expect(api.do("POST", "/todos", other.Token, map[string]string{"title": "t", "project_id": id}), http.StatusUnprocessableEntity)
+}
+
+func TestMoveTodo(t *testing.T) {
+	api := newTestAPI(t)
+	u := api.signUp("move@example.com", "")
+	home, work := api.project(u, "Home"), api.project(u, "Work")
+	id := str(api.expect(api.do("POST", "/todos", u.Token, map[string]string{"title": "t", "project_id": home}), http.StatusCreated).Body, "id")
+	path := "/todos/" + id + "/project"
+
+	res := api.expect(api.do("PUT", path, u.Token, map[string]string{"project_id": work}), http.StatusOK)
+	if str(res.Body, "message") != "Todo moved successfully" || str(res.Body, "updated", "project_id") != work {
+		t.Errorf("move = %v, want the todo in Work", res.Body)
+	}
+	api.expect(api.do("PUT", path, u.Token, `{"project_id":null}`), http.StatusOK)
+	api.expect(api.do("PUT", path, u.Token, map[string]string{"project_id": "00000000-0000-0000-0000-000000000001"}), http.StatusUnprocessableEntity)
+
+	actions, changes := api.mutationLogs(id)
+	if strings.Join(actions, ",") != "create,move,move" {
+		t.Fatalf("logged actions = %v, want create and two moves", actions)
+	}
+	if c := changes[1]["project_id"]; c.Before != home || c.After != work {
+		t.Errorf("move changes = %v, want project_id from Home to Work", changes[1])
+	}
+}
+
+func TestArchivedProjects(t *testing.T) {
+	api := newTestAPI(t)
+	u := api.signUp("archive@example.com", "")
+	project := api.project(u, "Old")
+	api.expect(api.do("POST", "/todos", u.Token, map[string]string{"title": "archived", "project_id": project}), http.StatusCreated)
+	api.expect(api.do("POST", "/todos", u.Token, map[string]string{"title": "loose"}), http.StatusCreated)
+
+	res := api.expect(api.do("PATCH", "/projects/"+project, u.Token, `{"archived":true}`), http.StatusOK)
+	if res.Body["archived_at"] == nil {
+		t.Error("archiving did not stamp archived_at")
+	}
+	if titles, _ := api.list(u.Token, "/todos"); strings.Join(titles, ",") != "loose" {
+		t.Errorf("todos = %v, want the archived project's hidden", titles)
+	}
+	if titles, _ := api.list(u.Token, "/todos?project_id="+project); strings.Join(titles, ",") != "archived" {
+		t.Errorf("todos of the project = %v, want them listed when asked for", titles)
+	}
+	if list := items(api.expect(api.do("GET", "/projects", u.Token, nil), http.StatusOK).Body, "projects"); len(list) != 0 {
+		t.Errorf("projects = %v, want the archived one hidden", list)
+	}
+	if list := items(api.expect(api.do("GET", "/projects?include_archived=true", u.Token, nil), http.StatusOK).Body, "projects"); len(list) != 1 {
+		t.Errorf("projects with archived = %v, want the archived one", list)
+	}
+	api.expect(api.do("GET", "/projects?include_archived=maybe", u.Token, nil), http.StatusBadRequest)
+	api.expect(api.do("POST", "/todos", u.Token, map[string]string{"title": "late", "project_id": project}), http.StatusConflict)
+}
+
+func TestDeleteProject(t *testing.T) {
+	api := newTestAPI(t)
+	u := api.signUp("delete-project@example.com", "")
+	project := api.project(u, "Busy")
+	id := str(api.expect(api.do("POST", "/todos", u.Token, map[string]string{"title": "t", "project_id": project}), http.StatusCreated).Body, "id")
+
+	res := api.expect(api.do("DELETE", "/projects/"+project, u.Token, nil), http.StatusConflict)
+	if !strings.Contains(str(res.Body, "todos"), "project_id="+project) {
+		t.Errorf("todos = %q, want a link to the project's todos", str(res.Body, "todos"))
+	}
+	// Deleted todos still hold the project until they are purged
+	api.expect(api.do("DELETE", "/todos/"+id, u.Token, nil), http.StatusOK)
+	api.expect(api.do("DELETE", "/projects/"+project, u.Token, nil), http.StatusConflict)
+	api.expect(api.do("DELETE", "/todos/trash/"+id, adminToken, nil), http.StatusNoContent)
+	api.expect(api.do("DELETE", "/projects/"+project, u.Token, nil), http.StatusNoContent)
+	api.expect(api.do("GET", "/projects/"+project, u.Token, nil), http.StatusNotFound)
+}
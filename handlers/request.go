@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"todo-api/models"
+)
+
+// maxBodyBytes caps the size of JSON request bodies.
+const maxBodyBytes = 1 << 20
+
+// decodeJSON strictly decodes the request body into dst: unknown fields and
+// wrongly typed values are reported as 422 field errors, anything else that
+// isn't valid JSON as 400. On failure the response has been written and the
+// returned error describes what went wrong, for logging.
+func decodeJSON(w http.ResponseWriter, r *http.Request, dst interface{}) error {
+	r.Body = http.MaxBytesReader(w, r.Body, maxBodyBytes)
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+
+	err := dec.Decode(dst)
+	if err == nil && dec.More() {
+		err = errors.New("request body must contain a single JSON object")
+	}
+	if err == nil {
+		return nil
+	}
+
+	var typeErr *json.UnmarshalTypeError
+	var maxErr *http.MaxBytesError
+	switch {
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		field := strings.Trim(strings.TrimPrefix(err.Error(), "json: unknown field "), `"`)
+		writeValidationError(w, r, []models.FieldError{{
+			Field:   field,
+			Code:    "unknown_field",
+			Message: fmt.Sprintf("%s is not a recognised field", field),
+		}})
+	case errors.As(err, &typeErr) && typeErr.Field != "":
+		writeValidationError(w, r, []models.FieldError{{
+			Field:   typeErr.Field,
+			Code:    "invalid_type",
+			Message: fmt.Sprintf("%s must be a %s", typeErr.Field, typeErr.Type.Kind()),
+		}})
+	case errors.As(err, &maxErr):
+		writeError(w, r, http.StatusRequestEntityTooLarge, CodeInvalidPayload,
+			fmt.Sprintf("Request body must not exceed %d bytes", maxErr.Limit))
+	default:
+		writeError(w, r, http.StatusBadRequest, CodeInvalidPayload, "Invalid request payload: "+err.Error())
+	}
+	return err
+}
+
+// writeValidationError responds 422 with the per-field errors.
+func writeValidationError(w http.ResponseWriter, r *http.Request, errs []models.FieldError) {
+	p := NewProblem(http.StatusUnprocessableEntity, CodeValidation, "The request contains invalid fields")
+	p.Errors = errs
+	writeProblem(w, r, p)
+}
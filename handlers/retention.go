@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+	"todo-api/models"
+	"todo-api/store"
+
+	"github.com/google/uuid"
+)
+
+// RunRetention purges todos that have been in the trash longer than the
+// configured retention period, checking every retention interval until ctx
+// is done. It returns at once when no period is configured.
+func (s *Server) RunRetention(ctx context.Context) {
+	period := s.cfg.Retention.TrashPeriod
+	if period <= 0 {
+		return
+	}
+	ticker := time.NewTicker(s.cfg.Retention.Interval)
+	defer ticker.Stop()
+
+	for {
+		s.purgeExpired(ctx, period)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// purgeExpired removes todos deleted more than period ago, logging each one
+// in the same transaction.
+func (s *Server) purgeExpired(ctx context.Context, period time.Duration) {
+	var purged int
+	err := s.scope(ctx, uuid.Nil, func(ctx context.Context) error {
+		return s.store.Atomic(ctx, func(tx store.Store) error {
+			todos, err := tx.PurgeDeleted(ctx, time.Now().Add(-period))
+			if err != nil {
+				return err
+			}
+			for _, todo := range todos {
+				err := tx.AddLog(ctx, models.LogEntry{
+					Action: "purge", TodoID: todo.ID, WorkspaceID: todo.WorkspaceID, Message: "Todo purged",
+					Details: fmt.Sprintf("Removed by the retention job after more than %s in the trash", period),
+				})
+				if err != nil {
+					return err
+				}
+			}
+			purged = len(todos)
+			return nil
+		})
+	})
+	if err != nil {
+		slog.Error("Retention job failed", "err", err)
+		return
+	}
+	if purged > 0 {
+		slog.Info("Retention job purged expired todos", "purged", purged, "trash_period", period)
+	}
+}
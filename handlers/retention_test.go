@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"context"
+	"testing"
+	"time"
+	"todo-api/config"
+	"todo-api/models"
+	"todo-api/store"
+
+	"github.com/google/uuid"
+)
+
+func TestPurgeExpired(t *testing.T) {
+	ctx := context.Background()
+	st := store.NewMemory()
+	srv, err := NewServer(config.Default(), st)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close(ctx)
+
+	ws := uuid.New()
+	var ids []uuid.UUID
+	for _, title := range []string{"trashed", "live"} {
+		todo := models.Todo{ID: uuid.New(), Title: title, Status: models.StatusPending, WorkspaceID: &ws}
+		if err := st.CreateTodo(ctx, &todo); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, todo.ID)
+	}
+	if err := st.DeleteTodo(ctx, ids[0], 1); err != nil {
+		t.Fatal(err)
+	}
+
+	srv.purgeExpired(ctx, time.Hour)
+	if _, err := st.GetTodo(ctx, ids[0], store.IncludeDeleted); err != nil {
+		t.Fatalf("a todo deleted just now was purged: %v", err)
+	}
+
+	time.Sleep(time.Millisecond)
+	srv.purgeExpired(ctx, time.Microsecond)
+	if _, err := st.GetTodo(ctx, ids[0], store.IncludeDeleted); err != store.ErrNotFound {
+		t.Errorf("expired todo: err = %v, want ErrNotFound", err)
+	}
+	if _, err := st.GetTodo(ctx, ids[1], store.HideDeleted); err != nil {
+		t.Errorf("live todo: %v", err)
+	}
+	logs, _, _ := st.ListLogs(ctx, store.LogListOptions{Action: "purge", TodoID: &ids[0]})
+	if len(logs) != 1 {
+		t.Fatalf("purge log entries = %d, want 1", len(logs))
+	}
+	if got := logs[0].WorkspaceID; got == nil || *got != ws {
+		t.Errorf("purge log workspace = %v, want the todo's %v", got, ws)
+	}
+}
+
+func TestRunRetentionDisabled(t *testing.T) {
+	srv, err := NewServer(config.Default(), store.NewMemory())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close(context.Background())
+
+	done := make(chan struct{})
+	go func() {
+		srv.RunRetention(context.Background())
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("RunRetention kept running without a trash period")
+	}
+}
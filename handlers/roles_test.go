@@ -0,0 +1,78 @@
+package handlers_test
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestRolePolicy(t *testing.T) {
+	api := newTestAPI(t)
+	viewer := api.signUp("viewer@example.com", "viewer")
+	member := api.signUp("member@example.com", "")
+	admin := api.signUp("admin@example.com", "admin")
+
+	tests := []struct {
+		name         string
+		u            user
+		method, path string
+		body         interface{}
+		code         int
+	}{
+		{name: "viewer reads", u: viewer, method: "GET", path: "/todos", code: http.StatusOK},
+		{name: "viewer writes", u: viewer, method: "POST", path: "/todos", body: map[string]string{"title": "x"}, code: http.StatusForbidden},
+		{name: "member writes", u: member, method: "POST", path: "/todos", body: map[string]string{"title": "x"}, code: http.StatusCreated},
+		{name: "member reads logs", u: member, method: "GET", path: "/logs", code: http.StatusForbidden},
+		{name: "member lists users", u: member, method: "GET", path: "/users", code: http.StatusForbidden},
+		{name: "admin reads logs", u: admin, method: "GET", path: "/logs", code: http.StatusOK},
+		{name: "admin lists users", u: admin, method: "GET", path: "/users", code: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := api.expect(api.do(tt.method, tt.path, tt.u.Token, tt.body), tt.code)
+			if tt.code == http.StatusForbidden && str(res.Body, "required_permission") == "" {
+				t.Errorf("body = %v, want the missing permission named", res.Body)
+			}
+		})
+	}
+}
+
+func TestSetUserRole(t *testing.T) {
+	api := newTestAPI(t)
+	admin := api.signUp("boss@example.com", "admin")
+	u := api.signUp("promoted@example.com", "")
+
+	res := api.expect(api.do("PUT", "/users/"+u.ID+"/role", admin.Token, map[string]string{"role": "viewer"}), http.StatusOK)
+	if str(res.Body, "role") != "viewer" {
+		t.Errorf("role = %q, want viewer", str(res.Body, "role"))
+	}
+	res = api.expect(api.do("PUT", "/users/"+u.ID+"/role", admin.Token, map[string]string{"role": "owner"}), http.StatusUnprocessableEntity)
+	if fe := items(res.Body, "errors"); len(fe) != 1 || str(fe[0], "field") != "role" || str(fe[0], "code") != "oneof" {
+		t.Errorf("errors = %v, want role:oneof", fe)
+	}
+	api.expect(api.do("PUT", "/users/"+admin.ID+"/role", admin.Token, map[string]string{"role": "member"}), http.StatusConflict)
+	api.expect(api.do("PUT", "/users/"+admin.ID+"/role", admin.Token, map[string]string{"role": "admin"}), http.StatusOK)
+	api.expect(api.do("PUT", "/users/00000000-0000-0000-0000-000000000001/role", admin.Token, map[string]string{"role": "viewer"}), http.StatusNotFound)
+	api.expect(api.do("PUT", "/users/"+admin.ID+"/role", u.Token, map[string]string{"role": "viewer"}), http.StatusForbidden)
+}
+
+func TestGetPermissions(t *testing.T) {
+	api := newTestAPI(t)
+	viewer := api.signUp("perms@example.com", "viewer")
+	res := api.expect(api.do("GET", "/auth/permissions", viewer.Token, nil), http.StatusOK)
+	if perms, _ := res.Body["permissions"].([]interface{}); str(res.Body, "role") != "viewer" || len(perms) != 1 || perms[0] != "todos:read" {
+		t.Errorf("permissions = %v, want a viewer that can only read", res.Body)
+	}
+	if _, ok := res.Body["scopes"]; ok {
+		t.Error("a session listed API key scopes")
+	}
+
+	admin := api.signUp("perms-admin@example.com", "admin")
+	key, _ := api.apiKey(admin, "logs:read")
+	res = api.expect(api.do("GET", "/auth/permissions", key, nil), http.StatusOK)
+	if perms, _ := res.Body["permissions"].([]interface{}); str(res.Body, "role") != "admin" || len(perms) != 1 || perms[0] != "logs:read" {
+		t.Errorf("permissions = %v, want only what the key's scopes allow", res.Body)
+	}
+	if scopes, _ := res.Body["scopes"].([]interface{}); len(scopes) != 1 {
+		t.Errorf("scopes = %v, want the key's scopes", res.Body["scopes"])
+	}
+}
@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"maps"
+	"net/http"
+
+	"github.com/google/uuid"
+)
+
+// errFailedRequest rolls back the transaction of a request answered with an
+// error, so that a failed request leaves nothing behind.
+var errFailedRequest = errors.New("request failed")
+
+// scope runs fn through store.Scope when database.row_level_security is on,
+// and directly otherwise.
+func (s *Server) scope(ctx context.Context, workspace uuid.UUID, fn func(ctx context.Context) error) error {
+	if !s.cfg.Database.RowLevelSecurity {
+		return fn(ctx)
+	}
+	return s.store.Scope(ctx, workspace, fn)
+}
+
+// serveScoped serves r limited to the workspace of its caller. With
+// row-level security on, the response is held back until the request's
+// transaction is committed, so that a failed commit can still turn it into
+// a 500. Callers without a workspace aren't scoped, which leaves them no
+// todos at all.
+func (s *Server) serveScoped(next http.Handler, w http.ResponseWriter, r *http.Request) {
+	if !s.cfg.Database.RowLevelSecurity || callerFrom(r.Context()).NoWorkspace {
+		next.ServeHTTP(w, r)
+		return
+	}
+	buf := &bufferedResponse{header: w.Header().Clone()}
+	err := s.store.Scope(r.Context(), workspace(r), func(ctx context.Context) error {
+		next.ServeHTTP(buf, r.WithContext(ctx))
+		if buf.status >= 400 {
+			return errFailedRequest
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errFailedRequest) {
+		writeStoreError(w, r, err, "Failed to save changes")
+		return
+	}
+	buf.flush(w)
+}
+
+// bufferedResponse is a ResponseWriter that keeps the response until flush.
+type bufferedResponse struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (b *bufferedResponse) Header() http.Header {
+	return b.header
+}
+
+func (b *bufferedResponse) WriteHeader(status int) {
+	if b.status == 0 {
+		b.status = status
+	}
+}
+
+func (b *bufferedResponse) Write(p []byte) (int, error) {
+	b.WriteHeader(http.StatusOK)
+	return b.body.Write(p)
+}
+
+// flush sends the response to w.
+func (b *bufferedResponse) flush(w http.ResponseWriter) {
+	h := w.Header()
+	clear(h)
+	maps.Copy(h, b.header)
+	if b.status == 0 {
+		b.status = http.StatusOK
+	}
+	w.WriteHeader(b.status)
+	w.Write(b.body.Bytes())
+}
@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"todo-api/auth"
+	"todo-api/store"
+)
+
+// SearchTodos runs a full-text search over titles and descriptions, best
+// match first. The q parameter takes words, "quoted phrases" and prefix*
+// terms; the status, due_date, filter and deleted-visibility parameters of
+// the list endpoint narrow the results down.
+func (s *Server) SearchTodos(w http.ResponseWriter, r *http.Request) {
+	if !s.authorize(w, r, auth.PermTodosRead) {
+		return
+	}
+	q := r.URL.Query().Get("q")
+	query := store.ParseSearch(q)
+	if query.Empty() {
+		writeError(w, r, http.StatusBadRequest, CodeBadRequest, "The q parameter must contain at least one word to search for")
+		return
+	}
+
+	opts, ok := s.listFilters(w, r)
+	if !ok {
+		return
+	}
+
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	limit := s.pageLimit(r, defaultPageSize)
+	if page < 1 {
+		page = 1
+	}
+	opts.Limit = limit
+	opts.Offset = (page - 1) * limit
+
+	hits, total, err := s.store.SearchTodos(r.Context(), query, opts)
+	if err != nil {
+		writeStoreError(w, r, err, "Unable to search todos")
+		return
+	}
+
+	response := map[string]interface{}{
+		"status":        200,
+		"query":         q,
+		"results":       hits,
+		"current_page":  page,
+		"total_pages":   (total + limit - 1) / limit,
+		"total_results": total,
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
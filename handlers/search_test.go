@@ -0,0 +1,37 @@
+package handlers_test
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func TestSearchTodos(t *testing.T) {
+	api := newTestAPI(t)
+	u := api.signUp("search@example.com", "")
+	other := api.signUp("other@example.com", "")
+	for _, title := range []string{"Renew passport", "Book flights", "Passport photos"} {
+		api.expect(api.do("POST", "/todos", u.Token, map[string]string{"title": title}), http.StatusCreated)
+	}
+	api.expect(api.do("POST", "/todos", other.Token, map[string]string{"title": "Passport of someone else"}), http.StatusCreated)
+
+	res := api.expect(api.do("GET", "/todos/search?q="+url.QueryEscape("passport"), u.Token, nil), http.StatusOK)
+	hits := items(res.Body, "results")
+	if len(hits) != 2 || res.Body["total_results"] != float64(2) {
+		t.Fatalf("results = %v, want the two passport todos of the caller", res.Body)
+	}
+	for _, hit := range hits {
+		if title := str(hit, "highlights", "title"); title != "Renew <mark>passport</mark>" && title != "<mark>Passport</mark> photos" {
+			t.Errorf("highlighted title = %q", title)
+		}
+	}
+
+	res = api.expect(api.do("GET", "/todos/search?q=passport&filter="+url.QueryEscape("title ~ photos"), u.Token, nil), http.StatusOK)
+	if hits := items(res.Body, "results"); len(hits) != 1 || str(hits[0], "todo", "title") != "Passport photos" {
+		t.Errorf("filtered results = %v, want Passport photos", res.Body["results"])
+	}
+
+	for _, q := range []string{"", "%20%22%22"} {
+		api.expect(api.do("GET", "/todos/search?q="+q, u.Token, nil), http.StatusBadRequest)
+	}
+}
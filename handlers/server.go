@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"todo-api/auth"
+	"todo-api/config"
+	"todo-api/models"
+	"todo-api/oidc"
+	"todo-api/store"
+)
+
+// Server holds the dependencies shared by every handler. Build one with
+// NewServer and pass it to routes.SetupRoutes; importing this package has no
+// side effects.
+type Server struct {
+	cfg       *config.Config
+	store     store.Store
+	audit     *auditWriter
+	workflow  *models.Workflow
+	cursors   *cursorCodec
+	tokens    *auth.Issuer
+	provider  *oidc.Provider       // nil unless sign-in through OIDC is configured
+	oidcRoles map[string]auth.Role // auth.oidc.roles, parsed
+}
+
+// NewServer returns a Server that reads and writes through st.
+func NewServer(cfg *config.Config, st store.Store) (*Server, error) {
+	workflow, err := models.NewWorkflow(cfg.Workflow.Transitions)
+	if err != nil {
+		return nil, fmt.Errorf("workflow.transitions: %w", err)
+	}
+	cursors, err := newCursorCodec(cfg.API.CursorSecret)
+	if err != nil {
+		return nil, err
+	}
+	tokens, err := auth.NewIssuer(cfg.Auth.JWTSecret, cfg.Auth.AccessTokenTTL)
+	if err != nil {
+		return nil, err
+	}
+	srv := &Server{cfg: cfg, store: st, audit: newAuditWriter(st, cfg.Database.RowLevelSecurity), workflow: workflow, cursors: cursors, tokens: tokens}
+	if o := cfg.Auth.OIDC; o.Enabled() {
+		srv.provider = oidc.NewProvider(oidc.Config{
+			Issuer:       o.Issuer,
+			ClientID:     o.ClientID,
+			ClientSecret: o.ClientSecret,
+			RedirectURL:  o.RedirectURL,
+			Scopes:       o.Scopes,
+		}, &http.Client{Timeout: providerTimeout})
+		if srv.oidcRoles, err = parseOIDCRoles(o.Roles); err != nil {
+			return nil, err
+		}
+	}
+	return srv, nil
+}
+
+// Close flushes pending audit log writes. Call it after the HTTP server has
+// stopped handing requests to s.
+func (s *Server) Close(ctx context.Context) error {
+	return s.audit.Close(ctx)
+}
+
+// todoID returns the todo ID from the {id} path segment, falling back to the
+// ?id= query parameter used by the legacy routes.
+func todoID(r *http.Request) string {
+	if id := r.PathValue("id"); id != "" {
+		return id
+	}
+	return r.URL.Query().Get("id")
+}
@@ -0,0 +1,50 @@
+package handlers_test
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"todo-api/config"
+	"todo-api/handlers"
+	"todo-api/store"
+)
+
+func TestNewServerRejectsBadConfig(t *testing.T) {
+	tests := []struct {
+		name      string
+		configure func(*config.Config)
+		field     string
+	}{
+		{"workflow with an unknown status", func(c *config.Config) {
+			c.Workflow.Transitions = map[string][]string{"pending": {"archived"}}
+		}, "workflow.transitions"},
+		{"OIDC claim mapped to an unknown role", func(c *config.Config) {
+			c.Auth.OIDC = config.OIDCConfig{Issuer: "https://idp.example.com", ClientID: "todo-api",
+				RedirectURL: "https://todo.example.com/auth/oidc/callback", RoleClaim: "groups",
+				Roles: map[string]string{"staff": "owner"}}
+		}, "auth.oidc.roles"},
+	}
+	for _, tt := range tests {
+		cfg := config.Default()
+		tt.configure(cfg)
+		if _, err := handlers.NewServer(cfg, store.NewMemory()); err == nil || !strings.HasPrefix(err.Error(), tt.field+":") {
+			t.Errorf("%s: NewServer error = %v, want one about %s", tt.name, err, tt.field)
+		}
+	}
+}
+
+// Each server reads and writes only the store it was given.
+func TestServersDoNotShareStores(t *testing.T) {
+	a, b := newTestAPI(t), newTestAPI(t)
+	u := a.signUp("a@example.com", "")
+	a.expect(a.do("POST", "/todos", u.Token, map[string]string{"title": "only in a"}), http.StatusCreated)
+
+	if todos, _, _ := a.store.ListTodos(context.Background(), store.ListOptions{}); len(todos) != 1 {
+		t.Errorf("store a has %d todos, want 1", len(todos))
+	}
+	if todos, _, _ := b.store.ListTodos(context.Background(), store.ListOptions{}); len(todos) != 0 {
+		t.Errorf("store b has %d todos, want none", len(todos))
+	}
+	b.expect(b.do("POST", "/auth/login", "", map[string]string{"email": "a@example.com", "password": testPassword}), http.StatusUnauthorized)
+}
@@ -1,534 +1,597 @@
 package handlers
 
 import (
-	"database/sql"
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"io"
+	"log/slog"
+	"mime"
 	"net/http"
 	"strconv"
 	"strings"
 	"time"
-	"todo-api/database"
+	"todo-api/auth"
+	"todo-api/filter"
+	"todo-api/jsonpatch"
 	"todo-api/models"
+	"todo-api/store"
 
 	"github.com/google/uuid"
 )
 
-var db *sql.DB
-
-func init() {
-
-	db = database.ConnectDB()
-	if db == nil {
-		log.Fatalf("Failed to connect to the database")
-	}
-}
-
-func LogAction(action string, todoID uuid.UUID, details string, message string) {
+// LogAction records an audit entry for a request that changed nothing, such
+// as a rejected write. The write happens in the background; failures are
+// logged but never fail the request. Successful writes record their entry in
+// the same transaction instead, with the fields they changed.
+func (s *Server) LogAction(action string, todoID uuid.UUID, message string, details string) {
 	// Log the action performed (e.g., create, update, delete)
-	query := `INSERT INTO logs (action, todo_id, message, details, timestamp) VALUES ($1, $2, $3, $4, NOW())`
-	_, err := db.Exec(query, action, todoID, message, details)
-	if err != nil {
-		log.Printf("Failed to log action: %v", err)
-	}
+	s.audit.Add(models.LogEntry{Action: action, TodoID: todoID, Message: message, Details: details})
 }
 
-func CreateTodo(w http.ResponseWriter, r *http.Request) {
+func (s *Server) CreateTodo(w http.ResponseWriter, r *http.Request) {
+	if !s.authorize(w, r, auth.PermTodosWrite) {
+		return
+	}
 	var todo models.Todo
 
 	// Decode the JSON request body
-	if err := json.NewDecoder(r.Body).Decode(&todo); err != nil {
-		log.Printf("Error decoding request body: %v", err) // Log the error for debugging
-		http.Error(w, "Invalid request payload", http.StatusBadRequest)
-		LogAction("create", uuid.Nil, "Invalid request payload", "Failed to decode JSON request body") // Log the error with nil UUID
+	if err := decodeJSON(w, r, &todo); err != nil {
+		slog.Debug("Error decoding request body", "err", err)                                            // Log the error for debugging
+		s.LogAction("create", uuid.Nil, "Invalid request payload", "Failed to decode JSON request body") // Log the error with nil UUID
+		return
+	}
+
+	// New todos start out pending unless told otherwise
+	if todo.Status == "" {
+		todo.Status = models.StatusPending
+	}
+	if errs := models.Validate(todo); len(errs) > 0 {
+		writeValidationError(w, r, errs)
+		s.LogAction("create", uuid.Nil, "Invalid todo", fmt.Sprintf("Validation failed: %d field error(s)", len(errs)))
 		return
 	}
 
 	// Generate a new UUID for the Todo item
 	todo.ID = uuid.New()
 
-	// Convert DueDate to string (YYYY-MM-DD) format
-	dueDateStr := todo.DueDate.Format("2006-01-02")
-
-	// Insert the todo into the database and return the inserted ID
-	query := `INSERT INTO todos (id, title, description, status, due_date, created_at, is_deleted)
-	          VALUES ($1, $2, $3, $4, $5, NOW(), FALSE) RETURNING id`
-	err := db.QueryRow(query, todo.ID, todo.Title, todo.Description, todo.Status, dueDateStr).Scan(&todo.ID)
-	if err != nil {
-		log.Printf("Error creating todo: %v", err) // Log error for debugging
-		http.Error(w, "Failed to create todo", http.StatusInternalServerError)
-		LogAction("create", uuid.Nil, "Failed to create todo", fmt.Sprintf("Error: %v", err)) // Log failure with nil UUID
+	// Todos belong to whoever creates them, in the workspace they work in; the
+	// admin token creates unowned ones, and admins working across every
+	// workspace create them outside any
+	c := callerFrom(r.Context())
+	todo.OwnerID, todo.WorkspaceID = nil, nil
+	if !c.adminToken() {
+		todo.OwnerID = &c.UserID
+	}
+	if c.WorkspaceID != uuid.Nil {
+		todo.WorkspaceID = &c.WorkspaceID
+	}
+	if !s.allowedStatus(w, r, todo) || !s.checkProject(w, r, todo) {
 		return
 	}
 
-	
+	// Lifecycle timestamps are managed by the server, not the client
+	todo.StartedAt, todo.CompletedAt = models.Timestamps(models.Todo{}, todo.Status, time.Now())
 
-	// Log the action with the correct UUID
-	LogAction("create", todo.ID, "Todo created", "Creation of new todo item")
+	// Insert the todo and its audit entry together
+	err := s.store.Atomic(r.Context(), func(tx store.Store) error {
+		if err := tx.CreateTodo(r.Context(), &todo); err != nil {
+			return err
+		}
+		return tx.AddLog(r.Context(), models.LogEntry{
+			Action: "create", TodoID: todo.ID, Message: "Todo created", Details: "Creation of new todo item",
+			Changes: models.Changes(nil, todo),
+		})
+	})
+	if err != nil {
+		writeStoreError(w, r, err, "Failed to create todo")
+		s.LogAction("create", uuid.Nil, "Failed to create todo", fmt.Sprintf("Error: %v", err)) // Log failure with nil UUID
+		return
+	}
 
 	// Respond with created todo
 	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", etag(todo))
+	w.Header().Set("Location", "/todos/"+todo.ID.String())
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(todo)
 }
 
-func GetTodos(w http.ResponseWriter, r *http.Request) {
-	// Fetch all todos without filtering or pagination
-	rows, err := db.Query("SELECT id, title, status,due_date,description FROM todos")
-	if err != nil {
-		http.Error(w, "Unable to fetch todos", http.StatusInternalServerError)
-		return
-	}
-	defer rows.Close()
-
-	var todos []models.Todo
-	for rows.Next() {
-		var todo models.Todo
-		if err := rows.Scan(&todo.ID, &todo.Title, &todo.Status, &todo.DueDate, &todo.Description); err != nil {
-			http.Error(w, "Unable to read todo", http.StatusInternalServerError)
-			return
+// listFilters reads the status, due_date, filter and deleted-visibility
+// query parameters shared by the list and search endpoints. On failure the
+// error response has been written and ok is false.
+func (s *Server) listFilters(w http.ResponseWriter, r *http.Request) (opts store.ListOptions, ok bool) {
+	queryParams := r.URL.Query()
+	opts.Status = queryParams.Get("status")
+	opts.Workspace = workspace(r)
+
+	// Todos of archived projects are only listed on request, or when their
+	// project is asked for by name
+	if id := queryParams.Get("project_id"); id != "" {
+		project, err := uuid.Parse(id)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, CodeInvalidID, "Invalid project_id")
+			return opts, false
 		}
-		todos = append(todos, todo)
+		opts.Project, opts.Archived = project, true
 	}
-
-	// If no todos are found, return a 404 status
-	if len(todos) == 0 {
-		response := map[string]interface{}{
-			"status":        "404 Not Found",
-			"message":       "No todos found",
-			"total_todos":   0,
-			"server_status": "OK",
+	if v := queryParams.Get("include_archived"); v != "" {
+		archived, err := strconv.ParseBool(v)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, CodeBadRequest, "include_archived must be true or false")
+			return opts, false
 		}
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusNotFound)
-		json.NewEncoder(w).Encode(response)
-		return
+		opts.Archived = opts.Archived || archived
 	}
 
-	// Prepare the response with the status, todos, and total count
-	response := map[string]interface{}{
-		"status":        "200 OK",
-		"todos":         todos,
-		"total_todos":   len(todos),
-		"server_status": "OK",
+	// Deleted todos are only listed on request
+	if opts.Deleted, ok = s.visibility(w, r); !ok {
+		return opts, false
 	}
 
-	// Set Content-Type header to JSON
-	w.Header().Set("Content-Type", "application/json")
+	if dueDate := queryParams.Get("due_date"); dueDate != "" {
+		parsed, err := time.Parse("2006-01-02", dueDate)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, CodeBadRequest, "Invalid due_date, expected YYYY-MM-DD")
+			return opts, false
+		}
+		opts.DueDate = &parsed
+	}
 
-	// Return the JSON response with 200 OK status
-	w.WriteHeader(http.StatusOK) // Set the status code to 200 OK
-	json.NewEncoder(w).Encode(response)
+	if src := queryParams.Get("filter"); src != "" {
+		expr, err := filter.Parse(src, store.FilterFields)
+		if err != nil {
+			p := NewProblem(http.StatusBadRequest, CodeInvalidFilter, err.Error())
+			var syntaxErr *filter.SyntaxError
+			if errors.As(err, &syntaxErr) {
+				p = p.With("position", syntaxErr.Pos)
+			}
+			writeProblem(w, r, p)
+			return opts, false
+		}
+		opts.Filter = expr
+	}
+	return opts, true
 }
-// GetTodosWithFilterSortPagination retrieves todos with filtering, sorting, and pagination
-func GetTodosWithFilterSortPagination(w http.ResponseWriter, r *http.Request) {
-	// Extract query parameters
-	queryParams := r.URL.Query()
 
-	page, err := strconv.Atoi(queryParams.Get("page"))
-	if err != nil || page < 1 {
-		page = 1 // Default page = 1
+// GetTodoByID retrieves a specific todo by ID
+func (s *Server) GetTodoByID(w http.ResponseWriter, r *http.Request) {
+	if !s.authorize(w, r, auth.PermTodosRead) {
+		return
 	}
+	idStr := todoID(r)
+	if idStr == "" {
+		status := http.StatusBadRequest
+		writeError(w, r, status, CodeInvalidID, "Missing ID parameter")
 
-	limit, err := strconv.Atoi(queryParams.Get("limit"))
-	if err != nil || limit < 1 {
-		limit = 10 // Default limit = 10
+		s.LogAction("fetch", uuid.Nil, "Missing ID parameter", fmt.Sprintf("Status: %d - Missing ID in the request", status))
+		return
 	}
 
-	status := queryParams.Get("status")
-	dueDate := queryParams.Get("due_date")
-	sortBy := queryParams.Get("sort_by")
-	sortOrder := queryParams.Get("sort_order")
-	isDeletedParam := queryParams.Get("is_deleted")
+	// Parse the ID into a UUID
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		status := http.StatusBadRequest
+		writeError(w, r, status, CodeInvalidID, "Invalid ID format")
 
-	// Validate sorting parameters
-	allowedSortFields := map[string]bool{"id": true, "title": true, "status": true, "due_date": true, "created_at": true}
-	if !allowedSortFields[sortBy] {
-		sortBy = "created_at" // Default sort field
-	}
-	if sortOrder != "ASC" {
-		sortOrder = "DESC" // Default sort order
+		s.LogAction("fetch", uuid.Nil, "Invalid ID format", fmt.Sprintf("Status: %d - Invalid UUID format", status))
+		return
 	}
 
-	offset := (page - 1) * limit
+	// Soft deleted todos are treated as missing unless asked for
+	vis, ok := s.visibility(w, r)
+	if !ok {
+		return
+	}
+	todo, err := s.getTodo(r, id, vis)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			writeStoreError(w, r, err, "Todo not found")
 
-	// **Prepare SQL Query with placeholders**
-	query := "SELECT id, title, description, status, due_date, created_at, is_deleted FROM todos WHERE 1=1"
-	args := []interface{}{}
-	argIndex := 1
+			s.LogAction("fetch", id, "Todo not found", fmt.Sprintf("Status: %d - Todo with the given ID does not exist", http.StatusNotFound))
+		} else {
+			status := http.StatusInternalServerError
+			writeStoreError(w, r, err, "Failed to fetch todo")
 
-	// Handle is_deleted filter
-	if isDeletedParam != "" {
-		isDeleted, err := strconv.ParseBool(isDeletedParam)
-		if err == nil {
-			query += fmt.Sprintf(" AND is_deleted = $%d", argIndex)
-			args = append(args, isDeleted)
-			argIndex++
-			
+			s.LogAction("fetch", id, "Failed to fetch todo", fmt.Sprintf("Status: %d - Error: %v", status, err))
 		}
+		return
 	}
 
-	if status != "" {
-		query += fmt.Sprintf(" AND status = $%d", argIndex)
-		args = append(args, status)
-		argIndex++
-	}
-	if dueDate != "" {
-		query += fmt.Sprintf(" AND due_date = $%d", argIndex)
-		args = append(args, dueDate)
-		argIndex++
+	// The ETag lets clients make conditional updates and revalidate cheaply
+	w.Header().Set("ETag", etag(todo))
+	if inm := r.Header.Get("If-None-Match"); inm != "" && matchesETag(inm, etag(todo)) {
+		w.WriteHeader(http.StatusNotModified)
+		return
 	}
 
-	// **Sorting**
-	query += fmt.Sprintf(" ORDER BY %s %s", sortBy, sortOrder)
+	// Successful response
+	status := http.StatusOK
+	response := map[string]interface{}{
+		"status":  status,
+		"message": "Todo fetched successfully",
+		"data":    todo,
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(response)
 
-	// **Pagination**
-	query += fmt.Sprintf(" LIMIT $%d OFFSET $%d", argIndex, argIndex+1)
-	args = append(args, limit, offset)
+	s.LogAction("fetch", todo.ID, "Todo fetched successfully", fmt.Sprintf("Status: %d - Todo: %v", status, todo.Title))
+}
 
-	// **Execute Query**
-	rows, err := db.Query(query, args...)
-	if err != nil {
-		http.Error(w, fmt.Sprintf("Unable to fetch todos: %v", err), http.StatusInternalServerError)
+// UpdateTodo is the legacy partial update behind PUT /update-todo: non-empty
+// fields in the body replace the stored ones, everything else is kept.
+func (s *Server) UpdateTodo(w http.ResponseWriter, r *http.Request) {
+	if !s.authorize(w, r, auth.PermTodosWrite) {
 		return
 	}
-	defer rows.Close()
-
-	var todos []models.Todo
-	for rows.Next() {
-		var todo models.Todo
-		if err := rows.Scan(&todo.ID, &todo.Title, &todo.Description, &todo.Status, &todo.DueDate, &todo.CreatedAt, &todo.IsDeleted); err != nil {
-			http.Error(w, "Unable to parse todo data", http.StatusInternalServerError)
-			return
-		}
-		todos = append(todos, todo)
+	// Step 1: Fetch previous todo details before updating
+	prevTodo, ok := s.loadTodo(w, r, true)
+	if !ok {
+		return
 	}
 
-	// **Count total todos for pagination**
-	countQuery := "SELECT COUNT(*) FROM todos WHERE 1=1"
-	countArgs := []interface{}{}
-	countIndex := 1
-
-	// Apply the same is_deleted filter for counting
-	if isDeletedParam != "" {
-		isDeleted, err := strconv.ParseBool(isDeletedParam)
-		if err == nil {
-			countQuery += fmt.Sprintf(" AND is_deleted = $%d", countIndex)
-			countArgs = append(countArgs, isDeleted)
-			countIndex++
-		}
+	// Step 2: Decode the new update request
+	var newTodo models.Todo
+	if err := decodeJSON(w, r, &newTodo); err != nil {
+		return
 	}
 
-	if status != "" {
-		countQuery += fmt.Sprintf(" AND status = $%d", countIndex)
-		countArgs = append(countArgs, status)
-		countIndex++
+	// Step 3: Overlay the provided fields; empty values are left untouched
+	next := prevTodo
+	if newTodo.Title != "" {
+		next.Title = newTodo.Title
+	}
+	if newTodo.Description != "" {
+		next.Description = newTodo.Description
 	}
-	if dueDate != "" {
-		countQuery += fmt.Sprintf(" AND due_date = $%d", countIndex)
-		countArgs = append(countArgs, dueDate)
-		countIndex++
+	if newTodo.Status != "" {
+		next.Status = newTodo.Status
+	}
+	if !newTodo.DueDate.IsZero() { // Correct way to check if DueDate is set
+		next.DueDate = newTodo.DueDate
 	}
 
-	var totalTodos int
-	err = db.QueryRow(countQuery, countArgs...).Scan(&totalTodos)
-	if err != nil {
-		http.Error(w, fmt.Sprintf("Unable to count todos: %v", err), http.StatusInternalServerError)
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(http.Error)
+	if newTodo.Title == "" && newTodo.Description == "" && newTodo.Status == "" && newTodo.DueDate.IsZero() {
+		writeError(w, r, http.StatusBadRequest, CodeBadRequest, "No fields to update")
 		return
 	}
 
-	// **Calculate total pages**
-	totalPages := (totalTodos + limit - 1) / limit
+	s.saveTodo(w, r, prevTodo, next)
+}
 
-	// **Prepare JSON Response**
-	response := map[string]interface{}{
-		"status":       200,
-		"todos":        todos,
-		"current_page": page,
-		"total_pages":  totalPages,
-		"total_todos":  totalTodos,
+// ReplaceTodo handles PUT /todos/{id}: the body is the complete new state of
+// the todo, so omitted fields are cleared (status falls back to pending).
+func (s *Server) ReplaceTodo(w http.ResponseWriter, r *http.Request) {
+	if !s.authorize(w, r, auth.PermTodosWrite) {
+		return
+	}
+	prevTodo, ok := s.loadTodo(w, r, true)
+	if !ok {
+		return
 	}
 
+	// Read-only fields such as id and created_at are accepted so a fetched
+	// todo can be sent back as is, but they are ignored.
+	var newTodo models.Todo
+	if err := decodeJSON(w, r, &newTodo); err != nil {
+		return
+	}
+	if newTodo.Status == "" {
+		newTodo.Status = models.StatusPending
+	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
-}
+	next := prevTodo
+	next.Title = newTodo.Title
+	next.Description = newTodo.Description
+	next.Status = newTodo.Status
+	next.DueDate = newTodo.DueDate
 
-// GetTodoByID retrieves a specific todo by ID
-func GetTodoByID(w http.ResponseWriter, r *http.Request) {
-	idStr := r.URL.Query().Get("id")
-	if idStr == "" {
-		status := http.StatusBadRequest
-		response := map[string]interface{}{
-			"status":  status,
-			"message": "Missing ID parameter",
-		}
-		w.WriteHeader(status)
-		json.NewEncoder(w).Encode(response)
+	s.saveTodo(w, r, prevTodo, next)
+}
 
-		LogAction("fetch", uuid.Nil, "Missing ID parameter", fmt.Sprintf("Status: %d - Missing ID in the request", status))
+// PatchTodo handles PATCH /todos/{id} with either a JSON Merge Patch
+// (RFC 7396) or a JSON Patch (RFC 6902), chosen by Content-Type. Patches
+// apply to the writable fields (title, description, status, due_date);
+// setting or removing a field to null clears it.
+func (s *Server) PatchTodo(w http.ResponseWriter, r *http.Request) {
+	if !s.authorize(w, r, auth.PermTodosWrite) {
 		return
 	}
+	w.Header().Set("Accept-Patch", jsonpatch.MergePatchType+", "+jsonpatch.JSONPatchType)
 
-	// Parse the ID into a UUID
-	id, err := uuid.Parse(idStr)
-	if err != nil {
-		status := http.StatusBadRequest
-		response := map[string]interface{}{
-			"status":  status,
-			"message": "Invalid ID format",
-		}
-		w.WriteHeader(status)
-		json.NewEncoder(w).Encode(response)
-
-		LogAction("fetch", uuid.Nil, "Invalid ID format", fmt.Sprintf("Status: %d - Invalid UUID format", status))
+	contentType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch contentType {
+	case jsonpatch.MergePatchType, jsonpatch.JSONPatchType, "application/json", "":
+	default:
+		writeError(w, r, http.StatusUnsupportedMediaType, CodeUnsupportedMediaType,
+			"PATCH accepts "+jsonpatch.MergePatchType+" or "+jsonpatch.JSONPatchType)
 		return
 	}
 
-	var todo models.Todo
-	query := "SELECT id, title, description, status, due_date, created_at, is_deleted FROM todos WHERE id = $1 AND is_deleted = false"
-	err = db.QueryRow(query, id).Scan(&todo.ID, &todo.Title, &todo.Description, &todo.Status, &todo.DueDate, &todo.CreatedAt, &todo.IsDeleted)
+	prevTodo, ok := s.loadTodo(w, r, true)
+	if !ok {
+		return
+	}
 
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodyBytes))
 	if err != nil {
-		if err == sql.ErrNoRows {
-			status := http.StatusNotFound
-			response := map[string]interface{}{
-				"status":  status,
-				"message": "Todo not found",
-			}
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(status)
-			json.NewEncoder(w).Encode(response)
-
-			LogAction("fetch", id, "Todo not found", fmt.Sprintf("Status: %d - Todo with the given ID does not exist", status))
-		} else {
-			status := http.StatusInternalServerError
-			response := map[string]interface{}{
-				"status":  status,
-				"message": "Failed to fetch todo",
-				"error":   err.Error(),
-			}
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(status)
-			json.NewEncoder(w).Encode(response)
-
-			LogAction("fetch", id, "Failed to fetch todo", fmt.Sprintf("Status: %d - Error: %v", status, err))
-		}
+		writeError(w, r, http.StatusRequestEntityTooLarge, CodeInvalidPayload, "Request body too large")
+		return
+	}
+	doc, err := json.Marshal(prevTodo.Input())
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, CodeInternal, "Failed to encode todo")
 		return
 	}
 
-	// Successful response
-	status := http.StatusOK
-	response := map[string]interface{}{
-		"status":  status,
-		"message": "Todo fetched successfully",
-		"data":    todo,
+	// Plain application/json is treated as a merge patch
+	var patched []byte
+	if contentType == jsonpatch.JSONPatchType {
+		patched, err = jsonpatch.Apply(doc, body)
+	} else {
+		patched, err = jsonpatch.Merge(doc, body)
+	}
+	if errors.Is(err, jsonpatch.ErrTestFailed) {
+		writeError(w, r, http.StatusConflict, CodeConflict, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidPatch, err.Error())
+		return
 	}
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(status)
-	json.NewEncoder(w).Encode(response)
 
-	LogAction("fetch", todo.ID, "Todo fetched successfully", fmt.Sprintf("Status: %d - Todo: %v", status, todo.Title))
-}
-// UpdateTodo updates a todo item and logs both previous and updated values.
-func UpdateTodo(w http.ResponseWriter, r *http.Request) {
-	id := r.URL.Query().Get("id")
-	if id == "" {
-		log.Println("[ERROR] Missing todo ID")
-		http.Error(w, "Missing todo ID", http.StatusBadRequest)
+	// Decode the result strictly so patches can't add unknown fields
+	var input models.TodoInput
+	dec := json.NewDecoder(bytes.NewReader(patched))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&input); err != nil {
+		writeError(w, r, http.StatusUnprocessableEntity, CodeValidation, "Patched todo is invalid: "+err.Error())
 		return
 	}
 
+	next := prevTodo
+	next.Title = input.Title
+	next.Description = input.Description
+	next.Status = input.Status
+	next.DueDate = input.DueDate
 
+	s.saveTodo(w, r, prevTodo, next)
+}
 
-	// Step 1: Fetch previous todo details before updating
-	var prevTodo models.Todo
-	prevQuery := "SELECT id, title, description, status, due_date, is_deleted FROM todos WHERE id = $1"
-	err := db.QueryRow(prevQuery, id).Scan(&prevTodo.ID, &prevTodo.Title, &prevTodo.Description, &prevTodo.Status, &prevTodo.DueDate, &prevTodo.IsDeleted)
+// loadTodo fetches the todo named in the request, deleted or not, and checks
+// If-Match against it. When live is set, a deleted todo is answered with 410
+// Gone. On failure the error response has been written and ok is false.
+func (s *Server) loadTodo(w http.ResponseWriter, r *http.Request, live bool) (todo models.Todo, ok bool) {
+	idStr := todoID(r)
+	if idStr == "" {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidID, "Missing todo ID")
+		return todo, false
+	}
+
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidID, "Invalid todo ID")
+		return todo, false
+	}
 
+	todo, err = s.getTodo(r, id, store.IncludeDeleted)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			log.Printf("[WARN] Todo ID: %s not found\n", id)
-			http.Error(w, "Todo not found", http.StatusNotFound)
+		if errors.Is(err, store.ErrNotFound) {
+			writeStoreError(w, r, err, "Todo not found")
 		} else {
-			log.Printf("[ERROR] Failed to fetch previous todo data: %v\n", err)
-			http.Error(w, "Failed to fetch previous todo data", http.StatusInternalServerError)
+			writeStoreError(w, r, err, "Failed to fetch previous todo data")
 		}
-		return
+		return todo, false
 	}
-
-	// Step 2: Decode the new update request
-	var newTodo models.Todo
-	if err := json.NewDecoder(r.Body).Decode(&newTodo); err != nil {
-		log.Printf("[ERROR] Invalid request payload: %v\n", err)
-		http.Error(w, "Invalid request payload", http.StatusBadRequest)
-		return
+	if !canChange(r, todo) {
+		writeNotOwner(w, r)
+		return todo, false
 	}
-	
-
-	// Step 3: Prepare the update query dynamically
-	query := "UPDATE todos SET "
-	var values []interface{}
-	var setClauses []string
-	paramIndex := 1
-
-	if newTodo.Title != "" {
-		setClauses = append(setClauses, fmt.Sprintf("title=$%d", paramIndex))
-		values = append(values, newTodo.Title)
-		paramIndex++
+	if live && todo.IsDeleted {
+		writeGone(w, r, todo)
+		return todo, false
 	}
-	if newTodo.Description != "" {
-		setClauses = append(setClauses, fmt.Sprintf("description=$%d", paramIndex))
-		values = append(values, newTodo.Description)
-		paramIndex++
+	if !s.checkIfMatch(w, r, todo) {
+		return todo, false
 	}
-	if newTodo.Status != "" {
-		setClauses = append(setClauses, fmt.Sprintf("status=$%d", paramIndex))
-		values = append(values, newTodo.Status)
-		paramIndex++
+	return todo, true
+}
+
+// writeNotOwner answers a change to a todo of someone else in the workspace
+// with 403.
+func writeNotOwner(w http.ResponseWriter, r *http.Request) {
+	writeError(w, r, http.StatusForbidden, CodeForbidden, "Only the owner of the todo or of its workspace can change it")
+}
+
+// writeGone answers a write to a soft deleted todo with 410 Gone, pointing
+// at the restore endpoint.
+func writeGone(w http.ResponseWriter, r *http.Request, todo models.Todo) {
+	writeProblem(w, r, NewProblem(http.StatusGone, CodeGone, "Todo has been deleted; restore it before changing it").
+		With("deleted_at", todo.DeletedAt).
+		With("restore", "/todos/"+todo.ID.String()+"/restore"))
+}
+
+// saveTodo validates the change from prevTodo to next, stores it and logs
+// both previous and updated values. A change that changes nothing is
+// neither validated, stored nor logged.
+func (s *Server) saveTodo(w http.ResponseWriter, r *http.Request, prevTodo, next models.Todo) {
+	update, fields := diffTodo(prevTodo, next)
+	if len(fields) == 0 {
+		writeTodoUpdate(w, "Todo unchanged", prevTodo, prevTodo)
+		return
 	}
 
-	if len(setClauses) == 0 {
-		log.Println("[WARN] No fields provided for update")
-		http.Error(w, "No fields to update", http.StatusBadRequest)
+	// Only the fields being changed are validated
+	if errs := models.Validate(next, fields...); len(errs) > 0 {
+		writeValidationError(w, r, errs)
 		return
 	}
-	if !newTodo.DueDate.IsZero() { // Correct way to check if DueDate is set
-		setClauses = append(setClauses, fmt.Sprintf("due_date=$%d", paramIndex))
-		values = append(values, newTodo.DueDate)
-		paramIndex++
+
+	// Status changes must follow the workflow and the workspace's settings
+	if update.Status != nil {
+		if !s.allowedStatus(w, r, next) {
+			return
+		}
+		if !s.workflow.CanTransition(prevTodo.Status, *update.Status) {
+			detail := fmt.Sprintf("Cannot change status from %s to %s", prevTodo.Status, *update.Status)
+			writeProblem(w, r, NewProblem(http.StatusConflict, CodeInvalidTransition, detail).
+				With("current_status", prevTodo.Status).
+				With("allowed_transitions", s.workflow.Next(prevTodo.Status)))
+			return
+		}
+		update.StartedAt, update.CompletedAt = models.Timestamps(prevTodo, *update.Status, time.Now())
 	}
-	
-	
 
-	query += strings.Join(setClauses, ", ") + fmt.Sprintf(" WHERE id=$%d RETURNING id, title, description, status, due_date", paramIndex)
-	values = append(values, id)
+	// Moving a todo to another project is audited as a move
+	action, message := "update", "Todo updated successfully"
+	if len(fields) == 1 && fields[0] == "project_id" {
+		action, message = "move", "Todo moved successfully"
+	}
 
-	// Step 4: Execute the update query and fetch new data
+	// Apply the update against the version that was read, so a concurrent
+	// edit can't be silently overwritten, and record it in the same transaction
 	var updatedTodo models.Todo
-	err = db.QueryRow(query, values...).Scan(&updatedTodo.ID, &updatedTodo.Title, &updatedTodo.Description, &updatedTodo.Status, &updatedTodo.DueDate)
+	err := s.store.Atomic(r.Context(), func(tx store.Store) error {
+		var err error
+		updatedTodo, err = tx.UpdateTodo(r.Context(), prevTodo.ID, prevTodo.Version, update)
+		if err != nil {
+			return err
+		}
+		return tx.AddLog(r.Context(), models.LogEntry{
+			Action: action, TodoID: updatedTodo.ID, Message: message,
+			Details: "Changed " + strings.Join(fields, ", "),
+			Changes: models.Changes(&prevTodo, updatedTodo),
+		})
+	})
+	if errors.Is(err, store.ErrStale) {
+		s.writeStaleTodo(w, r, prevTodo.ID)
+		return
+	}
 	if err != nil {
-		log.Printf("[ERROR] Failed to update todo: %v\n", err)
-		http.Error(w, "Failed to update todo", http.StatusInternalServerError)
+		writeStoreError(w, r, err, "Failed to update todo")
 		return
 	}
 
-	// Step 5: Log the update action with both previous and new data
-	logMessage := fmt.Sprintf(
-		"Todo Updated: [Prev] Title: %s, Description: %s, Status: %s → [New] Title: %s, Description: %s, Status: %s",
-		prevTodo.Title, prevTodo.Description, prevTodo.Status,
-		updatedTodo.Title, updatedTodo.Description, updatedTodo.Status,
-	)
-	LogAction("update", updatedTodo.ID, "Todo updated successfully", logMessage)
-
-	
+	writeTodoUpdate(w, message, prevTodo, updatedTodo)
+}
 
-	// Step 6: Return the response including both previous and updated values
+// writeTodoUpdate writes the response to an update: both previous and
+// updated values, with the ETag of the updated one.
+func writeTodoUpdate(w http.ResponseWriter, message string, prevTodo, updatedTodo models.Todo) {
 	response := map[string]interface{}{
-		"message":  "Todo updated successfully",
+		"message":  message,
 		"previous": prevTodo,
 		"updated":  updatedTodo,
 	}
 	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", etag(updatedTodo))
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(response)
 }
 
+// diffTodo returns the store update turning prev into next and the JSON
+// names of the fields that change.
+func diffTodo(prev, next models.Todo) (store.TodoUpdate, []string) {
+	var update store.TodoUpdate
+	var fields []string
+	if next.Title != prev.Title {
+		update.Title = &next.Title
+		fields = append(fields, "title")
+	}
+	if next.Description != prev.Description {
+		update.Description = &next.Description
+		fields = append(fields, "description")
+	}
+	if next.Status != prev.Status {
+		update.Status = &next.Status
+		fields = append(fields, "status")
+	}
+	if next.DueDate.Format("2006-01-02") != prev.DueDate.Format("2006-01-02") {
+		update.DueDate = &next.DueDate
+		fields = append(fields, "due_date")
+	}
+	if !models.SameID(next.ProjectID, prev.ProjectID) {
+		project := uuid.Nil
+		if next.ProjectID != nil {
+			project = *next.ProjectID
+		}
+		update.ProjectID = &project
+		fields = append(fields, "project_id")
+	}
+	return update, fields
+}
 
-func DeleteTodo(w http.ResponseWriter, r *http.Request) {
-	idStr := r.URL.Query().Get("id")
+func (s *Server) DeleteTodo(w http.ResponseWriter, r *http.Request) {
+	if !s.authorize(w, r, auth.PermTodosDelete) {
+		return
+	}
+	idStr := todoID(r)
 	if idStr == "" {
-		response := map[string]interface{}{
-			"status":  "error",
-			"message": "Missing ID parameter",
-		}
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(response)
-		LogAction("delete", uuid.Nil, "Missing ID parameter", "Failed to delete todo: No ID provided")
+		writeError(w, r, http.StatusBadRequest, CodeInvalidID, "Missing ID parameter")
+		s.LogAction("delete", uuid.Nil, "Missing ID parameter", "Failed to delete todo: No ID provided")
 		return
 	}
 
 	// Parse the UUID
 	id, err := uuid.Parse(idStr)
 	if err != nil {
-		response := map[string]interface{}{
-			"status":  "error",
-			"message": "Invalid ID format",
-		}
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(response)
-		LogAction("delete", uuid.Nil, "Invalid ID format", "Failed to delete todo: Invalid UUID format")
+		writeError(w, r, http.StatusBadRequest, CodeInvalidID, "Invalid ID format")
+		s.LogAction("delete", uuid.Nil, "Invalid ID format", "Failed to delete todo: Invalid UUID format")
 		return
 	}
 
 	// Fetch the todo details before deleting, including the is_deleted status
-	var todo struct {
-		ID          uuid.UUID `json:"id"`
-		Title       string    `json:"title"`
-		Description string    `json:"description"`
-		Status      string    `json:"status"`
-		DueDate     time.Time `json:"due_date"`
-		IsDeleted   bool      `json:"is_deleted"`
-	}
-
-	query := "SELECT id, title, description, status, due_date, is_deleted FROM todos WHERE id = $1"
-	err = db.QueryRow(query, id).Scan(&todo.ID, &todo.Title, &todo.Description, &todo.Status, &todo.DueDate, &todo.IsDeleted)
+	todo, err := s.getTodo(r, id, store.IncludeDeleted)
 
 	if err != nil {
-		if err == sql.ErrNoRows {
-			response := map[string]interface{}{
-				"status":  "error",
-				"message": "Todo not found or already deleted",
-			}
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusNotFound)
-			json.NewEncoder(w).Encode(response)
-			LogAction("delete", id, "Todo not found", "Failed to delete todo: Already deleted or does not exist")
+		if errors.Is(err, store.ErrNotFound) {
+			writeStoreError(w, r, err, "Todo not found or already deleted")
+			s.LogAction("delete", id, "Todo not found", "Failed to delete todo: Already deleted or does not exist")
 			return
 		}
 
-		response := map[string]interface{}{
-			"status":  "error",
-			"message": "Database error",
-		}
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(response)
+		writeStoreError(w, r, err, "Database error")
 		return
 	}
 
-	// If the todo is already marked as deleted, return a conflict response
+	if !canChange(r, todo) {
+		writeNotOwner(w, r)
+		return
+	}
+
+	// If the todo is already marked as deleted, it is gone
 	if todo.IsDeleted {
-		response := map[string]interface{}{
-			"status":  "error",
-			"message": "Todo is already deleted",
-			"todo":    todo, // Include the existing todo data for verification
-		}
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusConflict) // 409 Conflict
-		json.NewEncoder(w).Encode(response)
-		LogAction("delete", id, "Todo already deleted", fmt.Sprintf("Todo ID: %s is already marked as deleted", id))
+		writeGone(w, r, todo)
+		s.LogAction("delete", id, "Todo already deleted", fmt.Sprintf("Todo ID: %s is already marked as deleted", id))
 		return
 	}
 
-	// Perform a soft delete
-	query = "UPDATE todos SET is_deleted = TRUE WHERE id = $1"
-	_, err = db.Exec(query, id)
-	if err != nil {
-		response := map[string]interface{}{
-			"status":  "error",
-			"message": "Failed to delete todo",
-		}
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(response)
+	if !s.checkIfMatch(w, r, todo) {
 		return
 	}
 
-	LogAction("delete", id, "Todo deleted", "Successfully marked todo as deleted")
+	// Perform a soft delete and record it in the same transaction
+	err = s.store.Atomic(r.Context(), func(tx store.Store) error {
+		if err := tx.DeleteTodo(r.Context(), id, todo.Version); err != nil {
+			return err
+		}
+		deleted := todo
+		deleted.IsDeleted = true
+		return tx.AddLog(r.Context(), models.LogEntry{
+			Action: "delete", TodoID: id, Message: "Todo deleted", Details: "Successfully marked todo as deleted",
+			Changes: models.Changes(&todo, deleted),
+		})
+	})
+	if errors.Is(err, store.ErrStale) {
+		s.writeStaleTodo(w, r, id)
+		return
+	}
+	if err != nil {
+		writeStoreError(w, r, err, "Failed to delete todo")
+		return
+	}
 
 	// Return success response with deleted todo details
 	response := map[string]interface{}{
@@ -541,72 +604,72 @@ func DeleteTodo(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(response)
 }
 
-func GetAllLogs(w http.ResponseWriter, r *http.Request) {
-	// Parse query parameters
-	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
-	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+// GetAllLogs returns the audit trail of every todo in the caller's
+// workspace. Like the per-todo logs it needs logs:read, which only admins
+// have.
+func (s *Server) GetAllLogs(w http.ResponseWriter, r *http.Request) {
+	if !s.authorize(w, r, auth.PermLogsRead) {
+		return
+	}
 	action := r.URL.Query().Get("action") // Action filter
+	s.writeLogs(w, r, store.LogListOptions{Action: action, Workspace: workspace(r)})
+}
 
-	// Set defaults if not provided
-	if page < 1 {
-		page = 1
+// GetTodoLogs returns the audit trail of a single todo, newest first
+func (s *Server) GetTodoLogs(w http.ResponseWriter, r *http.Request) {
+	if !s.authorize(w, r, auth.PermLogsRead) {
+		return
 	}
-	if limit < 1 {
-		limit = 10 // Default limit per page
+	id, err := uuid.Parse(todoID(r))
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidID, "Invalid todo ID")
+		return
 	}
 
-	offset := (page - 1) * limit // Calculate offset for pagination
-
-	// Query to get total records (with action filter)
-	var totalRecords int
-	countQuery := "SELECT COUNT(*) FROM logs WHERE 1=1"
-	logsQuery := "SELECT id, todo_id, action, timestamp FROM logs WHERE 1=1"
-
-	var args []interface{}
-	argIndex := 1
-
-	// Add action filter if provided
-	if action != "" {
-		countQuery += " AND action = $" + strconv.Itoa(argIndex)
-		logsQuery += " AND action = $" + strconv.Itoa(argIndex)
-		args = append(args, action)
-		argIndex++
+	// The audit trail outlives deletion, so deleted todos keep their logs
+	if _, err := s.getTodo(r, id, store.IncludeDeleted); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			writeStoreError(w, r, err, "Todo not found")
+		} else {
+			writeStoreError(w, r, err, "Failed to fetch todo")
+		}
+		return
 	}
 
-	// Finalize queries with pagination
-	countErr := db.QueryRow(countQuery, args...).Scan(&totalRecords)
-	if countErr != nil {
-		http.Error(w, "Failed to fetch total log count", http.StatusInternalServerError)
+	action := r.URL.Query().Get("action") // Action filter
+	s.writeLogs(w, r, store.LogListOptions{Action: action, TodoID: &id})
+}
+
+// writeLogs responds with the page of logs narrowed down by opts. Pages are
+// selected with signed cursors, or with the page and limit query parameters
+// when page is given.
+func (s *Server) writeLogs(w http.ResponseWriter, r *http.Request, opts store.LogListOptions) {
+	if r.URL.Query().Get("page") == "" {
+		s.writeLogPage(w, r, opts)
 		return
 	}
 
-	// Calculate total pages
-	totalPages := (totalRecords + limit - 1) / limit // Ensures rounding up
+	// Parse query parameters
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	limit := s.pageLimit(r, defaultPageSize)
 
-	// Append ORDER BY, LIMIT, OFFSET
-	logsQuery += " ORDER BY timestamp DESC LIMIT $" + strconv.Itoa(argIndex) + " OFFSET $" + strconv.Itoa(argIndex+1)
-	args = append(args, limit, offset)
+	// Set defaults if not provided
+	if page < 1 {
+		page = 1
+	}
+
+	opts.Limit = limit
+	opts.Offset = (page - 1) * limit // Calculate offset for pagination
 
-	// Execute logs query
-	rows, err := db.Query(logsQuery, args...)
+	// Fetch the page of logs and the total number of records
+	logs, totalRecords, err := s.store.ListLogs(r.Context(), opts)
 	if err != nil {
-		http.Error(w, "Failed to fetch logs", http.StatusInternalServerError)
+		writeStoreError(w, r, err, "Failed to fetch logs")
 		return
 	}
-	
-	defer rows.Close()
 
-	var logs []models.Log
-	for rows.Next() {
-		var log models.Log
-		if err := rows.Scan(&log.ID, &log.TodoID, &log.Action, &log.Timestamp); err != nil {
-			http.Error(w, "Error scanning log", http.StatusInternalServerError)
-			w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(http.StatusInternalServerError)
-			return
-		}
-		logs = append(logs, log)
-	}
+	// Calculate total pages
+	totalPages := (totalRecords + limit - 1) / limit // Ensures rounding up
 
 	// Response JSON structure
 	response := models.LogResponse{
@@ -619,4 +682,36 @@ func GetAllLogs(w http.ResponseWriter, r *http.Request) {
 	// JSON Response
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
-}
\ No newline at end of file
+}
+
+// writeLogPage responds with the cursor-selected page of the logs matching
+// opts, newest first.
+func (s *Server) writeLogPage(w http.ResponseWriter, r *http.Request, opts store.LogListOptions) {
+	query := fmt.Sprintf("logs|%s|%v", opts.Action, opts.TodoID)
+	req, ok := s.parsePage(w, r, query, defaultPageSize)
+	if !ok {
+		return
+	}
+	opts.Limit = req.Limit + 1 // one extra tells whether there is a next page
+	opts.Page = req.Keyset
+	opts.SkipCount = !req.IncludeTotal
+
+	logs, totalRecords, err := s.store.ListLogs(r.Context(), opts)
+	if err != nil {
+		writeStoreError(w, r, err, "Failed to fetch logs")
+		return
+	}
+	logs, hasNext, hasPrev := trimPage(logs, req)
+
+	response := models.LogPage{Logs: logs, PageSize: req.Limit}
+	if len(logs) > 0 {
+		response.NextCursor, response.PrevCursor, response.Links = s.pageLinks(w, r, req,
+			store.LogCursor(logs[0]), store.LogCursor(logs[len(logs)-1]), hasNext, hasPrev)
+	}
+	if req.IncludeTotal {
+		response.TotalRecords = &totalRecords
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,74 @@
+package handlers_test
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestCreateTodoValidation(t *testing.T) {
+	api := newTestAPI(t)
+	u := api.signUp("validate@example.com", "")
+
+	tests := []struct {
+		name   string
+		body   string
+		code   int
+		errors []string // field:code of each error
+	}{
+		{name: "valid", body: `{"title":"ok"}`, code: http.StatusCreated},
+		{name: "missing title", body: `{"description":"no title"}`, code: http.StatusUnprocessableEntity, errors: []string{"title:required"}},
+		{name: "several fields", body: `{"title":"","status":"archived"}`, code: http.StatusUnprocessableEntity,
+			errors: []string{"title:required", "status:invalid_choice"}},
+		{name: "unknown field", body: `{"title":"t","priority":1}`, code: http.StatusUnprocessableEntity, errors: []string{"priority:unknown_field"}},
+		{name: "wrong type", body: `{"title":42}`, code: http.StatusUnprocessableEntity, errors: []string{"title:invalid_type"}},
+		{name: "malformed", body: `{"title":`, code: http.StatusBadRequest},
+		{name: "two objects", body: `{"title":"a"}{"title":"b"}`, code: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := api.expect(api.do("POST", "/todos", u.Token, tt.body), tt.code)
+			if tt.code == http.StatusCreated {
+				if str(res.Body, "status") != "pending" {
+					t.Errorf("status = %q, want new todos to be pending", str(res.Body, "status"))
+				}
+				return
+			}
+			var got []string
+			for _, fe := range items(res.Body, "errors") {
+				got = append(got, str(fe, "field")+":"+str(fe, "code"))
+			}
+			if !reflect.DeepEqual(got, tt.errors) {
+				t.Errorf("errors = %v, want %v", got, tt.errors)
+			}
+		})
+	}
+}
+
+func TestStatusTransitions(t *testing.T) {
+	api := newTestAPI(t)
+	u := api.signUp("workflow@example.com", "")
+	id := str(api.expect(api.do("POST", "/todos", u.Token, map[string]string{"title": "work"}), http.StatusCreated).Body, "id")
+	path := "/todos/" + id
+
+	res := api.expect(api.do("PATCH", path, u.Token, `{"status":"done"}`), http.StatusConflict)
+	if str(res.Body, "code") != "invalid_transition" || str(res.Body, "current_status") != "pending" {
+		t.Errorf("pending -> done: %v, want invalid_transition from pending", res.Body)
+	}
+	if allowed, _ := res.Body["allowed_transitions"].([]interface{}); len(allowed) != 3 {
+		t.Errorf("allowed_transitions = %v, want the three next statuses", res.Body["allowed_transitions"])
+	}
+
+	started := api.expect(api.do("PATCH", path, u.Token, `{"status":"in_progress"}`), http.StatusOK)
+	if updated, _ := started.Body["updated"].(map[string]interface{}); updated["started_at"] == nil || updated["completed_at"] != nil {
+		t.Errorf("after starting: %v, want started_at set and no completed_at", updated)
+	}
+	done := api.expect(api.do("PATCH", path, u.Token, `{"status":"done"}`), http.StatusOK)
+	if updated, _ := done.Body["updated"].(map[string]interface{}); updated["completed_at"] == nil {
+		t.Errorf("after finishing: %v, want completed_at set", updated)
+	}
+	reopened := api.expect(api.do("PATCH", path, u.Token, `{"status":"in_progress"}`), http.StatusOK)
+	if updated, _ := reopened.Body["updated"].(map[string]interface{}); updated["completed_at"] != nil {
+		t.Errorf("after reopening: %v, want completed_at cleared", updated)
+	}
+}
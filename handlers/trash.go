@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"todo-api/auth"
+	"todo-api/models"
+	"todo-api/store"
+)
+
+// GetTrash lists soft deleted todos, most recently deleted first.
+func (s *Server) GetTrash(w http.ResponseWriter, r *http.Request) {
+	if !s.authorize(w, r, auth.PermTodosTrash) {
+		return
+	}
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	limit := s.pageLimit(r, defaultPageSize)
+	if page < 1 {
+		page = 1
+	}
+
+	todos, totalTodos, err := s.store.ListTodos(r.Context(), store.ListOptions{
+		Deleted:   store.OnlyDeleted,
+		Workspace: workspace(r),
+		Archived:  true, // the trash shows everything that can be restored
+		Sort:      []store.SortTerm{{Field: "deleted_at", Desc: true}},
+		Limit:     limit,
+		Offset:    (page - 1) * limit,
+	})
+	if err != nil {
+		writeStoreError(w, r, err, "Unable to fetch deleted todos")
+		return
+	}
+	if todos == nil {
+		todos = []models.Todo{} // encodes as [] when the trash is empty
+	}
+
+	response := map[string]interface{}{
+		"status":       200,
+		"todos":        todos,
+		"current_page": page,
+		"total_pages":  (totalTodos + limit - 1) / limit,
+		"total_todos":  totalTodos,
+	}
+	if period := s.cfg.Retention.TrashPeriod; period > 0 {
+		response["retention_period"] = period.String()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// RestoreTodo takes a todo back out of the trash.
+func (s *Server) RestoreTodo(w http.ResponseWriter, r *http.Request) {
+	if !s.authorize(w, r, auth.PermTodosWrite) {
+		return
+	}
+	todo, ok := s.loadTodo(w, r, false)
+	if !ok {
+		return
+	}
+	if !todo.IsDeleted {
+		writeProblem(w, r, NewProblem(http.StatusConflict, CodeConflict, "Todo is not deleted").With("todo", todo))
+		return
+	}
+
+	var restored models.Todo
+	err := s.store.Atomic(r.Context(), func(tx store.Store) error {
+		if err := tx.RestoreTodo(r.Context(), todo.ID, todo.Version); err != nil {
+			return err
+		}
+		var err error
+		if restored, err = tx.GetTodo(r.Context(), todo.ID, store.IncludeDeleted); err != nil {
+			return err
+		}
+		return tx.AddLog(r.Context(), models.LogEntry{
+			Action: "restore", TodoID: todo.ID, Message: "Todo restored", Details: "Taken back out of the trash",
+			Changes: models.Changes(&todo, restored),
+		})
+	})
+	if errors.Is(err, store.ErrStale) {
+		s.writeStaleTodo(w, r, todo.ID)
+		return
+	}
+	if err != nil {
+		writeStoreError(w, r, err, "Failed to restore todo")
+		return
+	}
+
+	response := map[string]interface{}{
+		"status":  "success",
+		"message": "Todo restored successfully",
+		"todo":    restored,
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", etag(restored))
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// PurgeTodo permanently removes a todo from the trash. Only admins may purge,
+// and only todos that were deleted first. The audit trail is kept.
+func (s *Server) PurgeTodo(w http.ResponseWriter, r *http.Request) {
+	if !s.authorize(w, r, auth.PermTodosPurge) {
+		return
+	}
+	todo, ok := s.loadTodo(w, r, false)
+	if !ok {
+		return
+	}
+	if !todo.IsDeleted {
+		writeProblem(w, r, NewProblem(http.StatusConflict, CodeConflict, "Only deleted todos can be purged; delete it first").With("todo", todo))
+		return
+	}
+
+	err := s.store.Atomic(r.Context(), func(tx store.Store) error {
+		if err := tx.PurgeTodo(r.Context(), todo.ID, todo.Version); err != nil {
+			return err
+		}
+		return tx.AddLog(r.Context(), models.LogEntry{
+			Action: "purge", TodoID: todo.ID, WorkspaceID: todo.WorkspaceID, Message: "Todo purged",
+			Details: "Permanently removed from the trash by an admin",
+		})
+	})
+	if errors.Is(err, store.ErrStale) {
+		s.writeStaleTodo(w, r, todo.ID)
+		return
+	}
+	if err != nil {
+		writeStoreError(w, r, err, "Failed to purge todo")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
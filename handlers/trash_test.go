@@ -0,0 +1,57 @@
+package handlers_test
+
+import (
+	"net/http"
+	"testing"
+	"todo-api/config"
+)
+
+func TestRestoreAndPurge(t *testing.T) {
+	api := newTestAPI(t)
+	member := api.signUp("trash@example.com", "")
+	id := str(api.expect(api.do("POST", "/todos", member.Token, map[string]string{"title": "oops"}), http.StatusCreated).Body, "id")
+	path := "/todos/" + id
+
+	api.expect(api.do("POST", path+"/restore", member.Token, nil), http.StatusConflict)
+	api.expect(api.do("DELETE", "/todos/trash/"+id, adminToken, nil), http.StatusConflict)
+
+	api.expect(api.do("DELETE", path, member.Token, nil), http.StatusOK)
+	res := api.expect(api.do("POST", path+"/restore", member.Token, nil, "If-Match", `"2"`), http.StatusOK)
+	if restored, _ := res.Body["todo"].(map[string]interface{}); restored["is_deleted"] != false || restored["deleted_at"] != nil ||
+		res.Header.Get("ETag") != `"3"` {
+		t.Errorf("restored todo = %v with ETag %s, want it live at version 3", restored, res.Header.Get("ETag"))
+	}
+	api.expect(api.do("GET", path, member.Token, nil), http.StatusOK)
+
+	// Only admins purge, and the audit trail outlives the todo
+	api.expect(api.do("DELETE", path, member.Token, nil), http.StatusOK)
+	api.expect(api.do("DELETE", "/todos/trash/"+id, member.Token, nil), http.StatusForbidden)
+	api.expect(api.do("DELETE", "/todos/trash/"+id, adminToken, nil), http.StatusNoContent)
+	api.expect(api.do("GET", path, adminToken, nil), http.StatusNotFound)
+	api.expect(api.do("POST", path+"/restore", member.Token, nil), http.StatusNotFound)
+
+	actions, _ := api.mutationLogs(id)
+	if got := len(actions); got != 5 || actions[4] != "purge" {
+		t.Errorf("logged actions = %v, want create, delete, restore, delete and purge", actions)
+	}
+}
+
+func TestTrashListing(t *testing.T) {
+	api := newTestAPI(t, func(cfg *config.Config) { cfg.API.MaxPageSize = 2 })
+	u := api.signUp("binned@example.com", "")
+
+	// An empty trash lists no todos rather than null
+	res := api.expect(api.do("GET", "/todos/trash", adminToken, nil), http.StatusOK)
+	if todos, ok := res.Body["todos"].([]interface{}); !ok || len(todos) != 0 {
+		t.Errorf("empty trash = %v, want an empty todos array", res.Body)
+	}
+
+	for _, title := range []string{"a", "b", "c"} {
+		id := str(api.expect(api.do("POST", "/todos", u.Token, map[string]string{"title": title}), http.StatusCreated).Body, "id")
+		api.expect(api.do("DELETE", "/todos/"+id, u.Token, nil), http.StatusOK)
+	}
+	res = api.expect(api.do("GET", "/todos/trash?limit=100", adminToken, nil), http.StatusOK)
+	if len(items(res.Body, "todos")) != 2 || res.Body["total_pages"] != float64(2) || res.Body["total_todos"] != float64(3) {
+		t.Errorf("trash = %v, want pages capped at two todos", res.Body)
+	}
+}
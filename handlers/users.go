@@ -0,0 +1,309 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+	"todo-api/auth"
+	"todo-api/models"
+	"todo-api/store"
+
+	"github.com/google/uuid"
+)
+
+// credentials is the body of register and login requests.
+type credentials struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+// refreshRequest is the body of refresh and logout requests.
+type refreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// tokenResponse hands a signed-in client its tokens, in the shape of an
+// OAuth 2 token response.
+type tokenResponse struct {
+	AccessToken  string       `json:"access_token"`
+	TokenType    string       `json:"token_type"`
+	ExpiresIn    int          `json:"expires_in"`
+	RefreshToken string       `json:"refresh_token"`
+	User         *models.User `json:"user,omitempty"`
+}
+
+// Register creates an account and signs it in.
+func (s *Server) Register(w http.ResponseWriter, r *http.Request) {
+	var body credentials
+	if err := decodeJSON(w, r, &body); err != nil {
+		return
+	}
+	email := normalizeEmail(body.Email)
+	if errs := validateCredentials(email, body.Password); len(errs) > 0 {
+		writeValidationError(w, r, errs)
+		return
+	}
+
+	hash, err := auth.HashPassword(body.Password)
+	if err != nil {
+		writeStoreError(w, r, err, "Failed to create account")
+		return
+	}
+	// Every account starts with a personal workspace
+	user := models.User{ID: uuid.New(), Email: email, PasswordHash: hash, Role: string(auth.DefaultRole)}
+	err = s.store.Atomic(r.Context(), func(tx store.Store) error {
+		if err := tx.CreateUser(r.Context(), &user); err != nil {
+			return err
+		}
+		_, err := createPersonalWorkspace(r.Context(), tx, user.ID)
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, store.ErrConflict) {
+			writeError(w, r, http.StatusConflict, CodeConflict, "An account with this email already exists")
+			return
+		}
+		writeStoreError(w, r, err, "Failed to create account")
+		return
+	}
+
+	tokens, err := s.issueTokens(r, s.store, user, uuid.New())
+	if err != nil {
+		writeStoreError(w, r, err, "Failed to sign in")
+		return
+	}
+	tokens.User = &user
+	writeTokens(w, http.StatusCreated, tokens)
+}
+
+// Login exchanges an email and password for tokens.
+func (s *Server) Login(w http.ResponseWriter, r *http.Request) {
+	var body credentials
+	if err := decodeJSON(w, r, &body); err != nil {
+		return
+	}
+
+	user, err := s.store.GetUserByEmail(r.Context(), normalizeEmail(body.Email))
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		writeStoreError(w, r, err, "Failed to sign in")
+		return
+	}
+	// Unknown accounts are checked against no hash, which takes as long
+	// as a wrong password, so responses don't reveal which emails exist.
+	if !auth.CheckPassword(user.PasswordHash, body.Password) {
+		writeError(w, r, http.StatusUnauthorized, CodeUnauthorized, "Wrong email or password")
+		return
+	}
+
+	tokens, err := s.issueTokens(r, s.store, user, uuid.New())
+	if err != nil {
+		writeStoreError(w, r, err, "Failed to sign in")
+		return
+	}
+	tokens.User = &user
+	writeTokens(w, http.StatusOK, tokens)
+}
+
+// Refresh exchanges a refresh token for new tokens. Each refresh token
+// works once; presenting a spent one again means it leaked, so every token
+// from the same login is revoked.
+func (s *Server) Refresh(w http.ResponseWriter, r *http.Request) {
+	var body refreshRequest
+	if err := decodeJSON(w, r, &body); err != nil {
+		return
+	}
+
+	now := time.Now()
+	token, err := s.store.GetRefreshToken(r.Context(), auth.HashRefreshToken(body.RefreshToken))
+	if errors.Is(err, store.ErrNotFound) || err == nil && now.After(token.ExpiresAt) {
+		writeError(w, r, http.StatusUnauthorized, CodeUnauthorized, "Invalid or expired refresh token; sign in again")
+		return
+	}
+	if err != nil {
+		writeStoreError(w, r, err, "Failed to refresh tokens")
+		return
+	}
+	// The new access token carries the user's current role.
+	user, err := s.store.GetUser(r.Context(), token.UserID)
+	if err != nil {
+		writeStoreError(w, r, err, "Failed to refresh tokens")
+		return
+	}
+
+	var tokens tokenResponse
+	err = s.store.Atomic(r.Context(), func(tx store.Store) error {
+		if err := tx.RevokeRefreshToken(r.Context(), token.ID, now); err != nil {
+			return err
+		}
+		tokens, err = s.issueTokens(r, tx, user, token.Family)
+		return err
+	})
+	if errors.Is(err, store.ErrConflict) {
+		if err := s.store.RevokeTokenFamily(r.Context(), token.Family, now); err != nil {
+			writeStoreError(w, r, err, "Failed to revoke tokens")
+			return
+		}
+		writeError(w, r, http.StatusUnauthorized, CodeUnauthorized, "Refresh token was already used; sign in again")
+		return
+	}
+	if err != nil {
+		writeStoreError(w, r, err, "Failed to refresh tokens")
+		return
+	}
+	writeTokens(w, http.StatusOK, tokens)
+}
+
+// Logout revokes a refresh token and every token descended from the same
+// login. Access tokens stay valid until they expire.
+func (s *Server) Logout(w http.ResponseWriter, r *http.Request) {
+	var body refreshRequest
+	if err := decodeJSON(w, r, &body); err != nil {
+		return
+	}
+	token, err := s.store.GetRefreshToken(r.Context(), auth.HashRefreshToken(body.RefreshToken))
+	if err == nil {
+		err = s.store.RevokeTokenFamily(r.Context(), token.Family, time.Now())
+	}
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		writeStoreError(w, r, err, "Failed to sign out")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetMe returns the signed-in user.
+func (s *Server) GetMe(w http.ResponseWriter, r *http.Request) {
+	c := callerFrom(r.Context())
+	if c.adminToken() {
+		writeError(w, r, http.StatusNotFound, CodeNotFound, "The admin token does not belong to a user")
+		return
+	}
+	user, err := s.store.GetUser(r.Context(), c.UserID)
+	if err != nil {
+		writeStoreError(w, r, err, "User not found")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(user)
+}
+
+// issueTokens signs user in with a new access token and a refresh token in
+// family, which it saves through st.
+func (s *Server) issueTokens(r *http.Request, st store.Store, user models.User, family uuid.UUID) (tokenResponse, error) {
+	now := time.Now()
+	refresh, hash, err := auth.NewRefreshToken()
+	if err != nil {
+		return tokenResponse{}, err
+	}
+	err = st.AddRefreshToken(r.Context(), models.RefreshToken{
+		ID:        uuid.New(),
+		UserID:    user.ID,
+		Family:    family,
+		TokenHash: hash,
+		ExpiresAt: now.Add(s.cfg.Auth.RefreshTokenTTL),
+	})
+	if err != nil {
+		return tokenResponse{}, err
+	}
+	return tokenResponse{
+		AccessToken:  s.tokens.Issue(user.ID, auth.Role(user.Role), now),
+		TokenType:    "Bearer",
+		ExpiresIn:    int(s.tokens.TTL().Seconds()),
+		RefreshToken: refresh,
+	}, nil
+}
+
+// roleRequest is the body of a request changing the role of a user.
+type roleRequest struct {
+	Role string `json:"role"`
+}
+
+// ListUsers lists every account.
+func (s *Server) ListUsers(w http.ResponseWriter, r *http.Request) {
+	if !s.authorize(w, r, auth.PermUsersAdmin) {
+		return
+	}
+	users, err := s.store.ListUsers(r.Context())
+	if err != nil {
+		writeStoreError(w, r, err, "Unable to fetch users")
+		return
+	}
+	if users == nil {
+		users = []models.User{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"users": users})
+}
+
+// SetUserRole changes the role of a user. Their API keys use the new role
+// at once; access tokens keep the old one until they are refreshed.
+func (s *Server) SetUserRole(w http.ResponseWriter, r *http.Request) {
+	if !s.authorize(w, r, auth.PermUsersAdmin) {
+		return
+	}
+	id, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidID, "Invalid ID format")
+		return
+	}
+	var body roleRequest
+	if err := decodeJSON(w, r, &body); err != nil {
+		return
+	}
+	if _, err := auth.ParseRole(body.Role); err != nil {
+		writeValidationError(w, r, []models.FieldError{{Field: "role", Code: "oneof",
+			Message: fmt.Sprintf("role must be one of %v", auth.Roles)}})
+		return
+	}
+	if c := callerFrom(r.Context()); c.UserID == id && body.Role != string(auth.RoleAdmin) {
+		writeError(w, r, http.StatusConflict, CodeConflict, "Admins cannot demote themselves")
+		return
+	}
+
+	if err := s.store.SetUserRole(r.Context(), id, body.Role); err != nil {
+		writeStoreError(w, r, err, "User not found")
+		return
+	}
+	user, err := s.store.GetUser(r.Context(), id)
+	if err != nil {
+		writeStoreError(w, r, err, "User not found")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(user)
+}
+
+func writeTokens(w http.ResponseWriter, status int, tokens tokenResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(tokens)
+}
+
+// normalizeEmail makes emails compare case-insensitively.
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// validateCredentials checks a new account's email and password.
+func validateCredentials(email, password string) []models.FieldError {
+	var errs []models.FieldError
+	switch {
+	case email == "":
+		errs = append(errs, models.FieldError{Field: "email", Code: "required", Message: "email is required"})
+	case len(email) > 254 || !strings.Contains(email, "@") || strings.ContainsAny(email, " \t\r\n"):
+		errs = append(errs, models.FieldError{Field: "email", Code: "email", Message: "email must be a valid email address"})
+	}
+	switch {
+	case len(password) < auth.MinPasswordLength:
+		errs = append(errs, models.FieldError{Field: "password", Code: "min",
+			Message: fmt.Sprintf("password must be at least %d characters long", auth.MinPasswordLength)})
+	case len(password) > auth.MaxPasswordLength:
+		errs = append(errs, models.FieldError{Field: "password", Code: "max",
+			Message: fmt.Sprintf("password must be at most %d bytes long", auth.MaxPasswordLength)})
+	}
+	return errs
+}
@@ -0,0 +1,107 @@
+package handlers_test
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRegisterAndLogin(t *testing.T) {
+	api := newTestAPI(t)
+	u := api.signUp("Ada@Example.com ", "")
+
+	me := api.expect(api.do("GET", "/auth/me", u.Token, nil), http.StatusOK)
+	if str(me.Body, "email") != "ada@example.com" || str(me.Body, "role") != "member" {
+		t.Errorf("GET /auth/me = %v, want the normalized email and the member role", me.Body)
+	}
+	if _, leaked := me.Body["password_hash"]; leaked {
+		t.Error("GET /auth/me returned the password hash")
+	}
+
+	tests := []struct {
+		name       string
+		path       string
+		email      string
+		password   string
+		code       int
+		fieldCodes []string
+	}{
+		{name: "taken email", path: "/auth/register", email: "ADA@example.com", password: testPassword, code: http.StatusConflict},
+		{name: "no email", path: "/auth/register", password: testPassword, code: http.StatusUnprocessableEntity, fieldCodes: []string{"email:required"}},
+		{name: "bad email and password", path: "/auth/register", email: "ada at example", password: "short",
+			code: http.StatusUnprocessableEntity, fieldCodes: []string{"email:email", "password:min"}},
+		{name: "password too long", path: "/auth/register", email: "long@example.com", password: strings.Repeat("x", 73),
+			code: http.StatusUnprocessableEntity, fieldCodes: []string{"password:max"}},
+		{name: "login", path: "/auth/login", email: "ada@EXAMPLE.com", password: testPassword, code: http.StatusOK},
+		{name: "wrong password", path: "/auth/login", email: "ada@example.com", password: "wrong password", code: http.StatusUnauthorized},
+		{name: "unknown account", path: "/auth/login", email: "nobody@example.com", password: testPassword, code: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := api.expect(api.do("POST", tt.path, "", map[string]string{"email": tt.email, "password": tt.password}), tt.code)
+			var got []string
+			for _, fe := range items(res.Body, "errors") {
+				got = append(got, str(fe, "field")+":"+str(fe, "code"))
+			}
+			if !reflect.DeepEqual(got, tt.fieldCodes) {
+				t.Errorf("errors = %v, want %v", got, tt.fieldCodes)
+			}
+			if tt.code == http.StatusOK && (str(res.Body, "access_token") == "" || str(res.Body, "refresh_token") == "" ||
+				res.Header.Get("Cache-Control") != "no-store") {
+				t.Errorf("login = %v %v, want uncached tokens", res.Header, res.Body)
+			}
+		})
+	}
+}
+
+func TestAccessTokens(t *testing.T) {
+	api := newTestAPI(t)
+	u := api.signUp("tokens@example.com", "")
+	res := api.expect(api.do("POST", "/todos", u.Token, map[string]string{"title": "mine"}), http.StatusCreated)
+	if str(res.Body, "owner_id") != u.ID {
+		t.Errorf("owner_id = %q, want the creator %s", str(res.Body, "owner_id"), u.ID)
+	}
+
+	for _, token := range []string{"", "not-a-token", u.Token + "x"} {
+		res := api.expect(api.do("GET", "/todos", token, nil), http.StatusUnauthorized)
+		if str(res.Body, "code") != "unauthorized" {
+			t.Errorf("token %q: %v, want an unauthorized problem", token, res.Body)
+		}
+	}
+	// Signing up and in needs no token
+	api.expect(api.do("POST", "/auth/login", "", map[string]string{"email": "tokens@example.com", "password": testPassword}), http.StatusOK)
+}
+
+func TestRefreshRotation(t *testing.T) {
+	api := newTestAPI(t)
+	api.signUp("refresh@example.com", "")
+	login := func() string {
+		res := api.expect(api.do("POST", "/auth/login", "", map[string]string{"email": "refresh@example.com", "password": testPassword}), http.StatusOK)
+		return str(res.Body, "refresh_token")
+	}
+	refresh := func(token string, code int) string {
+		t.Helper()
+		res := api.expect(api.do("POST", "/auth/refresh", "", map[string]string{"refresh_token": token}), code)
+		return str(res.Body, "refresh_token")
+	}
+
+	first := login()
+	second := refresh(first, http.StatusOK)
+	if second == "" || second == first {
+		t.Fatalf("refresh returned %q, want a new refresh token", second)
+	}
+	third := refresh(second, http.StatusOK)
+
+	// Replaying a spent token revokes every token of that login
+	refresh(first, http.StatusUnauthorized)
+	refresh(third, http.StatusUnauthorized)
+
+	// but not those of other logins
+	other := login()
+	next := refresh(other, http.StatusOK)
+	api.expect(api.do("POST", "/auth/logout", "", map[string]string{"refresh_token": next}), http.StatusNoContent)
+	refresh(next, http.StatusUnauthorized)
+	refresh("made-up", http.StatusUnauthorized)
+	api.expect(api.do("POST", "/auth/logout", "", map[string]string{"refresh_token": "made-up"}), http.StatusNoContent)
+}
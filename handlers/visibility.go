@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"todo-api/auth"
+	"todo-api/store"
+)
+
+// visibility reads which soft deleted todos a read should see. Deleted todos
+// are hidden unless the request sets include_deleted=true or
+// only_deleted=true (the legacy is_deleted=true means the latter). They may
+// be any workspace member's, so asking for them needs auth.PermTodosTrash.
+// On failure the error response has been written and ok is false.
+func (s *Server) visibility(w http.ResponseWriter, r *http.Request) (vis store.Visibility, ok bool) {
+	flag := func(name string) bool {
+		v := r.URL.Query().Get(name)
+		if v == "" || !ok {
+			return false
+		}
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, CodeBadRequest, name+" must be true or false")
+			ok = false
+		}
+		return b
+	}
+
+	ok = true
+	include := flag("include_deleted")
+	only := flag("only_deleted") || flag("is_deleted")
+	switch {
+	case !ok:
+		return vis, false
+	case include && only:
+		writeError(w, r, http.StatusBadRequest, CodeBadRequest, "include_deleted and only_deleted cannot be combined")
+		return vis, false
+	case (include || only) && !s.authorize(w, r, auth.PermTodosTrash):
+		return vis, false
+	case include:
+		vis = store.IncludeDeleted
+	case only:
+		vis = store.OnlyDeleted
+	default:
+		return store.HideDeleted, true
+	}
+	return vis, true
+}
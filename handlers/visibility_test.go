@@ -0,0 +1,60 @@
+package handlers_test
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestDeletedTodosAreHidden(t *testing.T) {
+	api := newTestAPI(t)
+	u := api.signUp("hidden@example.com", "")
+	api.expect(api.do("POST", "/todos", u.Token, map[string]string{"title": "kept"}), http.StatusCreated)
+	id := str(api.expect(api.do("POST", "/todos", u.Token, map[string]string{"title": "binned"}), http.StatusCreated).Body, "id")
+	api.expect(api.do("DELETE", "/todos/"+id, u.Token, nil), http.StatusOK)
+
+	// Every read path leaves the deleted todo out
+	if titles, _ := api.list(u.Token, "/todos?sort=title"); strings.Join(titles, ",") != "kept" {
+		t.Errorf("GET /todos = %v, want only kept", titles)
+	}
+	legacy := api.expect(api.do("GET", "/todoss", u.Token, nil), http.StatusOK)
+	if todos := items(legacy.Body, "todos"); len(todos) != 1 {
+		t.Errorf("GET /todoss = %v, want one todo", legacy.Body)
+	}
+	api.expect(api.do("GET", "/todos/"+id, u.Token, nil), http.StatusNotFound)
+	api.expect(api.do("GET", "/todo?id="+id, u.Token, nil), http.StatusNotFound)
+
+	// unless an admin asks for it
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{query: "include_deleted=true", want: "binned,kept"},
+		{query: "only_deleted=true", want: "binned"},
+		{query: "is_deleted=true", want: "binned"},
+		{query: "include_deleted=false", want: "kept"},
+	}
+	for _, tt := range tests {
+		if titles, _ := api.list(adminToken, "/todos?sort=title&"+tt.query); strings.Join(titles, ",") != tt.want {
+			t.Errorf("GET /todos?%s = %v, want %s", tt.query, titles, tt.want)
+		}
+	}
+	res := api.expect(api.do("GET", "/todos/"+id+"?include_deleted=true", adminToken, nil), http.StatusOK)
+	if str(res.Body, "data", "title") != "binned" {
+		t.Errorf("GET /todos/{id}?include_deleted=true = %v", res.Body)
+	}
+	api.expect(api.do("GET", "/todos?include_deleted=true&only_deleted=true", adminToken, nil), http.StatusBadRequest)
+	api.expect(api.do("GET", "/todos?include_deleted=maybe", adminToken, nil), http.StatusBadRequest)
+
+	// Writes to it answer 410 and point at the restore endpoint
+	for _, req := range []struct{ method, body string }{
+		{"PATCH", `{"title":"x"}`},
+		{"PUT", `{"title":"x"}`},
+		{"DELETE", ""},
+	} {
+		res := api.expect(api.do(req.method, "/todos/"+id, u.Token, req.body), http.StatusGone)
+		if str(res.Body, "restore") != "/todos/"+id+"/restore" || res.Body["deleted_at"] == nil {
+			t.Errorf("%s of a deleted todo: %v, want deleted_at and a restore link", req.method, res.Body)
+		}
+	}
+}
@@ -0,0 +1,453 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+	"todo-api/auth"
+	"todo-api/models"
+	"todo-api/store"
+
+	"github.com/google/uuid"
+)
+
+// workspaceHeader picks the workspace a request works in. Without it users
+// work in the first workspace they joined, normally their personal one, and
+// callers with auth.PermTodosAll work across every workspace.
+const workspaceHeader = "X-Workspace-ID"
+
+// invitationTTL is how long an invitation can be accepted.
+const invitationTTL = 7 * 24 * time.Hour
+
+// maxWorkspaceName is the longest name a workspace can be given.
+const maxWorkspaceName = 100
+
+// selectWorkspace sets the workspace c works in for r. On failure the error
+// response has been written and ok is false.
+func (s *Server) selectWorkspace(w http.ResponseWriter, r *http.Request, c caller) (caller, bool) {
+	if header := r.Header.Get(workspaceHeader); header != "" {
+		id, err := uuid.Parse(header)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, CodeInvalidID, "Invalid "+workspaceHeader+" header")
+			return c, false
+		}
+		if c.allowed(auth.PermTodosAll) {
+			_, err = s.store.GetWorkspace(r.Context(), id)
+		} else {
+			var m models.Membership
+			m, err = s.store.GetMembership(r.Context(), id, c.UserID)
+			c.WorkspaceRole = m.Role
+		}
+		if err != nil {
+			writeStoreError(w, r, err, "Workspace not found")
+			return c, false
+		}
+		c.WorkspaceID = id
+		return c, true
+	}
+	if c.allowed(auth.PermTodosAll) {
+		return c, true
+	}
+
+	memberships, err := s.store.ListMemberships(r.Context(), c.UserID)
+	if err != nil {
+		writeStoreError(w, r, err, "Failed to load workspaces")
+		return c, false
+	}
+	if len(memberships) > 0 {
+		c.WorkspaceID, c.WorkspaceRole = memberships[0].WorkspaceID, memberships[0].Role
+		return c, true
+	}
+	// Users who left every workspace can still manage their account and
+	// create or join one; authorize refuses them everything else.
+	c.NoWorkspace = true
+	return c, true
+}
+
+// createPersonalWorkspace creates a workspace owned by user alone, as every
+// account gets when it is created.
+func createPersonalWorkspace(ctx context.Context, st store.Store, user uuid.UUID) (models.Workspace, error) {
+	ws := models.Workspace{ID: uuid.New(), Name: "Personal"}
+	err := st.Atomic(ctx, func(tx store.Store) error {
+		if err := tx.CreateWorkspace(ctx, &ws); err != nil {
+			return err
+		}
+		return tx.AddMember(ctx, models.Membership{WorkspaceID: ws.ID, UserID: user, Role: models.WorkspaceOwner})
+	})
+	return ws, err
+}
+
+// allowedStatus checks the status of todo against the settings of its
+// workspace, and writes 422 if they don't allow it.
+func (s *Server) allowedStatus(w http.ResponseWriter, r *http.Request, todo models.Todo) bool {
+	if todo.WorkspaceID == nil {
+		return true
+	}
+	ws, err := s.store.GetWorkspace(r.Context(), *todo.WorkspaceID)
+	if err != nil {
+		writeStoreError(w, r, err, "Failed to load workspace settings")
+		return false
+	}
+	if !ws.Settings.AllowsStatus(todo.Status) {
+		writeValidationError(w, r, []models.FieldError{{Field: "status", Code: "oneof",
+			Message: fmt.Sprintf("status must be one of %v in this workspace", ws.Settings.AllowedStatuses)}})
+		return false
+	}
+	return true
+}
+
+// loadWorkspace loads the workspace named by the id path value, if the
+// caller belongs to it, and writes 404 otherwise. ownerOnly further requires
+// them to own it. Admins with users:admin may manage every workspace.
+func (s *Server) loadWorkspace(w http.ResponseWriter, r *http.Request, ownerOnly bool) (ws models.Workspace, ok bool) {
+	id, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidID, "Invalid workspace ID")
+		return ws, false
+	}
+	c := callerFrom(r.Context())
+	if !c.allowed(auth.PermUsersAdmin) {
+		member, err := s.store.GetMembership(r.Context(), id, c.UserID)
+		if err != nil {
+			writeStoreError(w, r, err, "Workspace not found")
+			return ws, false
+		}
+		if ownerOnly && member.Role != models.WorkspaceOwner {
+			writeError(w, r, http.StatusForbidden, CodeForbidden, "Only owners of the workspace can do this")
+			return ws, false
+		}
+	}
+	ws, err = s.store.GetWorkspace(r.Context(), id)
+	if err != nil {
+		writeStoreError(w, r, err, "Workspace not found")
+		return ws, false
+	}
+	return ws, true
+}
+
+// ListWorkspaces lists the workspaces of the signed-in user with their role
+// in each.
+func (s *Server) ListWorkspaces(w http.ResponseWriter, r *http.Request) {
+	memberships := []models.Membership{}
+	if c := callerFrom(r.Context()); !c.adminToken() {
+		list, err := s.store.ListMemberships(r.Context(), c.UserID)
+		if err != nil {
+			writeStoreError(w, r, err, "Unable to fetch workspaces")
+			return
+		}
+		memberships = append(memberships, list...)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"workspaces": memberships})
+}
+
+// CreateWorkspace creates a workspace owned by the signed-in user.
+func (s *Server) CreateWorkspace(w http.ResponseWriter, r *http.Request) {
+	c, ok := s.requireSession(w, r, "create workspaces")
+	if !ok {
+		return
+	}
+	var body struct {
+		Name string `json:"name"`
+	}
+	if err := decodeJSON(w, r, &body); err != nil {
+		return
+	}
+	switch {
+	case body.Name == "":
+		writeValidationError(w, r, []models.FieldError{{Field: "name", Code: "required", Message: "name is required"}})
+		return
+	case len(body.Name) > maxWorkspaceName:
+		writeValidationError(w, r, []models.FieldError{{Field: "name", Code: "max",
+			Message: fmt.Sprintf("name must be at most %d characters long", maxWorkspaceName)}})
+		return
+	}
+
+	ws := models.Workspace{ID: uuid.New(), Name: body.Name}
+	err := s.store.Atomic(r.Context(), func(tx store.Store) error {
+		if err := tx.CreateWorkspace(r.Context(), &ws); err != nil {
+			return err
+		}
+		return tx.AddMember(r.Context(), models.Membership{WorkspaceID: ws.ID, UserID: c.UserID, Role: models.WorkspaceOwner})
+	})
+	if err != nil {
+		writeStoreError(w, r, err, "Failed to create workspace")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/workspaces/"+ws.ID.String())
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(ws)
+}
+
+// GetWorkspace returns a workspace the caller belongs to.
+func (s *Server) GetWorkspace(w http.ResponseWriter, r *http.Request) {
+	ws, ok := s.loadWorkspace(w, r, false)
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ws)
+}
+
+// UpdateWorkspaceSettings replaces the settings of a workspace. Existing
+// todos keep their status; the settings apply to the next change.
+func (s *Server) UpdateWorkspaceSettings(w http.ResponseWriter, r *http.Request) {
+	ws, ok := s.loadWorkspace(w, r, true)
+	if !ok {
+		return
+	}
+	var settings models.WorkspaceSettings
+	if err := decodeJSON(w, r, &settings); err != nil {
+		return
+	}
+	var errs []models.FieldError
+	for i, status := range settings.AllowedStatuses {
+		if !slices.Contains(models.Statuses, status) {
+			errs = append(errs, models.FieldError{Field: fmt.Sprintf("allowed_statuses[%d]", i), Code: "oneof",
+				Message: fmt.Sprintf("status must be one of %v", models.Statuses)})
+		}
+	}
+	if len(errs) > 0 {
+		writeValidationError(w, r, errs)
+		return
+	}
+
+	if err := s.store.UpdateWorkspaceSettings(r.Context(), ws.ID, settings); err != nil {
+		writeStoreError(w, r, err, "Failed to update workspace settings")
+		return
+	}
+	ws.Settings = settings
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ws)
+}
+
+// ListMembers lists the members of a workspace the caller belongs to.
+func (s *Server) ListMembers(w http.ResponseWriter, r *http.Request) {
+	ws, ok := s.loadWorkspace(w, r, false)
+	if !ok {
+		return
+	}
+	members, err := s.store.ListMembers(r.Context(), ws.ID)
+	if err != nil {
+		writeStoreError(w, r, err, "Unable to fetch members")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"members": members})
+}
+
+// RemoveMember takes a user out of a workspace. Owners can remove anyone,
+// members only themselves, and the last owner can't leave.
+func (s *Server) RemoveMember(w http.ResponseWriter, r *http.Request) {
+	user, err := uuid.Parse(r.PathValue("user_id"))
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidID, "Invalid user ID")
+		return
+	}
+	self := callerFrom(r.Context()).UserID == user
+	ws, ok := s.loadWorkspace(w, r, !self)
+	if !ok {
+		return
+	}
+
+	err = s.store.Atomic(r.Context(), func(tx store.Store) error {
+		members, err := tx.ListMembers(r.Context(), ws.ID)
+		if err != nil {
+			return err
+		}
+		owners := 0
+		var removed *models.Membership
+		for i, m := range members {
+			if m.Role == models.WorkspaceOwner {
+				owners++
+			}
+			if m.UserID == user {
+				removed = &members[i]
+			}
+		}
+		switch {
+		case removed == nil:
+			return store.ErrNotFound
+		case removed.Role == models.WorkspaceOwner && owners == 1:
+			return store.ErrConflict
+		}
+		return tx.RemoveMember(r.Context(), ws.ID, user)
+	})
+	if errors.Is(err, store.ErrConflict) {
+		writeError(w, r, http.StatusConflict, CodeConflict, "The last owner of a workspace can't leave it")
+		return
+	}
+	if err != nil {
+		writeStoreError(w, r, err, "Member not found")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// invitationRequest is the body of a request inviting someone to a
+// workspace.
+type invitationRequest struct {
+	Email string `json:"email"`
+	Role  string `json:"role"`
+}
+
+// CreateInvitation invites an email address to a workspace. The invitation
+// token is only ever returned in this response, for the owner to pass on.
+func (s *Server) CreateInvitation(w http.ResponseWriter, r *http.Request) {
+	ws, ok := s.loadWorkspace(w, r, true)
+	if !ok {
+		return
+	}
+	var body invitationRequest
+	if err := decodeJSON(w, r, &body); err != nil {
+		return
+	}
+	email := normalizeEmail(body.Email)
+	if body.Role == "" {
+		body.Role = models.WorkspaceMember
+	}
+	var errs []models.FieldError
+	if email == "" {
+		errs = append(errs, models.FieldError{Field: "email", Code: "required", Message: "email is required"})
+	}
+	if body.Role != models.WorkspaceMember && body.Role != models.WorkspaceOwner {
+		errs = append(errs, models.FieldError{Field: "role", Code: "oneof",
+			Message: "role must be one of [" + models.WorkspaceOwner + " " + models.WorkspaceMember + "]"})
+	}
+	if len(errs) > 0 {
+		writeValidationError(w, r, errs)
+		return
+	}
+
+	token, hash, err := auth.NewRefreshToken()
+	if err != nil {
+		writeStoreError(w, r, err, "Failed to create invitation")
+		return
+	}
+	inv := models.Invitation{
+		ID:          uuid.New(),
+		WorkspaceID: ws.ID,
+		Email:       email,
+		Role:        body.Role,
+		TokenHash:   hash,
+		ExpiresAt:   time.Now().Add(invitationTTL),
+	}
+	if c := callerFrom(r.Context()); !c.adminToken() {
+		inv.InvitedBy = &c.UserID
+	}
+	if err := s.store.CreateInvitation(r.Context(), &inv); err != nil {
+		writeStoreError(w, r, err, "Failed to create invitation")
+		return
+	}
+
+	response := struct {
+		models.Invitation
+		Token string `json:"token"`
+	}{inv, token}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(response)
+}
+
+// ListInvitations lists the invitations to a workspace.
+func (s *Server) ListInvitations(w http.ResponseWriter, r *http.Request) {
+	ws, ok := s.loadWorkspace(w, r, true)
+	if !ok {
+		return
+	}
+	invs, err := s.store.ListInvitations(r.Context(), ws.ID)
+	if err != nil {
+		writeStoreError(w, r, err, "Unable to fetch invitations")
+		return
+	}
+	if invs == nil {
+		invs = []models.Invitation{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"invitations": invs})
+}
+
+// DeleteInvitation withdraws an invitation.
+func (s *Server) DeleteInvitation(w http.ResponseWriter, r *http.Request) {
+	ws, ok := s.loadWorkspace(w, r, true)
+	if !ok {
+		return
+	}
+	id, err := uuid.Parse(r.PathValue("invitation_id"))
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidID, "Invalid invitation ID")
+		return
+	}
+	if err := s.store.DeleteInvitation(r.Context(), ws.ID, id); err != nil {
+		writeStoreError(w, r, err, "Invitation not found")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// AcceptInvitation adds the signed-in user to the workspace an invitation
+// is for. The invitation must have been sent to their email.
+func (s *Server) AcceptInvitation(w http.ResponseWriter, r *http.Request) {
+	c, ok := s.requireSession(w, r, "accept invitations")
+	if !ok {
+		return
+	}
+	var body struct {
+		Token string `json:"token"`
+	}
+	if err := decodeJSON(w, r, &body); err != nil {
+		return
+	}
+
+	now := time.Now()
+	inv, err := s.store.GetInvitationByHash(r.Context(), auth.HashRefreshToken(body.Token))
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		writeStoreError(w, r, err, "Failed to accept invitation")
+		return
+	}
+	user, uerr := s.store.GetUser(r.Context(), c.UserID)
+	if uerr != nil {
+		writeStoreError(w, r, uerr, "Failed to accept invitation")
+		return
+	}
+	if err != nil || inv.AcceptedAt != nil || !now.Before(inv.ExpiresAt) || inv.Email != user.Email {
+		writeError(w, r, http.StatusNotFound, CodeNotFound, "Invitation not found, already used or expired")
+		return
+	}
+
+	// An invitation accepted in the meantime is used up; only AddMember
+	// conflicts mean the user is a member already
+	member := models.Membership{WorkspaceID: inv.WorkspaceID, UserID: user.ID, Role: inv.Role}
+	used := false
+	err = s.store.Atomic(r.Context(), func(tx store.Store) error {
+		if err := tx.AcceptInvitation(r.Context(), inv.ID, now); err != nil {
+			used = errors.Is(err, store.ErrConflict) || errors.Is(err, store.ErrNotFound)
+			return err
+		}
+		return tx.AddMember(r.Context(), member)
+	})
+	switch {
+	case used:
+		writeError(w, r, http.StatusNotFound, CodeNotFound, "Invitation not found, already used or expired")
+		return
+	case errors.Is(err, store.ErrConflict):
+		writeError(w, r, http.StatusConflict, CodeConflict, "Already a member of this workspace")
+		return
+	case err != nil:
+		writeStoreError(w, r, err, "Failed to accept invitation")
+		return
+	}
+	member, err = s.store.GetMembership(r.Context(), inv.WorkspaceID, user.ID)
+	if err != nil {
+		writeStoreError(w, r, err, "Failed to accept invitation")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(member)
+}
@@ -0,0 +1,220 @@
+package handlers_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"sync"
+	"testing"
+	"todo-api/auth"
+	"todo-api/config"
+	"todo-api/models"
+	"todo-api/store"
+
+	"github.com/google/uuid"
+)
+
+// invite invites email to the workspace ws as owner and returns the
+// invitation token.
+func (a *testAPI) invite(owner user, ws, email string) string {
+	a.t.Helper()
+	res := a.expect(a.do("POST", "/workspaces/"+ws+"/invitations", owner.Token, map[string]string{"email": email}), http.StatusCreated)
+	return str(res.Body, "token")
+}
+
+func TestWorkspaceIsolation(t *testing.T) {
+	api := newTestAPI(t)
+	alice := api.signUp("alice@example.com", "")
+	bob := api.signUp("bob@example.com", "")
+	id := str(api.expect(api.do("POST", "/todos", alice.Token, map[string]string{"title": "alice's"}), http.StatusCreated).Body, "id")
+	ws := api.workspace(alice)
+
+	api.expect(api.do("GET", "/todos/"+id, bob.Token, nil), http.StatusNotFound)
+	api.expect(api.do("PATCH", "/todos/"+id, bob.Token, `{"title":"bob's"}`), http.StatusNotFound)
+	api.expect(api.do("GET", "/workspaces/"+ws, bob.Token, nil), http.StatusNotFound)
+	api.expect(api.do("GET", "/todos", bob.Token, nil, "X-Workspace-ID", ws), http.StatusNotFound)
+	if titles, _ := api.list(bob.Token, "/todos"); len(titles) != 0 {
+		t.Errorf("bob sees %v, want none of alice's todos", titles)
+	}
+
+	// Once invited, bob works in alice's workspace on request
+	api.expect(api.do("POST", "/invitations/accept", bob.Token, map[string]string{"token": api.invite(alice, ws, "bob@example.com")}), http.StatusOK)
+	api.expect(api.do("GET", "/todos/"+id, bob.Token, nil), http.StatusNotFound)
+	api.expect(api.do("GET", "/todos/"+id, bob.Token, nil, "X-Workspace-ID", ws), http.StatusOK)
+	api.expect(api.do("GET", "/todos", bob.Token, nil, "X-Workspace-ID", "not-a-uuid"), http.StatusBadRequest)
+	api.expect(api.do("PUT", "/workspaces/"+ws+"/settings", bob.Token, map[string]interface{}{}), http.StatusForbidden)
+
+	// Admins see every workspace unless they pick one
+	admin := api.signUp("admin@example.com", "admin")
+	if titles, _ := api.list(admin.Token, "/todos"); len(titles) != 1 {
+		t.Errorf("admin sees %v, want alice's todo", titles)
+	}
+	api.expect(api.do("GET", "/todos/"+id, admin.Token, nil, "X-Workspace-ID", api.workspace(admin)), http.StatusNotFound)
+}
+
+// Members share the todos of a workspace but only change their own; owners
+// of the workspace change anyone's.
+func TestOthersTodos(t *testing.T) {
+	api := newTestAPI(t)
+	owner := api.signUp("owner@example.com", "")
+	ws := api.workspace(owner)
+	join := func(email string) user {
+		u := api.signUp(email, "")
+		api.expect(api.do("POST", "/invitations/accept", u.Token, map[string]string{"token": api.invite(owner, ws, email)}), http.StatusOK)
+		return u
+	}
+	bob, carol := join("bob@example.com"), join("carol@example.com")
+	path := "/todos/" + str(api.expect(api.do("POST", "/todos", bob.Token, map[string]string{"title": "bob's"}, "X-Workspace-ID", ws), http.StatusCreated).Body, "id")
+
+	api.expect(api.do("GET", path, carol.Token, nil, "X-Workspace-ID", ws), http.StatusOK)
+	res := api.expect(api.do("PATCH", path, carol.Token, `{"title":"carol's"}`, "X-Workspace-ID", ws), http.StatusForbidden)
+	if str(res.Body, "code") != "forbidden" {
+		t.Errorf("code = %q, want forbidden", str(res.Body, "code"))
+	}
+	api.expect(api.do("PUT", path, carol.Token, map[string]string{"title": "carol's"}, "X-Workspace-ID", ws), http.StatusForbidden)
+	api.expect(api.do("DELETE", path, carol.Token, nil, "X-Workspace-ID", ws), http.StatusForbidden)
+
+	api.expect(api.do("PATCH", path, owner.Token, `{"title":"reviewed"}`), http.StatusOK)
+	api.expect(api.do("PATCH", path, bob.Token, `{"title":"done"}`, "X-Workspace-ID", ws), http.StatusOK)
+	api.expect(api.do("DELETE", path, bob.Token, nil, "X-Workspace-ID", ws), http.StatusOK)
+	api.expect(api.do("POST", path+"/restore", carol.Token, nil, "X-Workspace-ID", ws), http.StatusForbidden)
+}
+
+// Users who belong to no workspace can only create or join one.
+func TestNoWorkspace(t *testing.T) {
+	api := newTestAPI(t)
+	hash, err := auth.HashPassword(testPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = api.store.CreateUser(context.Background(), &models.User{ID: uuid.New(), Email: "loner@example.com", PasswordHash: hash, Role: "member"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	res := api.expect(api.do("POST", "/auth/login", "", map[string]string{"email": "loner@example.com", "password": testPassword}), http.StatusOK)
+	token := str(res.Body, "access_token")
+
+	res = api.expect(api.do("GET", "/todos", token, nil), http.StatusForbidden)
+	if str(res.Body, "code") != "no_workspace" {
+		t.Errorf("code = %q, want no_workspace", str(res.Body, "code"))
+	}
+	api.expect(api.do("POST", "/workspaces", token, map[string]string{"name": "Mine"}), http.StatusCreated)
+	api.expect(api.do("GET", "/todos", token, nil), http.StatusOK)
+}
+
+func TestInvitations(t *testing.T) {
+	api := newTestAPI(t)
+	owner := api.signUp("owner@example.com", "")
+	guest := api.signUp("guest@example.com", "")
+	ws := api.workspace(owner)
+
+	res := api.expect(api.do("POST", "/workspaces/"+ws+"/invitations", owner.Token, map[string]string{"role": "boss"}), http.StatusUnprocessableEntity)
+	if fe := items(res.Body, "errors"); len(fe) != 2 {
+		t.Errorf("errors = %v, want email:required and role:oneof", fe)
+	}
+	api.expect(api.do("POST", "/workspaces/"+ws+"/invitations", guest.Token, map[string]string{"email": "x@example.com"}), http.StatusNotFound)
+
+	token := api.invite(owner, ws, "Guest@Example.com")
+	stranger := api.signUp("stranger@example.com", "")
+	api.expect(api.do("POST", "/invitations/accept", stranger.Token, map[string]string{"token": token}), http.StatusNotFound)
+
+	res = api.expect(api.do("POST", "/invitations/accept", guest.Token, map[string]string{"token": token}), http.StatusOK)
+	if str(res.Body, "workspace_id") != ws || str(res.Body, "role") != "member" {
+		t.Errorf("membership = %v, want a member of %s", res.Body, ws)
+	}
+	res = api.expect(api.do("POST", "/invitations/accept", guest.Token, map[string]string{"token": token}), http.StatusNotFound)
+	if str(res.Body, "detail") != "Invitation not found, already used or expired" {
+		t.Errorf("detail = %q", str(res.Body, "detail"))
+	}
+	api.expect(api.do("POST", "/invitations/accept", guest.Token, map[string]string{"token": api.invite(owner, ws, "guest@example.com")}),
+		http.StatusConflict)
+
+	members := items(api.expect(api.do("GET", "/workspaces/"+ws+"/members", guest.Token, nil), http.StatusOK).Body, "members")
+	if len(members) != 2 {
+		t.Errorf("members = %v, want the owner and the guest", members)
+	}
+	api.expect(api.do("DELETE", "/workspaces/"+ws+"/members/"+owner.ID, owner.Token, nil), http.StatusConflict)
+	api.expect(api.do("DELETE", "/workspaces/"+ws+"/members/"+guest.ID, guest.Token, nil), http.StatusNoContent)
+	api.expect(api.do("GET", "/workspaces/"+ws, guest.Token, nil), http.StatusNotFound)
+}
+
+func TestWorkspaceSettings(t *testing.T) {
+	api := newTestAPI(t)
+	u := api.signUp("settings@example.com", "")
+	ws := api.workspace(u)
+	path := "/todos/" + str(api.expect(api.do("POST", "/todos", u.Token, map[string]string{"title": "t"}), http.StatusCreated).Body, "id")
+
+	res := api.expect(api.do("PUT", "/workspaces/"+ws+"/settings", u.Token, `{"allowed_statuses":["pending","someday"]}`), http.StatusUnprocessableEntity)
+	if fe := items(res.Body, "errors"); len(fe) != 1 || str(fe[0], "field") != "allowed_statuses[1]" {
+		t.Errorf("errors = %v, want allowed_statuses[1] rejected", fe)
+	}
+	api.expect(api.do("PUT", "/workspaces/"+ws+"/settings", u.Token, `{"allowed_statuses":["pending","blocked"]}`), http.StatusOK)
+
+	res = api.expect(api.do("PATCH", path, u.Token, `{"status":"in_progress"}`), http.StatusUnprocessableEntity)
+	if fe := items(res.Body, "errors"); len(fe) != 1 || str(fe[0], "field") != "status" || str(fe[0], "code") != "oneof" {
+		t.Errorf("errors = %v, want status:oneof", fe)
+	}
+	api.expect(api.do("PATCH", path, u.Token, `{"status":"blocked"}`), http.StatusOK)
+	api.expect(api.do("POST", "/todos", u.Token, map[string]string{"title": "t", "status": "cancelled"}), http.StatusUnprocessableEntity)
+}
+
+// scopeRecorder records the workspaces requests are scoped to, and fails
+// their commits with commitErr.
+type scopeRecorder struct {
+	store.Store
+	mu        *sync.Mutex
+	scopes    *[]uuid.UUID
+	commitErr error
+}
+
+func (s scopeRecorder) Scope(ctx context.Context, workspace uuid.UUID, fn func(ctx context.Context) error) error {
+	s.mu.Lock()
+	*s.scopes = append(*s.scopes, workspace)
+	s.mu.Unlock()
+	if err := s.Store.Scope(ctx, workspace, fn); err != nil {
+		return err
+	}
+	return s.commitErr
+}
+
+func TestRowLevelSecurity(t *testing.T) {
+	api := newTestAPI(t, func(cfg *config.Config) { cfg.Database.RowLevelSecurity = true })
+	u := api.signUp("scoped@example.com", "")
+	admin := api.signUp("admin@example.com", "admin")
+	ws := uuid.MustParse(api.workspace(u))
+
+	rec := scopeRecorder{mu: &sync.Mutex{}, scopes: &[]uuid.UUID{}}
+	api.wrapStore(func(st store.Store) store.Store { rec.Store = st; return rec })
+	scoped := func() []uuid.UUID {
+		rec.mu.Lock()
+		defer rec.mu.Unlock()
+		// Audit log writes are scoped to every workspace in the background
+		got := slices.DeleteFunc(slices.Clone(*rec.scopes), func(id uuid.UUID) bool { return id == uuid.Nil })
+		*rec.scopes = (*rec.scopes)[:0]
+		return got
+	}
+
+	res := api.expect(api.do("POST", "/todos", u.Token, map[string]string{"title": "scoped"}), http.StatusCreated)
+	if str(res.Body, "title") != "scoped" || res.Header.Get("ETag") == "" {
+		t.Errorf("response = %v %v, want the created todo", res.Header, res.Body)
+	}
+	if got := scoped(); !slices.Equal(got, []uuid.UUID{ws}) {
+		t.Errorf("scopes = %v, want %s", got, ws)
+	}
+	api.expect(api.do("GET", "/todos/"+uuid.NewString(), u.Token, nil), http.StatusNotFound)
+	api.expect(api.do("GET", "/todos", admin.Token, nil), http.StatusOK)
+	rec.mu.Lock()
+	if n := len(*rec.scopes); n == 0 || (*rec.scopes)[n-1] != uuid.Nil {
+		t.Errorf("scopes = %v, want the admin's request scoped to every workspace", *rec.scopes)
+	}
+	rec.mu.Unlock()
+
+	// A response is only sent once its changes are committed
+	rec.commitErr = errors.New("connection reset")
+	api.wrapStore(func(st store.Store) store.Store { rec.Store = st; return rec })
+	res = api.expect(api.do("POST", "/todos", u.Token, map[string]string{"title": "lost"}), http.StatusInternalServerError)
+	if str(res.Body, "code") != "internal_error" || res.Header.Get("ETag") != "" {
+		t.Errorf("response = %v %v, want only the error", res.Header, res.Body)
+	}
+}
@@ -1,16 +1,197 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"todo-api/config"
 	"todo-api/database"
+	"todo-api/handlers"
 	"todo-api/routes"
+	"todo-api/store"
 )
 
+const usage = `usage:
+  todo-api [flags]                       run the API server
+  todo-api migrate up|down|status [flags] manage the database schema
+
+Run "todo-api -h" to list the flags.`
+
 func main() {
-	database.ConnectDB()
-	router := routes.SetupRoutes()
-	fmt.Println("Server running on port 8080")
-	log.Fatal(http.ListenAndServe(":8080", router))
+	args := os.Args[1:]
+	if len(args) > 0 && args[0] == "migrate" {
+		if len(args) < 2 {
+			fmt.Fprintln(os.Stderr, usage)
+			os.Exit(2)
+		}
+		cfg := loadConfig(args[2:])
+		if err := runMigrate(cfg, args[1]); err != nil {
+			fmt.Fprintf(os.Stderr, "migrate %s: %v\n", args[1], err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	cfg := loadConfig(args)
+
+	var st store.Store
+	switch cfg.Storage.Driver {
+	case "memory":
+		slog.Warn("Using in-memory storage; data will not survive a restart")
+		st = store.NewMemory()
+	default:
+		db, err := database.ConnectDB(cfg.Database)
+		if err != nil {
+			fatal("Error connecting to the database", err)
+		}
+		if cfg.Database.AutoMigrate {
+			migrator, err := database.NewMigrator(db)
+			if err != nil {
+				fatal("Error loading migrations", err)
+			}
+			if _, err := migrator.Up(context.Background()); err != nil {
+				fatal("Error applying migrations", err)
+			}
+		}
+		if cfg.Database.RowLevelSecurity {
+			if err := database.CheckRowLevelSecurity(context.Background(), db); err != nil {
+				fatal("Error checking row-level security", err)
+			}
+		}
+		st = store.NewPostgres(db)
+	}
+	srv, err := handlers.NewServer(cfg, st)
+	if err != nil {
+		fatal("Error setting up handlers", err)
+	}
+
+	server := &http.Server{
+		Addr:              cfg.Server.Addr,
+		Handler:           handlers.RequestID(handlers.ProblemErrors(srv.Authenticate(handlers.RequireScopes(routes.SetupRoutes(srv), routes.Scopes)))),
+		ReadTimeout:       cfg.Server.ReadTimeout,
+		ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
+		WriteTimeout:      cfg.Server.WriteTimeout,
+		IdleTimeout:       cfg.Server.IdleTimeout,
+	}
+
+	// Serve until SIGINT/SIGTERM, then stop accepting connections and let
+	// in-flight requests finish within the shutdown timeout.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Empty the trash in the background, if a retention period is set
+	go srv.RunRetention(ctx)
+
+	serveErr := make(chan error, 1)
+	go func() {
+		if cfg.Server.TLS.Enabled() {
+			slog.Info("Server running", "addr", cfg.Server.Addr, "tls", true)
+			serveErr <- server.ListenAndServeTLS(cfg.Server.TLS.CertFile, cfg.Server.TLS.KeyFile)
+			return
+		}
+		slog.Info("Server running", "addr", cfg.Server.Addr)
+		serveErr <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serveErr:
+		fatal("Server failed", err)
+	case <-ctx.Done():
+		stop()
+	}
+
+	slog.Info("Shutting down, draining requests", "timeout", cfg.Server.ShutdownTimeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	defer cancel()
+
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		slog.Error("Error draining connections", "err", err)
+	}
+	if err := srv.Close(shutdownCtx); err != nil {
+		slog.Error("Error flushing audit logs", "err", err)
+	}
+	if cfg.Storage.Driver == "postgres" {
+		if err := database.CloseDB(); err != nil {
+			slog.Error("Error closing database", "err", err)
+		}
+	}
+	slog.Info("Server stopped")
+}
+
+// fatal logs err and exits.
+func fatal(msg string, err error) {
+	slog.Error(msg, "err", err)
+	os.Exit(1)
+}
+
+// loadConfig resolves the configuration or exits with a readable report.
+func loadConfig(args []string) *config.Config {
+	cfg, err := config.Load(args)
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			fmt.Fprintln(os.Stderr, usage)
+			os.Exit(0)
+		}
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	slog.SetLogLoggerLevel(cfg.Log.SlogLevel())
+	return cfg
+}
+
+// runMigrate implements the "migrate" subcommand.
+func runMigrate(cfg *config.Config, command string) error {
+	db, err := database.ConnectDB(cfg.Database)
+	if err != nil {
+		return err
+	}
+	defer database.CloseDB()
+
+	migrator, err := database.NewMigrator(db)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	switch command {
+	case "up":
+		ran, err := migrator.Up(ctx)
+		if err != nil {
+			return err
+		}
+		if len(ran) == 0 {
+			fmt.Println("Schema is up to date")
+		}
+		return nil
+	case "down":
+		ran, err := migrator.Down(ctx, 1)
+		if err != nil {
+			return err
+		}
+		if len(ran) == 0 {
+			fmt.Println("No migrations to roll back")
+		}
+		return nil
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		for _, s := range statuses {
+			state := "pending"
+			if s.AppliedAt != nil {
+				state = "applied " + s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			if s.Drifted {
+				state += " (CHECKSUM MISMATCH)"
+			}
+			fmt.Printf("%04d  %-40s %s\n", s.Version, s.Name, state)
+		}
+		return err
+	default:
+		return fmt.Errorf("unknown command %q (want up, down or status)", command)
+	}
 }
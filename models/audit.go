@@ -0,0 +1,61 @@
+package models
+
+import "time"
+
+// Change is the value of one todo field before and after an audited write.
+// Before is null for todos that did not exist yet.
+type Change struct {
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
+
+// Changes returns the audited fields that differ between before and after,
+// keyed by JSON name. A nil before describes a create and records every
+// field of after that is set.
+func Changes(before *Todo, after Todo) map[string]Change {
+	next := after.auditFields()
+	changes := map[string]Change{}
+	if before == nil {
+		for field, v := range next {
+			if v != nil && v != "" && v != false {
+				changes[field] = Change{After: v}
+			}
+		}
+		return changes
+	}
+	for field, prev := range before.auditFields() {
+		if prev != next[field] {
+			changes[field] = Change{Before: prev, After: next[field]}
+		}
+	}
+	return changes
+}
+
+// auditFields flattens the fields recorded in the audit log to comparable
+// JSON values; unset dates are nil.
+func (t Todo) auditFields() map[string]interface{} {
+	stamp := func(t *time.Time) interface{} {
+		if t == nil {
+			return nil
+		}
+		return t.UTC().Format(time.RFC3339Nano)
+	}
+	var project interface{}
+	if t.ProjectID != nil {
+		project = t.ProjectID.String()
+	}
+	var due interface{}
+	if !t.DueDate.IsZero() {
+		due = t.DueDate.Format("2006-01-02")
+	}
+	return map[string]interface{}{
+		"title":        t.Title,
+		"description":  t.Description,
+		"status":       t.Status,
+		"due_date":     due,
+		"started_at":   stamp(t.StartedAt),
+		"completed_at": stamp(t.CompletedAt),
+		"is_deleted":   t.IsDeleted,
+		"project_id":   project,
+	}
+}
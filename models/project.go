@@ -0,0 +1,21 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Project groups the todos of a workspace. Archiving a project hides its
+// todos from lists until they are asked for.
+type Project struct {
+	ID          uuid.UUID  `json:"id"`
+	WorkspaceID *uuid.UUID `json:"workspace_id"` // nil for projects outside every workspace
+	Name        string     `json:"name" validate:"required,max=100"`
+	Description string     `json:"description" validate:"max=2000"`
+	Color       string     `json:"color" validate:"color"`
+	Archived    bool       `json:"archived"`
+	ArchivedAt  *time.Time `json:"archived_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
@@ -1,10 +1,10 @@
 package models
 
 import (
-	"time"
-	"fmt"
 	"encoding/json"
+	"fmt"
 	"github.com/google/uuid"
+	"time"
 )
 
 // CustomDate struct for handling JSON and SQL interactions
@@ -55,26 +55,131 @@ func (cd CustomDate) MarshalJSON() ([]byte, error) {
 	return []byte(formatted), nil
 }
 
-// Todo struct
+// Todo statuses
+const (
+	StatusPending    = "pending"
+	StatusInProgress = "in_progress"
+	StatusBlocked    = "blocked"
+	StatusDone       = "done"
+	StatusCancelled  = "cancelled"
+)
+
+// Todo struct; the validate tags are checked by Validate on create and update
 type Todo struct {
 	ID          uuid.UUID  `json:"id"`
-	Title       string     `json:"title"`
-	Description string     `json:"description"`
-	Status      string     `json:"status"`
-	DueDate     CustomDate `json:"due_date"`
+	Title       string     `json:"title" validate:"required,max=200"`
+	Description string     `json:"description" validate:"max=2000"`
+	Status      string     `json:"status" validate:"oneof=pending in_progress blocked done cancelled"`
+	DueDate     CustomDate `json:"due_date" validate:"maxpast=365"`
 	CreatedAt   time.Time  `json:"created_at"`
+	StartedAt   *time.Time `json:"started_at"`
+	CompletedAt *time.Time `json:"completed_at"`
 	IsDeleted   bool       `json:"is_deleted"`
+	DeletedAt   *time.Time `json:"deleted_at,omitempty"`
+	Version     int        `json:"version"`
+	OwnerID     *uuid.UUID `json:"owner_id"`     // nil for todos created before user accounts
+	WorkspaceID *uuid.UUID `json:"workspace_id"` // nil for todos outside every workspace
+	ProjectID   *uuid.UUID `json:"project_id"`   // nil for todos in no project
 }
 type Log struct {
-	ID        string    `json:"id"`
-	TodoID    string    `json:"todo_id"`
-	Action    string    `json:"action"`
-	Timestamp time.Time `json:"timestamp"`
+	ID          string            `json:"id"`
+	TodoID      string            `json:"todo_id"`
+	WorkspaceID *uuid.UUID        `json:"workspace_id"` // that of the todo when the entry was written
+	Action      string            `json:"action"`
+	Timestamp   time.Time         `json:"timestamp"`
+	Changes     map[string]Change `json:"changes,omitempty"`
 }
+
+// LogEntry is a new audit record to be written to the logs table
+type LogEntry struct {
+	Action  string
+	TodoID  uuid.UUID
+	Message string
+	Details string
+	Changes map[string]Change // before/after values of the fields a write touched
+	// WorkspaceID is the workspace of the todo, for entries written once it
+	// is gone; otherwise the store looks it up.
+	WorkspaceID *uuid.UUID
+}
+
 // LogResponse struct to include metadata
 type LogResponse struct {
-	CurrentPage int          `json:"current_page"`
-	TotalRecords int         `json:"total_records"`
-	TotalPages  int          `json:"total_pages"`
-	Logs        []Log `json:"logs"`
-}
\ No newline at end of file
+	CurrentPage  int   `json:"current_page"`
+	TotalRecords int   `json:"total_records"`
+	TotalPages   int   `json:"total_pages"`
+	Logs         []Log `json:"logs"`
+}
+
+// PageLinks point at the neighbouring pages of a cursor-paginated list.
+type PageLinks struct {
+	Next string `json:"next,omitempty"`
+	Prev string `json:"prev,omitempty"`
+}
+
+// LogPage is one cursor-paginated page of logs. TotalRecords is only set
+// when the client asks for it with include_total=true.
+type LogPage struct {
+	Logs         []Log     `json:"logs"`
+	PageSize     int       `json:"page_size"`
+	NextCursor   string    `json:"next_cursor,omitempty"`
+	PrevCursor   string    `json:"prev_cursor,omitempty"`
+	Links        PageLinks `json:"links"`
+	TotalRecords *int      `json:"total_records,omitempty"`
+}
+
+// TodoList is the response of the todo list endpoint. TotalItems is set for
+// numbered pages and when the client asks for it with include_total=true.
+type TodoList struct {
+	Items      []Todo   `json:"items"`
+	Page       PageInfo `json:"page"`
+	TotalItems *int     `json:"total_items,omitempty"`
+}
+
+// PageInfo describes the page of a list. Lists are paged with cursors, or by
+// number when the request gives one.
+type PageInfo struct {
+	Size       int       `json:"size"`
+	Number     int       `json:"number,omitempty"`
+	TotalPages *int      `json:"total_pages,omitempty"`
+	NextCursor string    `json:"next_cursor,omitempty"`
+	PrevCursor string    `json:"prev_cursor,omitempty"`
+	Links      PageLinks `json:"links"`
+}
+
+// SearchHit is a todo matching a full-text search, with its relevance and
+// the matching words wrapped in <mark></mark>.
+type SearchHit struct {
+	Todo       Todo       `json:"todo"`
+	Rank       float64    `json:"rank"`
+	Highlights Highlights `json:"highlights"`
+}
+
+// Highlights are the searched fields of a SearchHit with matches marked. The
+// description is cut down to the fragments around the matches.
+type Highlights struct {
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+}
+
+// TodoInput is the part of a todo clients can write. PATCH requests are
+// applied to this shape.
+type TodoInput struct {
+	Title       string     `json:"title"`
+	Description string     `json:"description"`
+	Status      string     `json:"status"`
+	DueDate     CustomDate `json:"due_date"`
+}
+
+// Input returns the writable fields of t.
+func (t Todo) Input() TodoInput {
+	return TodoInput{Title: t.Title, Description: t.Description, Status: t.Status, DueDate: t.DueDate}
+}
+
+// SameID reports whether the optional IDs a and b are equal: both nil, or
+// both set to the same ID.
+func SameID(a, b *uuid.UUID) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
@@ -0,0 +1,28 @@
+package models_test
+
+import (
+	"testing"
+	"todo-api/models"
+
+	"github.com/google/uuid"
+)
+
+func TestSameID(t *testing.T) {
+	a, b := uuid.New(), uuid.New()
+	a2 := a
+	tests := []struct {
+		x, y *uuid.UUID
+		want bool
+	}{
+		{want: true},
+		{x: &a, y: &a2, want: true},
+		{x: &a, y: &b},
+		{x: &a},
+		{y: &b},
+	}
+	for _, tt := range tests {
+		if got := models.SameID(tt.x, tt.y); got != tt.want {
+			t.Errorf("SameID(%v, %v) = %v, want %v", tt.x, tt.y, got, tt.want)
+		}
+	}
+}
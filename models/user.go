@@ -0,0 +1,49 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// User is an account that owns todos. The password hash never leaves the
+// server. Accounts created by signing in with an OpenID Connect provider
+// have no password; OIDCIssuer and OIDCSubject identify them at the provider.
+type User struct {
+	ID           uuid.UUID `json:"id"`
+	Email        string    `json:"email"`
+	PasswordHash string    `json:"-"`
+	Role         string    `json:"role"`
+	OIDCIssuer   string    `json:"-"`
+	OIDCSubject  string    `json:"-"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// RefreshToken is an issued refresh token. Only the hash of its value is
+// kept. Tokens rotate on every use; Family links the tokens that descend
+// from one login.
+type RefreshToken struct {
+	ID        uuid.UUID
+	UserID    uuid.UUID
+	Family    uuid.UUID
+	TokenHash string
+	ExpiresAt time.Time
+	CreatedAt time.Time
+	RevokedAt *time.Time
+}
+
+// APIKey is a long-lived credential a user creates for scripts and CI jobs
+// (a personal access token). Only the hash of the key is kept; Prefix is
+// its first characters, to tell keys apart.
+type APIKey struct {
+	ID         uuid.UUID  `json:"id"`
+	UserID     uuid.UUID  `json:"-"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	KeyHash    string     `json:"-"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
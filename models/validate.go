@@ -0,0 +1,147 @@
+package models
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// FieldError describes why a single field failed validation. Field is the
+// JSON name of the field.
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Validate checks v (a struct or pointer to one) against the rules in its
+// `validate` struct tags and returns every violation. When fields is not
+// empty, only those JSON fields are checked; this is how partial updates are
+// validated.
+//
+// Supported rules, comma separated:
+//
+//	required    the value must not be empty
+//	max=N       strings may hold at most N characters
+//	oneof=a b   strings must be one of the listed values (empty is allowed unless required)
+//	maxpast=N   dates may be at most N days in the past (zero dates are allowed unless required)
+//	color       strings must be a #rrggbb hex color (empty is allowed unless required)
+func Validate(v interface{}, fields ...string) []FieldError {
+	rv := reflect.Indirect(reflect.ValueOf(v))
+	rt := rv.Type()
+
+	only := map[string]bool{}
+	for _, f := range fields {
+		only[f] = true
+	}
+
+	var errs []FieldError
+	for i := 0; i < rt.NumField(); i++ {
+		sf := rt.Field(i)
+		rules := sf.Tag.Get("validate")
+		if rules == "" {
+			continue
+		}
+		name := jsonName(sf)
+		if len(only) > 0 && !only[name] {
+			continue
+		}
+		for _, rule := range strings.Split(rules, ",") {
+			key, arg, _ := strings.Cut(rule, "=")
+			if fe := checkRule(rv.Field(i), name, key, arg); fe != nil {
+				errs = append(errs, *fe)
+				break // one error per field is enough
+			}
+		}
+	}
+	return errs
+}
+
+func checkRule(fv reflect.Value, name, rule, arg string) *FieldError {
+	fail := func(code, format string, args ...interface{}) *FieldError {
+		return &FieldError{Field: name, Code: code, Message: fmt.Sprintf(format, args...)}
+	}
+
+	switch rule {
+	case "required":
+		if isEmpty(fv) {
+			return fail("required", "%s is required", name)
+		}
+	case "max":
+		n, _ := strconv.Atoi(arg)
+		if fv.Kind() == reflect.String && utf8.RuneCountInString(fv.String()) > n {
+			return fail("too_long", "%s must be at most %d characters", name, n)
+		}
+	case "oneof":
+		allowed := strings.Fields(arg)
+		if fv.Kind() == reflect.String && fv.String() != "" && !contains(allowed, fv.String()) {
+			return fail("invalid_choice", "%s must be one of: %s", name, strings.Join(allowed, ", "))
+		}
+	case "maxpast":
+		days, _ := strconv.Atoi(arg)
+		t, ok := timeOf(fv)
+		if ok && !t.IsZero() && t.Before(time.Now().AddDate(0, 0, -days)) {
+			return fail("too_old", "%s must not be more than %d days in the past", name, days)
+		}
+	case "color":
+		if fv.Kind() == reflect.String && fv.String() != "" && !isHexColor(fv.String()) {
+			return fail("invalid_color", "%s must be a hex color such as #3366ff", name)
+		}
+	default:
+		panic("models: unknown validation rule " + rule)
+	}
+	return nil
+}
+
+func isEmpty(fv reflect.Value) bool {
+	if t, ok := timeOf(fv); ok {
+		return t.IsZero()
+	}
+	if fv.Kind() == reflect.String {
+		return strings.TrimSpace(fv.String()) == ""
+	}
+	return fv.IsZero()
+}
+
+func timeOf(fv reflect.Value) (time.Time, bool) {
+	switch v := fv.Interface().(type) {
+	case time.Time:
+		return v, true
+	case CustomDate:
+		return v.Time, true
+	}
+	return time.Time{}, false
+}
+
+func jsonName(sf reflect.StructField) string {
+	name, _, _ := strings.Cut(sf.Tag.Get("json"), ",")
+	if name == "" {
+		return sf.Name
+	}
+	return name
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// isHexColor reports whether s is a color written as #rrggbb.
+func isHexColor(s string) bool {
+	if len(s) != 7 || s[0] != '#' {
+		return false
+	}
+	for _, c := range s[1:] {
+		if !strings.ContainsRune("0123456789abcdefABCDEF", c) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,48 @@
+package models_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+	"todo-api/models"
+)
+
+func TestValidate(t *testing.T) {
+	day := func(daysAgo int) models.CustomDate {
+		return models.CustomDate{Time: time.Now().AddDate(0, 0, -daysAgo)}
+	}
+	tests := []struct {
+		name   string
+		todo   models.Todo
+		fields []string
+		want   []string // field:code of each error
+	}{
+		{name: "valid", todo: models.Todo{Title: "t", Status: "pending", DueDate: day(-3)}},
+		{name: "zero values", todo: models.Todo{}, want: []string{"title:required"}},
+		{name: "blank title", todo: models.Todo{Title: " \t"}, want: []string{"title:required"}},
+		{name: "title at the limit", todo: models.Todo{Title: strings.Repeat("é", 200)}},
+		{name: "title too long", todo: models.Todo{Title: strings.Repeat("é", 201)}, want: []string{"title:too_long"}},
+		{name: "description too long", todo: models.Todo{Title: "t", Description: strings.Repeat("x", 2001)}, want: []string{"description:too_long"}},
+		{name: "unknown status", todo: models.Todo{Title: "t", Status: "archived"}, want: []string{"status:invalid_choice"}},
+		{name: "due a year ago", todo: models.Todo{Title: "t", DueDate: day(364)}},
+		{name: "due too long ago", todo: models.Todo{Title: "t", DueDate: day(366)}, want: []string{"due_date:too_old"}},
+		{name: "every field", todo: models.Todo{Status: "x", Description: strings.Repeat("x", 2001), DueDate: day(400)},
+			want: []string{"title:required", "description:too_long", "status:invalid_choice", "due_date:too_old"}},
+		{name: "only the named fields", todo: models.Todo{Status: "x", DueDate: day(400)}, fields: []string{"status"},
+			want: []string{"status:invalid_choice"}},
+		{name: "unnamed fields are skipped", todo: models.Todo{DueDate: day(400)}, fields: []string{"title", "description"},
+			want: []string{"title:required"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, fe := range models.Validate(tt.todo, tt.fields...) {
+				got = append(got, fe.Field+":"+fe.Code)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Validate = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package models
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Statuses lists every status a todo can be in.
+var Statuses = []string{StatusPending, StatusInProgress, StatusBlocked, StatusDone, StatusCancelled}
+
+// DefaultTransitions is the todo lifecycle used unless the configuration
+// provides its own: work moves from pending through in_progress to done, can
+// be blocked along the way, and finished or cancelled todos can be reopened.
+var DefaultTransitions = map[string][]string{
+	StatusPending:    {StatusInProgress, StatusBlocked, StatusCancelled},
+	StatusInProgress: {StatusDone, StatusBlocked, StatusPending, StatusCancelled},
+	StatusBlocked:    {StatusInProgress, StatusPending, StatusCancelled},
+	StatusDone:       {StatusInProgress},
+	StatusCancelled:  {StatusPending},
+}
+
+// Workflow decides which status changes are allowed.
+type Workflow struct {
+	transitions map[string]map[string]bool
+}
+
+// NewWorkflow builds a Workflow from a from -> allowed-next-statuses map. A nil
+// or empty map means DefaultTransitions. Every status mentioned must be a known one.
+func NewWorkflow(transitions map[string][]string) (*Workflow, error) {
+	if len(transitions) == 0 {
+		transitions = DefaultTransitions
+	}
+
+	wf := &Workflow{transitions: map[string]map[string]bool{}}
+	for from, next := range transitions {
+		if !contains(Statuses, from) {
+			return nil, fmt.Errorf("unknown status %q", from)
+		}
+		wf.transitions[from] = map[string]bool{}
+		for _, to := range next {
+			if !contains(Statuses, to) {
+				return nil, fmt.Errorf("unknown status %q in transitions from %q", to, from)
+			}
+			wf.transitions[from][to] = true
+		}
+	}
+	return wf, nil
+}
+
+// CanTransition reports whether a todo in status from may move to status to.
+// Staying in the same status is always allowed, and so is leaving a status
+// that predates the workflow (one that isn't in Statuses).
+func (wf *Workflow) CanTransition(from, to string) bool {
+	if from == to || !contains(Statuses, from) {
+		return true
+	}
+	return wf.transitions[from][to]
+}
+
+// Next returns the statuses reachable from status, sorted.
+func (wf *Workflow) Next(status string) []string {
+	if !contains(Statuses, status) {
+		return append([]string(nil), Statuses...)
+	}
+	next := []string{}
+	for to := range wf.transitions[status] {
+		next = append(next, to)
+	}
+	sort.Strings(next)
+	return next
+}
+
+// Timestamps returns the started_at and completed_at values a todo should
+// have after moving from status from to status to at time now. A nil result
+// means "leave unchanged"; a zero time means "clear".
+//
+// started_at is set the first time work begins and kept afterwards.
+// completed_at is set on entering done and cleared when a todo is reopened.
+func Timestamps(todo Todo, to string, now time.Time) (startedAt, completedAt *time.Time) {
+	if to == todo.Status {
+		return nil, nil
+	}
+	if to == StatusInProgress && todo.StartedAt == nil {
+		startedAt = &now
+	}
+	if to == StatusDone {
+		completedAt = &now
+	} else if todo.CompletedAt != nil {
+		completedAt = &time.Time{}
+	}
+	return startedAt, completedAt
+}
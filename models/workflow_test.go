@@ -0,0 +1,102 @@
+package models_test
+
+import (
+	"reflect"
+	"testing"
+	"time"
+	"todo-api/models"
+)
+
+func TestNewWorkflowRejectsUnknownStatuses(t *testing.T) {
+	for _, transitions := range []map[string][]string{
+		{"archived": {"pending"}},
+		{"pending": {"archived"}},
+	} {
+		if _, err := models.NewWorkflow(transitions); err == nil {
+			t.Errorf("NewWorkflow(%v) succeeded", transitions)
+		}
+	}
+}
+
+func TestWorkflow(t *testing.T) {
+	defaults, err := models.NewWorkflow(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	custom, err := models.NewWorkflow(map[string][]string{"pending": {"done"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		wf       *models.Workflow
+		from, to string
+		want     bool
+	}{
+		{name: "start work", wf: defaults, from: "pending", to: "in_progress", want: true},
+		{name: "finish", wf: defaults, from: "in_progress", to: "done", want: true},
+		{name: "skip ahead", wf: defaults, from: "pending", to: "done"},
+		{name: "reopen", wf: defaults, from: "done", to: "in_progress", want: true},
+		{name: "cancel a finished todo", wf: defaults, from: "done", to: "cancelled"},
+		{name: "stay", wf: defaults, from: "done", to: "done", want: true},
+		{name: "leave a legacy status", wf: defaults, from: "someday", to: "pending", want: true},
+		{name: "custom", wf: custom, from: "pending", to: "done", want: true},
+		{name: "custom replaces the defaults", wf: custom, from: "pending", to: "in_progress"},
+		{name: "custom dead end", wf: custom, from: "done", to: "pending"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.wf.CanTransition(tt.from, tt.to); got != tt.want {
+				t.Errorf("CanTransition(%s, %s) = %v, want %v", tt.from, tt.to, got, tt.want)
+			}
+		})
+	}
+
+	if got, want := defaults.Next("pending"), []string{"blocked", "cancelled", "in_progress"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Next(pending) = %v, want %v", got, want)
+	}
+	if got := custom.Next("done"); len(got) != 0 || got == nil {
+		t.Errorf("Next(done) = %#v, want an empty list", got)
+	}
+	if got := defaults.Next("someday"); !reflect.DeepEqual(got, models.Statuses) {
+		t.Errorf("Next of a legacy status = %v, want every status", got)
+	}
+}
+
+func TestTimestamps(t *testing.T) {
+	now := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	earlier := now.Add(-time.Hour)
+	tests := []struct {
+		name               string
+		todo               models.Todo
+		to                 string
+		started, completed string // "" unchanged, "now", or "clear"
+	}{
+		{name: "start", todo: models.Todo{Status: "pending"}, to: "in_progress", started: "now"},
+		{name: "restart keeps started_at", todo: models.Todo{Status: "blocked", StartedAt: &earlier}, to: "in_progress"},
+		{name: "finish", todo: models.Todo{Status: "in_progress", StartedAt: &earlier}, to: "done", completed: "now"},
+		{name: "reopen clears completed_at", todo: models.Todo{Status: "done", StartedAt: &earlier, CompletedAt: &earlier}, to: "in_progress",
+			completed: "clear"},
+		{name: "no change", todo: models.Todo{Status: "done", CompletedAt: &earlier}, to: "done"},
+	}
+	describe := func(p *time.Time) string {
+		switch {
+		case p == nil:
+			return ""
+		case p.IsZero():
+			return "clear"
+		case p.Equal(now):
+			return "now"
+		}
+		return p.String()
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			started, completed := models.Timestamps(tt.todo, tt.to, now)
+			if describe(started) != tt.started || describe(completed) != tt.completed {
+				t.Errorf("Timestamps = %q, %q, want %q, %q", describe(started), describe(completed), tt.started, tt.completed)
+			}
+		})
+	}
+}
@@ -0,0 +1,60 @@
+package models
+
+import (
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Workspace roles. Owners manage the workspace, its members and its
+// settings; members work with its todos.
+const (
+	WorkspaceOwner  = "owner"
+	WorkspaceMember = "member"
+)
+
+// Workspace is a team's space: its todos and their logs are invisible from
+// other workspaces.
+type Workspace struct {
+	ID        uuid.UUID         `json:"id"`
+	Name      string            `json:"name"`
+	Settings  WorkspaceSettings `json:"settings"`
+	CreatedAt time.Time         `json:"created_at"`
+}
+
+// WorkspaceSettings are the rules a workspace sets for its todos.
+type WorkspaceSettings struct {
+	// AllowedStatuses limits the statuses todos may take. Empty allows all.
+	AllowedStatuses []string `json:"allowed_statuses"`
+}
+
+// AllowsStatus reports whether todos of the workspace may have status.
+func (s WorkspaceSettings) AllowsStatus(status string) bool {
+	return len(s.AllowedStatuses) == 0 || slices.Contains(s.AllowedStatuses, status)
+}
+
+// Membership puts a user in a workspace. Email is filled in when listing the
+// members of a workspace, and Workspace when listing a user's workspaces.
+type Membership struct {
+	WorkspaceID uuid.UUID  `json:"workspace_id"`
+	UserID      uuid.UUID  `json:"user_id"`
+	Role        string     `json:"role"`
+	JoinedAt    time.Time  `json:"joined_at"`
+	Email       string     `json:"email,omitempty"`
+	Workspace   *Workspace `json:"workspace,omitempty"`
+}
+
+// Invitation asks whoever signs in with Email to join a workspace. Only the
+// hash of its token is kept.
+type Invitation struct {
+	ID          uuid.UUID  `json:"id"`
+	WorkspaceID uuid.UUID  `json:"workspace_id"`
+	Email       string     `json:"email"`
+	Role        string     `json:"role"`
+	TokenHash   string     `json:"-"`
+	InvitedBy   *uuid.UUID `json:"invited_by"`
+	ExpiresAt   time.Time  `json:"expires_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+	AcceptedAt  *time.Time `json:"accepted_at"`
+}
@@ -0,0 +1,24 @@
+package models_test
+
+import (
+	"testing"
+	"todo-api/models"
+)
+
+func TestAllowsStatus(t *testing.T) {
+	limited := models.WorkspaceSettings{AllowedStatuses: []string{"pending", "done"}}
+	tests := []struct {
+		settings models.WorkspaceSettings
+		status   string
+		want     bool
+	}{
+		{settings: models.WorkspaceSettings{}, status: "blocked", want: true},
+		{settings: limited, status: "done", want: true},
+		{settings: limited, status: "blocked"},
+	}
+	for _, tt := range tests {
+		if got := tt.settings.AllowsStatus(tt.status); got != tt.want {
+			t.Errorf("%v.AllowsStatus(%s) = %v, want %v", tt.settings.AllowedStatuses, tt.status, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rsa"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultKeyTTL is how long keys are cached when the provider doesn't
+	// say with Cache-Control.
+	defaultKeyTTL = time.Hour
+	// missInterval rate limits refetches for tokens naming a key that the
+	// last refetch didn't find either, so forged tokens can't make us hammer
+	// the provider. Rotated keys are found by the first refetch.
+	missInterval = 5 * time.Second
+)
+
+// KeySet is a cached JSON Web Key Set. Keys are refetched when the cache
+// expires, and when a token names a key that isn't cached, which is how a
+// provider's key rotation is picked up.
+type KeySet struct {
+	url    string
+	client *http.Client
+
+	mu       sync.Mutex
+	keys     map[string]*rsa.PublicKey
+	expires  time.Time
+	lastMiss time.Time // last refetch that didn't find the key looked for
+}
+
+// NewKeySet returns a KeySet fetching from url through client.
+func NewKeySet(url string, client *http.Client) *KeySet {
+	return &KeySet{url: url, client: client}
+}
+
+// Key returns the RSA signing key with the given key ID.
+func (k *KeySet) Key(ctx context.Context, kid string) (*rsa.PublicKey, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	now := time.Now()
+	key, ok := k.keys[kid]
+	if ok && now.Before(k.expires) {
+		return key, nil
+	}
+	if !ok && now.Sub(k.lastMiss) < missInterval {
+		return nil, ErrInvalidToken
+	}
+	if err := k.fetch(ctx, now); err != nil {
+		return nil, err
+	}
+	if key, ok = k.keys[kid]; !ok {
+		k.lastMiss = now
+		return nil, ErrInvalidToken
+	}
+	return key, nil
+}
+
+// jwk is a JSON Web Key. Only RSA signing keys are used.
+type jwk struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Kid string `json:"kid"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+// fetch replaces the cached keys with those the provider publishes now.
+func (k *KeySet) fetch(ctx context.Context, now time.Time) error {
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	ttl := defaultKeyTTL
+	err := getJSON(ctx, k.client, k.url, &set, func(h http.Header) {
+		if maxAge, ok := cacheMaxAge(h.Get("Cache-Control")); ok {
+			ttl = maxAge
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("oidc: fetching keys: %w", err)
+	}
+
+	keys := map[string]*rsa.PublicKey{}
+	for _, key := range set.Keys {
+		if key.Kty != "RSA" || key.Use != "" && key.Use != "sig" {
+			continue
+		}
+		pub, err := key.rsa()
+		if err != nil {
+			return fmt.Errorf("oidc: key %q: %w", key.Kid, err)
+		}
+		keys[key.Kid] = pub
+	}
+	k.keys, k.expires = keys, now.Add(ttl)
+	return nil
+}
+
+func (key jwk) rsa() (*rsa.PublicKey, error) {
+	n, err := base64.RawURLEncoding.DecodeString(key.N)
+	if err != nil {
+		return nil, err
+	}
+	e, err := base64.RawURLEncoding.DecodeString(key.E)
+	if err != nil {
+		return nil, err
+	}
+	exp := new(big.Int).SetBytes(e)
+	if !exp.IsInt64() || exp.Int64() > 1<<31-1 || exp.Int64() < 3 {
+		return nil, fmt.Errorf("unusable exponent")
+	}
+	return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exp.Int64())}, nil
+}
+
+// cacheMaxAge reads the max-age directive of a Cache-Control header.
+func cacheMaxAge(header string) (time.Duration, bool) {
+	for _, directive := range strings.Split(header, ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(directive), "=")
+		if strings.EqualFold(name, "max-age") {
+			secs, err := strconv.Atoi(value)
+			if err != nil || secs < 0 {
+				return 0, false
+			}
+			return time.Duration(secs) * time.Second, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,329 @@
+// Package oidc signs users in with an OpenID Connect provider, using the
+// authorization code flow with PKCE. ID tokens are verified against the
+// provider's published keys, which are cached and refetched as the provider
+// rotates them.
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrInvalidToken is returned for ID tokens that are malformed, forged,
+// expired or meant for another client or login.
+var ErrInvalidToken = errors.New("oidc: invalid ID token")
+
+// ErrRejected is returned by Exchange when the provider refuses the
+// authorization code, e.g. because it expired or was already used.
+var ErrRejected = errors.New("oidc: provider rejected the authorization code")
+
+// clockSkew is how far the provider's clock may be ahead or behind.
+const clockSkew = time.Minute
+
+// Config identifies the provider and this application as its client.
+type Config struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string // empty for public clients, which rely on PKCE alone
+	RedirectURL  string
+	Scopes       []string // requested besides openid
+}
+
+// Provider is an OpenID Connect provider. Its endpoints are discovered on
+// first use, so the API can start while the provider is unreachable.
+type Provider struct {
+	cfg    Config
+	client *http.Client
+
+	mu        sync.Mutex
+	endpoints *discovery // nil until discovered
+	keys      *KeySet
+}
+
+// discovery is the part of the provider's discovery document the flow uses.
+type discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// NewProvider returns the provider described by cfg, reached through client,
+// or http.DefaultClient when it is nil.
+func NewProvider(cfg Config, client *http.Client) *Provider {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &Provider{cfg: cfg, client: client}
+}
+
+// Issuer is the issuer identifier of p.
+func (p *Provider) Issuer() string {
+	return p.cfg.Issuer
+}
+
+// discover returns the endpoints of p, fetching the discovery document on
+// the first call that succeeds.
+func (p *Provider) discover(ctx context.Context) (*discovery, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.endpoints != nil {
+		return p.endpoints, nil
+	}
+
+	var doc discovery
+	if err := getJSON(ctx, p.client, strings.TrimSuffix(p.cfg.Issuer, "/")+"/.well-known/openid-configuration", &doc, nil); err != nil {
+		return nil, fmt.Errorf("oidc: discovery: %w", err)
+	}
+	if doc.Issuer != p.cfg.Issuer {
+		return nil, fmt.Errorf("oidc: discovery: provider calls itself %q, expected %q", doc.Issuer, p.cfg.Issuer)
+	}
+	if doc.AuthorizationEndpoint == "" || doc.TokenEndpoint == "" || doc.JWKSURI == "" {
+		return nil, errors.New("oidc: discovery: document lacks an endpoint")
+	}
+	p.endpoints = &doc
+	p.keys = NewKeySet(doc.JWKSURI, p.client)
+	return p.endpoints, nil
+}
+
+// AuthCodeURL returns the provider URL that starts a login. state and nonce
+// tie the response to this login and verifier is its PKCE code verifier;
+// the caller keeps all three until the provider redirects back.
+func (p *Provider) AuthCodeURL(ctx context.Context, state, nonce, verifier string) (string, error) {
+	endpoints, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+	q := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.cfg.ClientID},
+		"redirect_uri":          {p.cfg.RedirectURL},
+		"scope":                 {strings.Join(append([]string{"openid"}, p.cfg.Scopes...), " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {Challenge(verifier)},
+		"code_challenge_method": {"S256"},
+	}
+	sep := "?"
+	if strings.Contains(endpoints.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return endpoints.AuthorizationEndpoint + sep + q.Encode(), nil
+}
+
+// Exchange trades the authorization code the provider redirected back with
+// for an ID token, and returns its verified claims.
+func (p *Provider) Exchange(ctx context.Context, code, verifier, nonce string) (Claims, error) {
+	endpoints, err := p.discover(ctx)
+	if err != nil {
+		return Claims{}, err
+	}
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.cfg.RedirectURL},
+		"client_id":     {p.cfg.ClientID},
+		"code_verifier": {verifier},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoints.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return Claims{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.cfg.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.cfg.ClientID), url.QueryEscape(p.cfg.ClientSecret))
+	}
+
+	var tokens struct {
+		IDToken string `json:"id_token"`
+	}
+	err = doJSON(p.client, req, &tokens, nil)
+	var status *statusError
+	if errors.As(err, &status) && status.code == http.StatusBadRequest {
+		return Claims{}, fmt.Errorf("%w: %v", ErrRejected, err)
+	}
+	if err != nil {
+		return Claims{}, fmt.Errorf("oidc: token exchange: %w", err)
+	}
+	if tokens.IDToken == "" {
+		return Claims{}, errors.New("oidc: token exchange: response has no id_token")
+	}
+	return p.Verify(ctx, tokens.IDToken, nonce, time.Now())
+}
+
+// Verify checks the signature, issuer, audience, expiry and nonce of an ID
+// token and returns its claims.
+func (p *Provider) Verify(ctx context.Context, token, nonce string, now time.Time) (Claims, error) {
+	if _, err := p.discover(ctx); err != nil {
+		return Claims{}, err
+	}
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return Claims{}, ErrInvalidToken
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil || header.Alg != "RS256" {
+		return Claims{}, ErrInvalidToken
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return Claims{}, ErrInvalidToken
+	}
+	key, err := p.keys.Key(ctx, header.Kid)
+	if err != nil {
+		return Claims{}, err
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], sig) != nil {
+		return Claims{}, ErrInvalidToken
+	}
+
+	var claims Claims
+	if err := decodeSegment(parts[1], &claims.raw); err != nil {
+		return Claims{}, ErrInvalidToken
+	}
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return Claims{}, ErrInvalidToken
+	}
+	switch {
+	case claims.Issuer != p.cfg.Issuer,
+		!slices.Contains(claims.Audience, p.cfg.ClientID),
+		claims.Subject == "",
+		now.Add(-clockSkew).Unix() >= claims.Expiry,
+		claims.IssuedAt > now.Add(clockSkew).Unix(),
+		claims.Nonce != nonce:
+		return Claims{}, ErrInvalidToken
+	}
+	return claims, nil
+}
+
+// Claims are the claims of a verified ID token.
+type Claims struct {
+	Issuer        string   `json:"iss"`
+	Subject       string   `json:"sub"`
+	Audience      audience `json:"aud"`
+	Expiry        int64    `json:"exp"`
+	IssuedAt      int64    `json:"iat"`
+	Nonce         string   `json:"nonce"`
+	Email         string   `json:"email"`
+	EmailVerified bool     `json:"email_verified"`
+
+	raw map[string]interface{}
+}
+
+// Values returns the string values of the claim called name, which may be
+// a single string or an array of them, as group claims usually are.
+func (c Claims) Values(name string) []string {
+	switch v := c.raw[name].(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		var values []string
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+// audience is the aud claim, which is a string or an array of strings.
+type audience []string
+
+func (a *audience) UnmarshalJSON(data []byte) error {
+	var one string
+	if err := json.Unmarshal(data, &one); err == nil {
+		*a = audience{one}
+		return nil
+	}
+	var many []string
+	if err := json.Unmarshal(data, &many); err != nil {
+		return err
+	}
+	*a = many
+	return nil
+}
+
+// NewVerifier returns a random PKCE code verifier. It also serves for the
+// state and nonce of a login.
+func NewVerifier() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// Challenge returns the S256 PKCE code challenge for verifier.
+func Challenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func decodeSegment(seg string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+// getJSON fetches url and decodes the JSON body into v. The response
+// headers are passed to header, when it is not nil.
+func getJSON(ctx context.Context, client *http.Client, url string, v interface{}, header func(http.Header)) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	return doJSON(client, req, v, header)
+}
+
+func doJSON(client *http.Client, req *http.Request, v interface{}, header func(http.Header)) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return &statusError{code: resp.StatusCode, msg: fmt.Sprintf("%s %s: %s: %s", req.Method, req.URL.Redacted(), resp.Status, strings.TrimSpace(string(body)))}
+	}
+	if header != nil {
+		header(resp.Header)
+	}
+	return json.Unmarshal(body, v)
+}
+
+// statusError is a response from the provider with an unexpected status.
+type statusError struct {
+	code int
+	msg  string
+}
+
+func (e *statusError) Error() string {
+	return e.msg
+}
@@ -2,26 +2,126 @@ package routes
 
 import (
 	"net/http"
+	"strconv"
+	"time"
+	"todo-api/auth"
 	"todo-api/handlers"
 )
 
-func SetupRoutes() *http.ServeMux {
+// Legacy routes are kept as aliases until legacySunset. They advertise their
+// replacement via Deprecation, Sunset and Link headers.
+var (
+	legacyDeprecated = time.Date(2026, time.October, 17, 0, 0, 0, 0, time.UTC)
+	legacySunset     = time.Date(2027, time.April, 30, 0, 0, 0, 0, time.UTC)
+)
+
+// SetupRoutes registers every endpoint on a new mux, served by srv.
+//
+// Routes use method patterns, so the mux answers a wrong method with
+// 405 Method Not Allowed and an Allow header listing the accepted ones.
+func SetupRoutes(srv *handlers.Server) *http.ServeMux {
 	mux := http.NewServeMux()
 
-	mux.HandleFunc("/todos", handlers.GetTodos)
-	mux.HandleFunc("/todo", handlers.GetTodoByID)
-	mux.HandleFunc("/todo/create", handlers.CreateTodo)
-	mux.HandleFunc("/todoss",handlers.GetTodosWithFilterSortPagination)
-	mux.HandleFunc("/update-todo", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != http.MethodPut {
-			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
-			return
-		}
-		handlers.UpdateTodo(w, r)
-	})
+	mux.HandleFunc("GET /todos", srv.GetTodos)
+	mux.HandleFunc("POST /todos", srv.CreateTodo)
+	mux.HandleFunc("GET /todos/{id}", srv.GetTodoByID)
+	mux.HandleFunc("PUT /todos/{id}", srv.ReplaceTodo)
+	mux.HandleFunc("PATCH /todos/{id}", srv.PatchTodo)
+	mux.HandleFunc("DELETE /todos/{id}", srv.DeleteTodo)
+	mux.HandleFunc("GET /todos/{id}/logs", srv.GetTodoLogs)
+	mux.HandleFunc("POST /todos/{id}/restore", srv.RestoreTodo)
+	mux.HandleFunc("GET /todos/trash", srv.GetTrash)
+	mux.HandleFunc("GET /todos/search", srv.SearchTodos)
+	mux.HandleFunc("DELETE /todos/trash/{id}", srv.PurgeTodo)
+	mux.HandleFunc("GET /logs", srv.GetAllLogs)
+	mux.HandleFunc("GET /users", srv.ListUsers)
+	mux.HandleFunc("PUT /users/{id}/role", srv.SetUserRole)
+
+	mux.HandleFunc("PUT /todos/{id}/project", srv.MoveTodo)
+	mux.HandleFunc("GET /projects", srv.ListProjects)
+	mux.HandleFunc("POST /projects", srv.CreateProject)
+	mux.HandleFunc("GET /projects/{id}", srv.GetProject)
+	mux.HandleFunc("PATCH /projects/{id}", srv.UpdateProject)
+	mux.HandleFunc("DELETE /projects/{id}", srv.DeleteProject)
+
+	mux.HandleFunc("GET /workspaces", srv.ListWorkspaces)
+	mux.HandleFunc("POST /workspaces", srv.CreateWorkspace)
+	mux.HandleFunc("GET /workspaces/{id}", srv.GetWorkspace)
+	mux.HandleFunc("PUT /workspaces/{id}/settings", srv.UpdateWorkspaceSettings)
+	mux.HandleFunc("GET /workspaces/{id}/members", srv.ListMembers)
+	mux.HandleFunc("DELETE /workspaces/{id}/members/{user_id}", srv.RemoveMember)
+	mux.HandleFunc("POST /workspaces/{id}/invitations", srv.CreateInvitation)
+	mux.HandleFunc("GET /workspaces/{id}/invitations", srv.ListInvitations)
+	mux.HandleFunc("DELETE /workspaces/{id}/invitations/{invitation_id}", srv.DeleteInvitation)
+	mux.HandleFunc("POST /invitations/accept", srv.AcceptInvitation)
+
+	mux.HandleFunc("POST /auth/register", srv.Register)
+	mux.HandleFunc("POST /auth/login", srv.Login)
+	mux.HandleFunc("POST /auth/refresh", srv.Refresh)
+	mux.HandleFunc("POST /auth/logout", srv.Logout)
+	mux.HandleFunc("GET /auth/oidc/login", srv.OIDCLogin)
+	mux.HandleFunc("GET /auth/oidc/callback", srv.OIDCCallback)
+	mux.HandleFunc("GET /auth/me", srv.GetMe)
+	mux.HandleFunc("GET /auth/permissions", srv.GetPermissions)
+	mux.HandleFunc("POST /auth/keys", srv.CreateAPIKey)
+	mux.HandleFunc("GET /auth/keys", srv.ListAPIKeys)
+	mux.HandleFunc("DELETE /auth/keys/{id}", srv.RevokeAPIKey)
 
-	mux.HandleFunc("/todo/delete/", handlers.DeleteTodo)
-	mux.HandleFunc("/todo/logs", handlers.GetAllLogs)
+	// Deprecated aliases for the original verb-in-path routes
+	mux.Handle("GET /todo", deprecated("/todos/{id}", srv.GetTodoByID))
+	mux.Handle("POST /todo/create", deprecated("/todos", srv.CreateTodo))
+	mux.Handle("GET /todoss", deprecated("/todos", srv.GetTodosWithFilterSortPagination))
+	mux.Handle("PUT /update-todo", deprecated("/todos/{id}", srv.UpdateTodo))
+	mux.Handle("DELETE /todo/delete/", deprecated("/todos/{id}", srv.DeleteTodo))
+	mux.Handle("GET /todo/logs", deprecated("/logs", srv.GetAllLogs))
 
 	return mux
 }
+
+// Scopes gives the scope an API key needs for each route registered by
+// SetupRoutes, for handlers.RequireScopes. The account routes are left out,
+// so keys can't be used to sign in or to manage keys. Scopes only narrow
+// what a key can do; the role of its user still applies.
+var Scopes = map[string]auth.Scope{
+	"GET /todos":               auth.ScopeTodosRead,
+	"POST /todos":              auth.ScopeTodosWrite,
+	"GET /todos/{id}":          auth.ScopeTodosRead,
+	"PUT /todos/{id}":          auth.ScopeTodosWrite,
+	"PATCH /todos/{id}":        auth.ScopeTodosWrite,
+	"DELETE /todos/{id}":       auth.ScopeTodosWrite,
+	"GET /todos/{id}/logs":     auth.ScopeLogsRead,
+	"POST /todos/{id}/restore": auth.ScopeTodosWrite,
+	"GET /todos/trash":         auth.ScopeTodosRead,
+	"GET /todos/search":        auth.ScopeTodosRead,
+	"PUT /todos/{id}/project":  auth.ScopeTodosWrite,
+	"GET /projects":            auth.ScopeTodosRead,
+	"POST /projects":           auth.ScopeTodosWrite,
+	"GET /projects/{id}":       auth.ScopeTodosRead,
+	"PATCH /projects/{id}":     auth.ScopeTodosWrite,
+	"DELETE /projects/{id}":    auth.ScopeTodosWrite,
+	"DELETE /todos/trash/{id}": auth.ScopeAdmin,
+	"GET /logs":                auth.ScopeLogsRead,
+	"GET /users":               auth.ScopeAdmin,
+	"PUT /users/{id}/role":     auth.ScopeAdmin,
+	"GET /auth/permissions":    "",
+	"GET /workspaces":          auth.ScopeTodosRead,
+	"GET /workspaces/{id}":     auth.ScopeTodosRead,
+
+	"GET /todo":            auth.ScopeTodosRead,
+	"POST /todo/create":    auth.ScopeTodosWrite,
+	"GET /todoss":          auth.ScopeTodosRead,
+	"PUT /update-todo":     auth.ScopeTodosWrite,
+	"DELETE /todo/delete/": auth.ScopeTodosWrite,
+	"GET /todo/logs":       auth.ScopeLogsRead,
+}
+
+// deprecated wraps a legacy route so responses carry the RFC 9745 Deprecation
+// and RFC 8594 Sunset headers plus a link to the successor route.
+func deprecated(successor string, next http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Deprecation", "@"+strconv.FormatInt(legacyDeprecated.Unix(), 10))
+		w.Header().Set("Sunset", legacySunset.Format(http.TimeFormat))
+		w.Header().Set("Link", "<"+successor+`>; rel="successor-version"`)
+		next(w, r)
+	})
+}
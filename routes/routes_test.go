@@ -0,0 +1,99 @@
+package routes_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"todo-api/config"
+	"todo-api/handlers"
+	"todo-api/routes"
+	"todo-api/store"
+)
+
+const adminToken = "test-admin-token"
+
+func newHandler(t *testing.T) (http.Handler, *http.ServeMux) {
+	t.Helper()
+	cfg := config.Default()
+	cfg.Storage.Driver = "memory"
+	cfg.API.AdminToken = adminToken
+	srv, err := handlers.NewServer(cfg, store.NewMemory())
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	t.Cleanup(func() { srv.Close(context.Background()) })
+	mux := routes.SetupRoutes(srv)
+	return handlers.RequestID(handlers.ProblemErrors(srv.Authenticate(handlers.RequireScopes(mux, routes.Scopes)))), mux
+}
+
+func serve(h http.Handler, method, path string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	req.Header.Set("Authorization", "Bearer "+adminToken)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestMethodNotAllowed(t *testing.T) {
+	h, _ := newHandler(t)
+	tests := []struct {
+		method, path string
+		allow        []string
+	}{
+		{method: "DELETE", path: "/todos", allow: []string{"GET", "POST"}},
+		{method: "POST", path: "/todos/00000000-0000-0000-0000-000000000001", allow: []string{"GET", "PUT", "PATCH", "DELETE"}},
+		{method: "GET", path: "/auth/login", allow: []string{"POST"}},
+		{method: "POST", path: "/todoss", allow: []string{"GET"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			rec := serve(h, tt.method, tt.path)
+			if rec.Code != http.StatusMethodNotAllowed {
+				t.Fatalf("status = %d, want 405", rec.Code)
+			}
+			allow := rec.Header().Get("Allow")
+			for _, m := range tt.allow {
+				if !strings.Contains(allow, m) {
+					t.Errorf("Allow = %q, want it to list %s", allow, m)
+				}
+			}
+		})
+	}
+}
+
+func TestLegacyRoutesAreDeprecated(t *testing.T) {
+	h, _ := newHandler(t)
+	tests := []struct {
+		method, path, successor string
+	}{
+		{method: "GET", path: "/todoss", successor: "/todos"},
+		{method: "GET", path: "/todo/logs", successor: "/logs"},
+		{method: "GET", path: "/todo?id=00000000-0000-0000-0000-000000000001", successor: "/todos/{id}"},
+	}
+	for _, tt := range tests {
+		rec := serve(h, tt.method, tt.path)
+		if rec.Header().Get("Deprecation") == "" || rec.Header().Get("Sunset") == "" {
+			t.Errorf("%s %s: no Deprecation and Sunset headers", tt.method, tt.path)
+		}
+		if want := "<" + tt.successor + `>; rel="successor-version"`; rec.Header().Get("Link") != want {
+			t.Errorf("%s %s: Link = %q, want %q", tt.method, tt.path, rec.Header().Get("Link"), want)
+		}
+	}
+	if rec := serve(h, "GET", "/todos"); rec.Header().Get("Deprecation") != "" {
+		t.Error("GET /todos is marked deprecated")
+	}
+}
+
+// Every entry of Scopes must name a registered route, or it guards nothing.
+func TestScopesNameRoutes(t *testing.T) {
+	_, mux := newHandler(t)
+	for pattern := range routes.Scopes {
+		method, path, _ := strings.Cut(pattern, " ")
+		path = strings.NewReplacer("{id}", "x", "{user_id}", "y").Replace(path)
+		if _, registered := mux.Handler(httptest.NewRequest(method, path, nil)); registered != pattern {
+			t.Errorf("Scopes has %q, but %s %s is served by %q", pattern, method, path, registered)
+		}
+	}
+}
@@ -0,0 +1,942 @@
+package store
+
+import (
+	"context"
+	"maps"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"todo-api/filter"
+	"todo-api/models"
+
+	"github.com/google/uuid"
+)
+
+// Memory is a Store that keeps everything in process memory. It is meant for
+// tests and local demos; nothing survives a restart.
+type Memory struct {
+	mu   *sync.RWMutex
+	data *memoryData
+	inTx bool // the lock is already held by Atomic
+}
+
+type memoryData struct {
+	todos         map[uuid.UUID]models.Todo
+	logs          []models.Log
+	nextID        int
+	users         map[uuid.UUID]models.User
+	refreshTokens map[string]models.RefreshToken // by hash
+	apiKeys       map[uuid.UUID]models.APIKey
+	workspaces    map[uuid.UUID]models.Workspace
+	members       map[membershipKey]models.Membership
+	invitations   map[uuid.UUID]models.Invitation
+	projects      map[uuid.UUID]models.Project
+}
+
+type membershipKey struct{ workspace, user uuid.UUID }
+
+// NewMemory returns an empty in-memory Store.
+func NewMemory() *Memory {
+	return &Memory{mu: &sync.RWMutex{}, data: &memoryData{
+		todos:         map[uuid.UUID]models.Todo{},
+		users:         map[uuid.UUID]models.User{},
+		refreshTokens: map[string]models.RefreshToken{},
+		apiKeys:       map[uuid.UUID]models.APIKey{},
+		workspaces:    map[uuid.UUID]models.Workspace{},
+		members:       map[membershipKey]models.Membership{},
+		invitations:   map[uuid.UUID]models.Invitation{},
+		projects:      map[uuid.UUID]models.Project{},
+	}}
+}
+
+// Atomic holds the write lock while fn runs and restores a snapshot of the
+// data if fn fails.
+func (m *Memory) Atomic(ctx context.Context, fn func(tx Store) error) error {
+	if m.inTx {
+		return fn(m)
+	}
+	defer m.lock()()
+
+	snapshot := *m.data
+	snapshot.todos = make(map[uuid.UUID]models.Todo, len(m.data.todos))
+	for id, todo := range m.data.todos {
+		snapshot.todos[id] = todo
+	}
+	snapshot.logs = m.data.logs[:len(m.data.logs):len(m.data.logs)]
+	snapshot.users = maps.Clone(m.data.users)
+	snapshot.refreshTokens = maps.Clone(m.data.refreshTokens)
+	snapshot.apiKeys = maps.Clone(m.data.apiKeys)
+	snapshot.workspaces = maps.Clone(m.data.workspaces)
+	snapshot.members = maps.Clone(m.data.members)
+	snapshot.invitations = maps.Clone(m.data.invitations)
+	snapshot.projects = maps.Clone(m.data.projects)
+
+	if err := fn(&Memory{mu: m.mu, data: m.data, inTx: true}); err != nil {
+		*m.data = snapshot
+		return err
+	}
+	return nil
+}
+
+// Scope runs fn: everything the in-memory store holds is visible to
+// everyone it hands it to.
+func (m *Memory) Scope(ctx context.Context, workspace uuid.UUID, fn func(ctx context.Context) error) error {
+	return fn(ctx)
+}
+
+// lock and rlock take the mutex unless Atomic already holds it, and return
+// the matching unlock.
+func (m *Memory) lock() func() {
+	if m.inTx {
+		return func() {}
+	}
+	m.mu.Lock()
+	return m.mu.Unlock
+}
+
+func (m *Memory) rlock() func() {
+	if m.inTx {
+		return func() {}
+	}
+	m.mu.RLock()
+	return m.mu.RUnlock
+}
+
+func (m *Memory) CreateTodo(ctx context.Context, todo *models.Todo) error {
+	defer m.lock()()
+
+	todo.CreatedAt = time.Now()
+	todo.IsDeleted = false
+	todo.Version = 1
+	m.data.todos[todo.ID] = *todo
+	return nil
+}
+
+func (m *Memory) GetTodo(ctx context.Context, id uuid.UUID, vis Visibility) (models.Todo, error) {
+	defer m.rlock()()
+
+	todo, ok := m.data.todos[id]
+	if !ok || !vis.Allows(todo) {
+		return models.Todo{}, ErrNotFound
+	}
+	return todo, nil
+}
+
+// versioned returns the todo a versioned write may change, or the reason it
+// may not. The caller holds the write lock.
+func (m *Memory) versioned(id uuid.UUID, version int, wantDeleted bool) (models.Todo, error) {
+	todo, ok := m.data.todos[id]
+	if !ok {
+		return models.Todo{}, ErrNotFound
+	}
+	if err := versionError(todo.Version, todo.IsDeleted, version, wantDeleted); err != nil {
+		return models.Todo{}, err
+	}
+	return todo, nil
+}
+
+// matching returns the todos passing the filters in opts, in no order.
+func (m *Memory) matching(opts ListOptions) []models.Todo {
+	defer m.rlock()()
+
+	var todos []models.Todo
+	for _, todo := range m.data.todos {
+		if !opts.Deleted.Allows(todo) {
+			continue
+		}
+		if opts.Status != "" && todo.Status != opts.Status {
+			continue
+		}
+		if opts.DueDate != nil && !sameDay(todo.DueDate.Time, *opts.DueDate) {
+			continue
+		}
+		if opts.Workspace != uuid.Nil && !inWorkspace(todo.WorkspaceID, opts.Workspace) {
+			continue
+		}
+		if opts.Project != uuid.Nil && (todo.ProjectID == nil || *todo.ProjectID != opts.Project) {
+			continue
+		}
+		if !opts.Archived && todo.ProjectID != nil && m.data.projects[*todo.ProjectID].Archived {
+			continue
+		}
+		if opts.Filter != nil && !filter.Match(opts.Filter, filterValue(todo)) {
+			continue
+		}
+		todos = append(todos, todo)
+	}
+	return todos
+}
+
+func (m *Memory) ListTodos(ctx context.Context, opts ListOptions) ([]models.Todo, int, error) {
+	terms, err := opts.sortTerms()
+	if err != nil {
+		return nil, 0, err
+	}
+	todos := m.matching(opts)
+
+	// position compares a todo with a cursor in the requested sort order.
+	position := func(todo models.Todo, c Cursor) int {
+		return compareCursors(opts.Cursor(todo), c, terms)
+	}
+	sort.Slice(todos, func(i, j int) bool {
+		return position(todos[i], opts.Cursor(todos[j])) < 0
+	})
+
+	total := len(todos)
+	if opts.SkipCount {
+		total = -1
+	}
+	if opts.Page.After != nil {
+		return keysetPage(todos, opts.Page, opts.Limit, func(todo models.Todo) int {
+			return position(todo, *opts.Page.After)
+		}), total, nil
+	}
+	return paginate(todos, opts.Limit, opts.Offset), total, nil
+}
+
+// SearchTodos matches whole words (or word prefixes) without stemming and
+// ranks title matches above description matches.
+func (m *Memory) SearchTodos(ctx context.Context, query SearchQuery, opts ListOptions) ([]models.SearchHit, int, error) {
+	if query.Empty() {
+		return nil, 0, nil
+	}
+
+	var hits []models.SearchHit
+	for _, todo := range m.matching(opts) {
+		var titleSpans, descSpans []span
+		matched := true
+		for _, term := range query.Terms {
+			t, d := term.find(todo.Title), term.find(todo.Description)
+			if len(t) == 0 && len(d) == 0 {
+				matched = false
+				break
+			}
+			titleSpans, descSpans = append(titleSpans, t...), append(descSpans, d...)
+		}
+		if !matched {
+			continue
+		}
+		hits = append(hits, models.SearchHit{
+			Todo: todo,
+			Rank: float64(len(titleSpans)) + 0.4*float64(len(descSpans)),
+			Highlights: models.Highlights{
+				Title:       mark(todo.Title, titleSpans),
+				Description: mark(todo.Description, descSpans),
+			},
+		})
+	}
+
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Rank != hits[j].Rank {
+			return hits[i].Rank > hits[j].Rank
+		}
+		return hits[i].Todo.ID.String() < hits[j].Todo.ID.String()
+	})
+	return paginate(hits, opts.Limit, opts.Offset), len(hits), nil
+}
+
+func (m *Memory) UpdateTodo(ctx context.Context, id uuid.UUID, version int, update TodoUpdate) (models.Todo, error) {
+	defer m.lock()()
+
+	todo, err := m.versioned(id, version, false)
+	if err != nil {
+		return todo, err
+	}
+	if update.Empty() && update.StartedAt == nil && update.CompletedAt == nil {
+		return todo, nil
+	}
+	if update.Title != nil {
+		todo.Title = *update.Title
+	}
+	if update.Description != nil {
+		todo.Description = *update.Description
+	}
+	if update.Status != nil {
+		todo.Status = *update.Status
+	}
+	if update.DueDate != nil {
+		todo.DueDate = *update.DueDate
+	}
+	if update.ProjectID != nil {
+		todo.ProjectID = nil
+		if *update.ProjectID != uuid.Nil {
+			project := *update.ProjectID
+			todo.ProjectID = &project
+		}
+	}
+	if update.StartedAt != nil {
+		todo.StartedAt = timeOrNil(*update.StartedAt)
+	}
+	if update.CompletedAt != nil {
+		todo.CompletedAt = timeOrNil(*update.CompletedAt)
+	}
+	todo.Version++
+	m.data.todos[id] = todo
+	return todo, nil
+}
+
+func (m *Memory) DeleteTodo(ctx context.Context, id uuid.UUID, version int) error {
+	return m.setDeleted(id, version, true)
+}
+
+func (m *Memory) RestoreTodo(ctx context.Context, id uuid.UUID, version int) error {
+	return m.setDeleted(id, version, false)
+}
+
+func (m *Memory) setDeleted(id uuid.UUID, version int, deleted bool) error {
+	defer m.lock()()
+
+	todo, err := m.versioned(id, version, !deleted)
+	if err != nil {
+		return err
+	}
+	todo.IsDeleted = deleted
+	todo.DeletedAt = nil
+	if deleted {
+		now := time.Now()
+		todo.DeletedAt = &now
+	}
+	todo.Version++
+	m.data.todos[id] = todo
+	return nil
+}
+
+func (m *Memory) PurgeTodo(ctx context.Context, id uuid.UUID, version int) error {
+	defer m.lock()()
+
+	if _, err := m.versioned(id, version, true); err != nil {
+		return err
+	}
+	delete(m.data.todos, id)
+	return nil
+}
+
+func (m *Memory) PurgeDeleted(ctx context.Context, before time.Time) ([]models.Todo, error) {
+	defer m.lock()()
+
+	var purged []models.Todo
+	for id, todo := range m.data.todos {
+		if todo.IsDeleted && todo.DeletedAt != nil && todo.DeletedAt.Before(before) {
+			delete(m.data.todos, id)
+			purged = append(purged, todo)
+		}
+	}
+	return purged, nil
+}
+
+func (m *Memory) AddLog(ctx context.Context, entry models.LogEntry) error {
+	defer m.lock()()
+
+	workspace := entry.WorkspaceID
+	if workspace == nil {
+		workspace = m.data.todos[entry.TodoID].WorkspaceID
+	}
+	m.data.nextID++
+	m.data.logs = append(m.data.logs, models.Log{
+		ID:          strconv.Itoa(m.data.nextID),
+		TodoID:      entry.TodoID.String(),
+		WorkspaceID: workspace,
+		Action:      entry.Action,
+		Timestamp:   time.Now(),
+		Changes:     entry.Changes,
+	})
+	return nil
+}
+
+func (m *Memory) ListLogs(ctx context.Context, opts LogListOptions) ([]models.Log, int, error) {
+	defer m.rlock()()
+
+	// Logs are appended in order, so walking backwards gives newest first.
+	var logs []models.Log
+	for i := len(m.data.logs) - 1; i >= 0; i-- {
+		if opts.Action != "" && m.data.logs[i].Action != opts.Action {
+			continue
+		}
+		if opts.TodoID != nil && m.data.logs[i].TodoID != opts.TodoID.String() {
+			continue
+		}
+		if opts.Workspace != uuid.Nil && !inWorkspace(m.data.logs[i].WorkspaceID, opts.Workspace) {
+			continue
+		}
+		logs = append(logs, m.data.logs[i])
+	}
+
+	total := len(logs)
+	if opts.SkipCount {
+		total = -1
+	}
+	if after := opts.Page.After; after != nil {
+		// IDs grow with time, so newest first means descending IDs.
+		afterID, _ := strconv.Atoi(after.ID)
+		return keysetPage(logs, opts.Page, opts.Limit, func(l models.Log) int {
+			id, _ := strconv.Atoi(l.ID)
+			return afterID - id
+		}), total, nil
+	}
+	return paginate(logs, opts.Limit, opts.Offset), total, nil
+}
+
+// compareCursors orders positions by their keys in the direction of each
+// sort term, then by ID in the direction of the last one.
+func compareCursors(a, b Cursor, terms []SortTerm) int {
+	desc := false
+	for i, term := range terms {
+		desc = term.Desc
+		if n := strings.Compare(a.Keys[i], b.Keys[i]); n != 0 {
+			if desc {
+				return -n
+			}
+			return n
+		}
+	}
+	if desc {
+		return -strings.Compare(a.ID, b.ID)
+	}
+	return strings.Compare(a.ID, b.ID)
+}
+
+// keysetPage returns up to limit items right after the cursor in items,
+// which are sorted, or right before it when page.Backward is set. position
+// reports where an item lies relative to the cursor.
+func keysetPage[T any](items []T, page Keyset, limit int, position func(T) int) []T {
+	if !page.Backward {
+		i := sort.Search(len(items), func(i int) bool { return position(items[i]) > 0 })
+		return paginate(items[i:], limit, 0)
+	}
+	i := sort.Search(len(items), func(i int) bool { return position(items[i]) >= 0 })
+	items = items[:i]
+	if limit > 0 && len(items) > limit {
+		items = items[len(items)-limit:]
+	}
+	return items
+}
+
+// filterValue exposes the FilterFields of todo to filter.Match.
+func filterValue(todo models.Todo) func(string) interface{} {
+	stamp := func(t *time.Time) interface{} {
+		if t == nil {
+			return nil
+		}
+		return *t
+	}
+	return func(field string) interface{} {
+		switch field {
+		case "title":
+			return todo.Title
+		case "description":
+			return todo.Description
+		case "status":
+			return todo.Status
+		case "due_date":
+			return todo.DueDate.Time
+		case "created_at":
+			return todo.CreatedAt
+		case "started_at":
+			return stamp(todo.StartedAt)
+		case "completed_at":
+			return stamp(todo.CompletedAt)
+		case "deleted_at":
+			return stamp(todo.DeletedAt)
+		}
+		return nil
+	}
+}
+
+func timeOrNil(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+func sameDay(a, b time.Time) bool {
+	ay, am, ad := a.Date()
+	by, bm, bd := b.Date()
+	return ay == by && am == bm && ad == bd
+}
+
+func paginate[T any](items []T, limit, offset int) []T {
+	if offset >= len(items) {
+		return nil
+	}
+	items = items[offset:]
+	if limit > 0 && limit < len(items) {
+		items = items[:limit]
+	}
+	return items
+}
+
+func (m *Memory) CreateUser(ctx context.Context, user *models.User) error {
+	defer m.lock()()
+
+	for _, u := range m.data.users {
+		if u.Email == user.Email || user.OIDCSubject != "" && u.OIDCIssuer == user.OIDCIssuer && u.OIDCSubject == user.OIDCSubject {
+			return ErrConflict
+		}
+	}
+	user.CreatedAt = time.Now()
+	m.data.users[user.ID] = *user
+	return nil
+}
+
+func (m *Memory) GetUser(ctx context.Context, id uuid.UUID) (models.User, error) {
+	defer m.rlock()()
+
+	user, ok := m.data.users[id]
+	if !ok {
+		return models.User{}, ErrNotFound
+	}
+	return user, nil
+}
+
+func (m *Memory) GetUserByEmail(ctx context.Context, email string) (models.User, error) {
+	defer m.rlock()()
+
+	for _, user := range m.data.users {
+		if user.Email == email {
+			return user, nil
+		}
+	}
+	return models.User{}, ErrNotFound
+}
+
+func (m *Memory) ListUsers(ctx context.Context) ([]models.User, error) {
+	defer m.rlock()()
+
+	users := make([]models.User, 0, len(m.data.users))
+	for _, user := range m.data.users {
+		users = append(users, user)
+	}
+	sort.Slice(users, func(i, j int) bool {
+		if !users[i].CreatedAt.Equal(users[j].CreatedAt) {
+			return users[i].CreatedAt.Before(users[j].CreatedAt)
+		}
+		return users[i].ID.String() < users[j].ID.String()
+	})
+	return users, nil
+}
+
+func (m *Memory) GetUserByOIDC(ctx context.Context, issuer, subject string) (models.User, error) {
+	defer m.rlock()()
+
+	for _, user := range m.data.users {
+		if subject != "" && user.OIDCIssuer == issuer && user.OIDCSubject == subject {
+			return user, nil
+		}
+	}
+	return models.User{}, ErrNotFound
+}
+
+func (m *Memory) LinkOIDC(ctx context.Context, id uuid.UUID, issuer, subject string) error {
+	defer m.lock()()
+
+	user, ok := m.data.users[id]
+	if !ok {
+		return ErrNotFound
+	}
+	if user.OIDCSubject != "" {
+		return ErrConflict
+	}
+	for _, u := range m.data.users {
+		if u.OIDCIssuer == issuer && u.OIDCSubject == subject {
+			return ErrConflict
+		}
+	}
+	user.OIDCIssuer, user.OIDCSubject = issuer, subject
+	m.data.users[id] = user
+	return nil
+}
+
+func (m *Memory) SetUserRole(ctx context.Context, id uuid.UUID, role string) error {
+	defer m.lock()()
+
+	user, ok := m.data.users[id]
+	if !ok {
+		return ErrNotFound
+	}
+	user.Role = role
+	m.data.users[id] = user
+	return nil
+}
+
+func (m *Memory) AddRefreshToken(ctx context.Context, token models.RefreshToken) error {
+	defer m.lock()()
+
+	token.CreatedAt = time.Now()
+	m.data.refreshTokens[token.TokenHash] = token
+	return nil
+}
+
+func (m *Memory) GetRefreshToken(ctx context.Context, hash string) (models.RefreshToken, error) {
+	defer m.rlock()()
+
+	token, ok := m.data.refreshTokens[hash]
+	if !ok {
+		return models.RefreshToken{}, ErrNotFound
+	}
+	return token, nil
+}
+
+func (m *Memory) RevokeRefreshToken(ctx context.Context, id uuid.UUID, at time.Time) error {
+	defer m.lock()()
+
+	for hash, token := range m.data.refreshTokens {
+		if token.ID != id {
+			continue
+		}
+		if token.RevokedAt != nil {
+			return ErrConflict
+		}
+		token.RevokedAt = &at
+		m.data.refreshTokens[hash] = token
+		return nil
+	}
+	return ErrNotFound
+}
+
+func (m *Memory) RevokeTokenFamily(ctx context.Context, family uuid.UUID, at time.Time) error {
+	defer m.lock()()
+
+	for hash, token := range m.data.refreshTokens {
+		if token.Family == family && token.RevokedAt == nil {
+			token.RevokedAt = &at
+			m.data.refreshTokens[hash] = token
+		}
+	}
+	return nil
+}
+
+func (m *Memory) CreateAPIKey(ctx context.Context, key *models.APIKey) error {
+	defer m.lock()()
+
+	key.CreatedAt = time.Now()
+	m.data.apiKeys[key.ID] = *key
+	return nil
+}
+
+func (m *Memory) ListAPIKeys(ctx context.Context, user uuid.UUID) ([]models.APIKey, error) {
+	defer m.rlock()()
+
+	var keys []models.APIKey
+	for _, key := range m.data.apiKeys {
+		if key.UserID == user {
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].CreatedAt.After(keys[j].CreatedAt) })
+	return keys, nil
+}
+
+func (m *Memory) GetAPIKeyByHash(ctx context.Context, hash string) (models.APIKey, error) {
+	defer m.rlock()()
+
+	for _, key := range m.data.apiKeys {
+		if key.KeyHash == hash {
+			return key, nil
+		}
+	}
+	return models.APIKey{}, ErrNotFound
+}
+
+func (m *Memory) RevokeAPIKey(ctx context.Context, user, id uuid.UUID, at time.Time) error {
+	defer m.lock()()
+
+	key, ok := m.data.apiKeys[id]
+	switch {
+	case !ok || key.UserID != user:
+		return ErrNotFound
+	case key.RevokedAt != nil:
+		return ErrConflict
+	}
+	key.RevokedAt = &at
+	m.data.apiKeys[id] = key
+	return nil
+}
+
+func (m *Memory) TouchAPIKey(ctx context.Context, id uuid.UUID, at time.Time) error {
+	defer m.lock()()
+
+	if key, ok := m.data.apiKeys[id]; ok {
+		key.LastUsedAt = &at
+		m.data.apiKeys[id] = key
+	}
+	return nil
+}
+
+// inWorkspace reports whether a todo or log in workspace id belongs to ws.
+func inWorkspace(id *uuid.UUID, ws uuid.UUID) bool {
+	return id != nil && *id == ws
+}
+
+func (m *Memory) CreateWorkspace(ctx context.Context, ws *models.Workspace) error {
+	defer m.lock()()
+
+	ws.CreatedAt = time.Now()
+	m.data.workspaces[ws.ID] = *ws
+	return nil
+}
+
+func (m *Memory) GetWorkspace(ctx context.Context, id uuid.UUID) (models.Workspace, error) {
+	defer m.rlock()()
+
+	ws, ok := m.data.workspaces[id]
+	if !ok {
+		return models.Workspace{}, ErrNotFound
+	}
+	return ws, nil
+}
+
+func (m *Memory) UpdateWorkspaceSettings(ctx context.Context, id uuid.UUID, settings models.WorkspaceSettings) error {
+	defer m.lock()()
+
+	ws, ok := m.data.workspaces[id]
+	if !ok {
+		return ErrNotFound
+	}
+	ws.Settings = settings
+	m.data.workspaces[id] = ws
+	return nil
+}
+
+func (m *Memory) AddMember(ctx context.Context, member models.Membership) error {
+	defer m.lock()()
+
+	key := membershipKey{member.WorkspaceID, member.UserID}
+	if _, ok := m.data.members[key]; ok {
+		return ErrConflict
+	}
+	member.JoinedAt = time.Now()
+	member.Email, member.Workspace = "", nil
+	m.data.members[key] = member
+	return nil
+}
+
+func (m *Memory) GetMembership(ctx context.Context, workspace, user uuid.UUID) (models.Membership, error) {
+	defer m.rlock()()
+
+	member, ok := m.data.members[membershipKey{workspace, user}]
+	if !ok {
+		return models.Membership{}, ErrNotFound
+	}
+	return member, nil
+}
+
+func (m *Memory) ListMembers(ctx context.Context, workspace uuid.UUID) ([]models.Membership, error) {
+	defer m.rlock()()
+
+	var members []models.Membership
+	for key, member := range m.data.members {
+		if key.workspace == workspace {
+			member.Email = m.data.users[key.user].Email
+			members = append(members, member)
+		}
+	}
+	sortMemberships(members)
+	return members, nil
+}
+
+func (m *Memory) ListMemberships(ctx context.Context, user uuid.UUID) ([]models.Membership, error) {
+	defer m.rlock()()
+
+	var members []models.Membership
+	for key, member := range m.data.members {
+		if key.user == user {
+			ws := m.data.workspaces[key.workspace]
+			member.Workspace = &ws
+			members = append(members, member)
+		}
+	}
+	sortMemberships(members)
+	return members, nil
+}
+
+// sortMemberships puts members in the order they joined.
+func sortMemberships(members []models.Membership) {
+	sort.Slice(members, func(i, j int) bool {
+		if !members[i].JoinedAt.Equal(members[j].JoinedAt) {
+			return members[i].JoinedAt.Before(members[j].JoinedAt)
+		}
+		return members[i].UserID.String()+members[i].WorkspaceID.String() <
+			members[j].UserID.String()+members[j].WorkspaceID.String()
+	})
+}
+
+func (m *Memory) RemoveMember(ctx context.Context, workspace, user uuid.UUID) error {
+	defer m.lock()()
+
+	key := membershipKey{workspace, user}
+	if _, ok := m.data.members[key]; !ok {
+		return ErrNotFound
+	}
+	delete(m.data.members, key)
+	return nil
+}
+
+func (m *Memory) CreateInvitation(ctx context.Context, inv *models.Invitation) error {
+	defer m.lock()()
+
+	inv.CreatedAt = time.Now()
+	m.data.invitations[inv.ID] = *inv
+	return nil
+}
+
+func (m *Memory) ListInvitations(ctx context.Context, workspace uuid.UUID) ([]models.Invitation, error) {
+	defer m.rlock()()
+
+	var invs []models.Invitation
+	for _, inv := range m.data.invitations {
+		if inv.WorkspaceID == workspace {
+			invs = append(invs, inv)
+		}
+	}
+	sort.Slice(invs, func(i, j int) bool { return invs[i].CreatedAt.After(invs[j].CreatedAt) })
+	return invs, nil
+}
+
+func (m *Memory) GetInvitationByHash(ctx context.Context, hash string) (models.Invitation, error) {
+	defer m.rlock()()
+
+	for _, inv := range m.data.invitations {
+		if inv.TokenHash == hash {
+			return inv, nil
+		}
+	}
+	return models.Invitation{}, ErrNotFound
+}
+
+func (m *Memory) AcceptInvitation(ctx context.Context, id uuid.UUID, at time.Time) error {
+	defer m.lock()()
+
+	inv, ok := m.data.invitations[id]
+	switch {
+	case !ok:
+		return ErrNotFound
+	case inv.AcceptedAt != nil:
+		return ErrConflict
+	}
+	inv.AcceptedAt = &at
+	m.data.invitations[id] = inv
+	return nil
+}
+
+func (m *Memory) DeleteInvitation(ctx context.Context, workspace, id uuid.UUID) error {
+	defer m.lock()()
+
+	inv, ok := m.data.invitations[id]
+	if !ok || inv.WorkspaceID != workspace {
+		return ErrNotFound
+	}
+	delete(m.data.invitations, id)
+	return nil
+}
+
+// projectNamed reports whether another project of the workspace of project
+// is called name. The caller holds the lock.
+func (m *Memory) projectNamed(project models.Project, name string) bool {
+	for _, p := range m.data.projects {
+		if p.ID != project.ID && models.SameID(p.WorkspaceID, project.WorkspaceID) && strings.EqualFold(p.Name, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *Memory) CreateProject(ctx context.Context, project *models.Project) error {
+	defer m.lock()()
+
+	if m.projectNamed(*project, project.Name) {
+		return ErrConflict
+	}
+	project.CreatedAt = time.Now()
+	project.UpdatedAt = project.CreatedAt
+	project.Archived, project.ArchivedAt = false, nil
+	m.data.projects[project.ID] = *project
+	return nil
+}
+
+func (m *Memory) GetProject(ctx context.Context, id uuid.UUID) (models.Project, error) {
+	defer m.rlock()()
+
+	project, ok := m.data.projects[id]
+	if !ok {
+		return models.Project{}, ErrNotFound
+	}
+	return project, nil
+}
+
+func (m *Memory) ListProjects(ctx context.Context, opts ProjectListOptions) ([]models.Project, error) {
+	defer m.rlock()()
+
+	var projects []models.Project
+	for _, project := range m.data.projects {
+		if opts.Workspace != uuid.Nil && !inWorkspace(project.WorkspaceID, opts.Workspace) {
+			continue
+		}
+		if project.Archived && !opts.Archived {
+			continue
+		}
+		projects = append(projects, project)
+	}
+	sort.Slice(projects, func(i, j int) bool {
+		a, b := strings.ToLower(projects[i].Name), strings.ToLower(projects[j].Name)
+		if a != b {
+			return a < b
+		}
+		return projects[i].ID.String() < projects[j].ID.String()
+	})
+	return projects, nil
+}
+
+func (m *Memory) UpdateProject(ctx context.Context, id uuid.UUID, update ProjectUpdate) (models.Project, error) {
+	defer m.lock()()
+
+	project, ok := m.data.projects[id]
+	if !ok {
+		return models.Project{}, ErrNotFound
+	}
+	if update.Name == nil && update.Description == nil && update.Color == nil && update.Archived == nil {
+		return project, nil
+	}
+	if update.Name != nil {
+		if m.projectNamed(project, *update.Name) {
+			return models.Project{}, ErrConflict
+		}
+		project.Name = *update.Name
+	}
+	if update.Description != nil {
+		project.Description = *update.Description
+	}
+	if update.Color != nil {
+		project.Color = *update.Color
+	}
+	now := time.Now()
+	if update.Archived != nil {
+		project.Archived = *update.Archived
+		switch {
+		case !project.Archived:
+			project.ArchivedAt = nil
+		case project.ArchivedAt == nil:
+			project.ArchivedAt = &now
+		}
+	}
+	project.UpdatedAt = now
+	m.data.projects[id] = project
+	return project, nil
+}
+
+func (m *Memory) DeleteProject(ctx context.Context, id uuid.UUID) error {
+	defer m.lock()()
+
+	if _, ok := m.data.projects[id]; !ok {
+		return ErrNotFound
+	}
+	for _, todo := range m.data.todos {
+		if todo.ProjectID != nil && *todo.ProjectID == id {
+			return ErrConflict
+		}
+	}
+	delete(m.data.projects, id)
+	return nil
+}
@@ -0,0 +1,449 @@
+package store_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+	"todo-api/models"
+	"todo-api/store"
+
+	"github.com/google/uuid"
+)
+
+// addTodos creates a pending todo for each title and returns them.
+func addTodos(t *testing.T, st store.Store, titles ...string) []models.Todo {
+	t.Helper()
+	var todos []models.Todo
+	for _, title := range titles {
+		todo := models.Todo{ID: uuid.New(), Title: title, Status: "pending"}
+		if err := st.CreateTodo(context.Background(), &todo); err != nil {
+			t.Fatalf("CreateTodo(%q): %v", title, err)
+		}
+		todos = append(todos, todo)
+	}
+	return todos
+}
+
+func titles(todos []models.Todo) []string {
+	var out []string
+	for _, todo := range todos {
+		out = append(out, todo.Title)
+	}
+	return out
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestMemoryCreateAndGet(t *testing.T) {
+	ctx := context.Background()
+	st := store.NewMemory()
+	todo := addTodos(t, st, "write tests")[0]
+	if todo.Version != 1 || todo.CreatedAt.IsZero() || todo.IsDeleted {
+		t.Fatalf("created todo = %+v, want version 1, a creation time and not deleted", todo)
+	}
+
+	got, err := st.GetTodo(ctx, todo.ID, store.HideDeleted)
+	if err != nil || got.Title != "write tests" {
+		t.Fatalf("GetTodo = %+v, %v", got, err)
+	}
+	if _, err := st.GetTodo(ctx, uuid.New(), store.IncludeDeleted); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("GetTodo of an unknown ID: err = %v, want ErrNotFound", err)
+	}
+}
+
+func TestMemoryVersionedWrites(t *testing.T) {
+	ctx := context.Background()
+	title := "renamed"
+	tests := []struct {
+		name    string
+		deleted bool // soft delete the todo first, which makes it version 2
+		write   func(st store.Store, id uuid.UUID) error
+		want    error
+	}{
+		{name: "update", write: func(st store.Store, id uuid.UUID) error {
+			_, err := st.UpdateTodo(ctx, id, 1, store.TodoUpdate{Title: &title})
+			return err
+		}},
+		{name: "update unknown", write: func(st store.Store, id uuid.UUID) error {
+			_, err := st.UpdateTodo(ctx, uuid.New(), 1, store.TodoUpdate{Title: &title})
+			return err
+		}, want: store.ErrNotFound},
+		{name: "update stale", write: func(st store.Store, id uuid.UUID) error {
+			_, err := st.UpdateTodo(ctx, id, 2, store.TodoUpdate{Title: &title})
+			return err
+		}, want: store.ErrStale},
+		{name: "update deleted", deleted: true, write: func(st store.Store, id uuid.UUID) error {
+			_, err := st.UpdateTodo(ctx, id, 2, store.TodoUpdate{Title: &title})
+			return err
+		}, want: store.ErrDeleted},
+		{name: "stale wins over deleted", deleted: true, write: func(st store.Store, id uuid.UUID) error {
+			_, err := st.UpdateTodo(ctx, id, 1, store.TodoUpdate{Title: &title})
+			return err
+		}, want: store.ErrStale},
+		{name: "delete twice", deleted: true, write: func(st store.Store, id uuid.UUID) error {
+			return st.DeleteTodo(ctx, id, 2)
+		}, want: store.ErrDeleted},
+		{name: "restore", deleted: true, write: func(st store.Store, id uuid.UUID) error {
+			return st.RestoreTodo(ctx, id, 2)
+		}},
+		{name: "restore live", write: func(st store.Store, id uuid.UUID) error {
+			return st.RestoreTodo(ctx, id, 1)
+		}, want: store.ErrConflict},
+		{name: "purge", deleted: true, write: func(st store.Store, id uuid.UUID) error {
+			return st.PurgeTodo(ctx, id, 2)
+		}},
+		{name: "purge live", write: func(st store.Store, id uuid.UUID) error {
+			return st.PurgeTodo(ctx, id, 1)
+		}, want: store.ErrConflict},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			st := store.NewMemory()
+			todo := addTodos(t, st, "todo")[0]
+			if tt.deleted {
+				if err := st.DeleteTodo(ctx, todo.ID, 1); err != nil {
+					t.Fatalf("DeleteTodo: %v", err)
+				}
+			}
+			if err := tt.write(st, todo.ID); !errors.Is(err, tt.want) {
+				t.Errorf("err = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestMemoryUpdateBumpsVersion(t *testing.T) {
+	ctx := context.Background()
+	st := store.NewMemory()
+	todo := addTodos(t, st, "todo")[0]
+
+	title, status := "renamed", "in_progress"
+	updated, err := st.UpdateTodo(ctx, todo.ID, 1, store.TodoUpdate{Title: &title, Status: &status})
+	if err != nil {
+		t.Fatalf("UpdateTodo: %v", err)
+	}
+	if updated.Title != title || updated.Status != status || updated.Version != 2 {
+		t.Errorf("updated = %+v, want the new title and status at version 2", updated)
+	}
+	if updated.Description != todo.Description {
+		t.Errorf("description changed to %q", updated.Description)
+	}
+}
+
+func TestMemoryListTodos(t *testing.T) {
+	ctx := context.Background()
+	st := store.NewMemory()
+	todos := addTodos(t, st, "c", "a", "d", "b")
+	status := "done"
+	if _, err := st.UpdateTodo(ctx, todos[2].ID, 1, store.TodoUpdate{Status: &status}); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.DeleteTodo(ctx, todos[0].ID, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	byTitle := []store.SortTerm{{Field: "title"}}
+	tests := []struct {
+		name  string
+		opts  store.ListOptions
+		want  []string
+		total int
+	}{
+		{name: "live by title", opts: store.ListOptions{Sort: byTitle}, want: []string{"a", "b", "d"}, total: 3},
+		{name: "descending", opts: store.ListOptions{Sort: []store.SortTerm{{Field: "title", Desc: true}}}, want: []string{"d", "b", "a"}, total: 3},
+		{name: "status", opts: store.ListOptions{Status: "pending", Sort: byTitle}, want: []string{"a", "b"}, total: 2},
+		{name: "include deleted", opts: store.ListOptions{Deleted: store.IncludeDeleted, Sort: byTitle}, want: []string{"a", "b", "c", "d"}, total: 4},
+		{name: "only deleted", opts: store.ListOptions{Deleted: store.OnlyDeleted, Sort: byTitle}, want: []string{"c"}, total: 1},
+		{name: "page", opts: store.ListOptions{Sort: byTitle, Limit: 2, Offset: 1}, want: []string{"b", "d"}, total: 3},
+		{name: "past the end", opts: store.ListOptions{Sort: byTitle, Limit: 2, Offset: 5}, total: 3},
+		{name: "skip count", opts: store.ListOptions{Sort: byTitle, Limit: 1, SkipCount: true}, want: []string{"a"}, total: -1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, total, err := st.ListTodos(ctx, tt.opts)
+			if err != nil {
+				t.Fatalf("ListTodos: %v", err)
+			}
+			if !equal(titles(got), tt.want) || total != tt.total {
+				t.Errorf("ListTodos = %v (%d), want %v (%d)", titles(got), total, tt.want, tt.total)
+			}
+		})
+	}
+
+	if _, _, err := st.ListTodos(ctx, store.ListOptions{Sort: []store.SortTerm{{Field: "owner_id"}}}); !errors.Is(err, store.ErrInvalid) {
+		t.Errorf("sorting by an unknown field: err = %v, want ErrInvalid", err)
+	}
+}
+
+func TestMemoryAtomic(t *testing.T) {
+	ctx := context.Background()
+	st := store.NewMemory()
+	todo := addTodos(t, st, "todo")[0]
+	failure := errors.New("fail")
+
+	// A failed transaction leaves no trace of its writes
+	err := st.Atomic(ctx, func(tx store.Store) error {
+		addTodos(t, tx, "discarded")
+		if err := tx.DeleteTodo(ctx, todo.ID, 1); err != nil {
+			return err
+		}
+		if err := tx.AddLog(ctx, models.LogEntry{Action: "delete", TodoID: todo.ID}); err != nil {
+			return err
+		}
+		return failure
+	})
+	if !errors.Is(err, failure) {
+		t.Fatalf("Atomic = %v, want the error of fn", err)
+	}
+	all, _, _ := st.ListTodos(ctx, store.ListOptions{Deleted: store.IncludeDeleted})
+	if len(all) != 1 || all[0].IsDeleted || all[0].Version != 1 {
+		t.Errorf("after rollback todos = %+v, want the original todo only", all)
+	}
+	if logs, _, _ := st.ListLogs(ctx, store.LogListOptions{}); len(logs) != 0 {
+		t.Errorf("after rollback logs = %+v, want none", logs)
+	}
+
+	// A successful one keeps them, and nested calls join it
+	err = st.Atomic(ctx, func(tx store.Store) error {
+		if err := tx.DeleteTodo(ctx, todo.ID, 1); err != nil {
+			return err
+		}
+		return tx.Atomic(ctx, func(tx store.Store) error {
+			return tx.AddLog(ctx, models.LogEntry{Action: "delete", TodoID: todo.ID})
+		})
+	})
+	if err != nil {
+		t.Fatalf("Atomic: %v", err)
+	}
+	if _, err := st.GetTodo(ctx, todo.ID, store.OnlyDeleted); err != nil {
+		t.Errorf("deleted todo: %v", err)
+	}
+	if logs, total, _ := st.ListLogs(ctx, store.LogListOptions{}); total != 1 || logs[0].Action != "delete" {
+		t.Errorf("logs = %+v, want the delete", logs)
+	}
+}
+
+func TestMemoryListLogs(t *testing.T) {
+	ctx := context.Background()
+	st := store.NewMemory()
+	todos := addTodos(t, st, "a", "b")
+	for _, entry := range []models.LogEntry{
+		{Action: "create", TodoID: todos[0].ID},
+		{Action: "create", TodoID: todos[1].ID},
+		{Action: "update", TodoID: todos[0].ID},
+		{Action: "delete", TodoID: todos[0].ID},
+	} {
+		if err := st.AddLog(ctx, entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name  string
+		opts  store.LogListOptions
+		want  []string // actions, newest first
+		total int
+	}{
+		{name: "all", want: []string{"delete", "update", "create", "create"}, total: 4},
+		{name: "action", opts: store.LogListOptions{Action: "create"}, want: []string{"create", "create"}, total: 2},
+		{name: "todo", opts: store.LogListOptions{TodoID: &todos[0].ID}, want: []string{"delete", "update", "create"}, total: 3},
+		{name: "page", opts: store.LogListOptions{Limit: 2, Offset: 1}, want: []string{"update", "create"}, total: 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logs, total, err := st.ListLogs(ctx, tt.opts)
+			if err != nil {
+				t.Fatalf("ListLogs: %v", err)
+			}
+			var actions []string
+			for _, l := range logs {
+				actions = append(actions, l.Action)
+			}
+			if !equal(actions, tt.want) || total != tt.total {
+				t.Errorf("ListLogs = %v (%d), want %v (%d)", actions, total, tt.want, tt.total)
+			}
+		})
+	}
+}
+
+func TestMemoryKeyset(t *testing.T) {
+	ctx := context.Background()
+	st := store.NewMemory()
+	addTodos(t, st, "c", "a", "e", "b", "d")
+	opts := store.ListOptions{Sort: []store.SortTerm{{Field: "title"}}}
+	all, _, _ := st.ListTodos(ctx, opts)
+	cursorOf := func(i int) *store.Cursor {
+		c := opts.Cursor(all[i])
+		return &c
+	}
+
+	tests := []struct {
+		name string
+		page store.Keyset
+		want []string
+	}{
+		{name: "after b", page: store.Keyset{After: cursorOf(1)}, want: []string{"c", "d"}},
+		{name: "after the last", page: store.Keyset{After: cursorOf(4)}},
+		{name: "before d", page: store.Keyset{After: cursorOf(3), Backward: true}, want: []string{"b", "c"}},
+		{name: "before b", page: store.Keyset{After: cursorOf(1), Backward: true}, want: []string{"a"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := opts
+			opts.Limit, opts.Page = 2, tt.page
+			got, _, err := st.ListTodos(ctx, opts)
+			if err != nil {
+				t.Fatalf("ListTodos: %v", err)
+			}
+			if !equal(titles(got), tt.want) {
+				t.Errorf("ListTodos = %v, want %v", titles(got), tt.want)
+			}
+		})
+	}
+
+	opts.Page = store.Keyset{After: &store.Cursor{Keys: []string{"a", "b"}, ID: all[0].ID.String()}}
+	if _, _, err := st.ListTodos(ctx, opts); !errors.Is(err, store.ErrInvalid) {
+		t.Errorf("cursor for another sort order: err = %v, want ErrInvalid", err)
+	}
+}
+
+func TestMemoryPurgeDeleted(t *testing.T) {
+	ctx := context.Background()
+	st := store.NewMemory()
+	todos := addTodos(t, st, "old", "recent", "live")
+	if err := st.DeleteTodo(ctx, todos[0].ID, 1); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Millisecond)
+	cutoff := time.Now()
+	time.Sleep(time.Millisecond)
+	if err := st.DeleteTodo(ctx, todos[1].ID, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	purged, err := st.PurgeDeleted(ctx, cutoff)
+	if err != nil || len(purged) != 1 || purged[0].ID != todos[0].ID {
+		t.Fatalf("PurgeDeleted = %v, %v, want only the todo deleted before the cutoff", purged, err)
+	}
+	all, _, _ := st.ListTodos(ctx, store.ListOptions{Deleted: store.IncludeDeleted, Sort: []store.SortTerm{{Field: "title"}}})
+	if got := titles(all); !equal(got, []string{"live", "recent"}) {
+		t.Errorf("left after purging = %v, want live and recent", got)
+	}
+}
+
+func TestMemorySortByTwoFields(t *testing.T) {
+	ctx := context.Background()
+	st := store.NewMemory()
+	due := func(day int) models.CustomDate {
+		return models.CustomDate{Time: time.Date(2026, 1, day, 0, 0, 0, 0, time.UTC)}
+	}
+	for _, todo := range []models.Todo{
+		{Title: "b", DueDate: due(2)},
+		{Title: "a", DueDate: due(2)},
+		{Title: "c"},
+		{Title: "d", DueDate: due(1)},
+	} {
+		todo.ID, todo.Status = uuid.New(), "pending"
+		if err := st.CreateTodo(ctx, &todo); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	byTitle := store.SortTerm{Field: "title"}
+	tests := []struct {
+		name string
+		due  store.SortTerm
+		want []string
+	}{
+		{name: "ascending, nulls last", due: store.SortTerm{Field: "due_date"}, want: []string{"d", "a", "b", "c"}},
+		{name: "ascending, nulls first", due: store.SortTerm{Field: "due_date", Nulls: store.NullsFirst}, want: []string{"c", "d", "a", "b"}},
+		{name: "descending, nulls first", due: store.SortTerm{Field: "due_date", Desc: true}, want: []string{"c", "a", "b", "d"}},
+		{name: "descending, nulls last", due: store.SortTerm{Field: "due_date", Desc: true, Nulls: store.NullsLast}, want: []string{"a", "b", "d", "c"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			todos, _, err := st.ListTodos(ctx, store.ListOptions{Sort: []store.SortTerm{tt.due, byTitle}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := titles(todos); !equal(got, tt.want) {
+				t.Errorf("ListTodos = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMemoryProjects(t *testing.T) {
+	ctx := context.Background()
+	st := store.NewMemory()
+	ws, other := uuid.New(), uuid.New()
+	add := func(name string, workspace uuid.UUID) (models.Project, error) {
+		project := models.Project{ID: uuid.New(), WorkspaceID: &workspace, Name: name}
+		err := st.CreateProject(ctx, &project)
+		return project, err
+	}
+	home, err := add("Home", ws)
+	if err != nil {
+		t.Fatal(err)
+	}
+	work, _ := add("work", ws)
+	if _, err := add("HOME", ws); !errors.Is(err, store.ErrConflict) {
+		t.Errorf("a second Home in the workspace: err = %v, want ErrConflict", err)
+	}
+	if _, err := add("Home", other); err != nil {
+		t.Errorf("Home in another workspace: %v", err)
+	}
+	rename := "Work"
+	if _, err := st.UpdateProject(ctx, home.ID, store.ProjectUpdate{Name: &rename}); !errors.Is(err, store.ErrConflict) {
+		t.Errorf("renaming to a taken name: err = %v, want ErrConflict", err)
+	}
+
+	archived := true
+	updated, err := st.UpdateProject(ctx, work.ID, store.ProjectUpdate{Archived: &archived})
+	if err != nil || !updated.Archived || updated.ArchivedAt == nil {
+		t.Fatalf("archiving: %+v, %v", updated, err)
+	}
+	names := func(opts store.ProjectListOptions) []string {
+		projects, err := st.ListProjects(ctx, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out []string
+		for _, p := range projects {
+			out = append(out, p.Name)
+		}
+		return out
+	}
+	if got := names(store.ProjectListOptions{Workspace: ws}); !equal(got, []string{"Home"}) {
+		t.Errorf("projects = %v, want the archived one hidden", got)
+	}
+	if got := names(store.ProjectListOptions{Workspace: ws, Archived: true}); !equal(got, []string{"Home", "work"}) {
+		t.Errorf("projects with archived = %v, want both by name", got)
+	}
+
+	todo := addTodos(t, st, "in a project")[0]
+	project := home.ID
+	if _, err := st.UpdateTodo(ctx, todo.ID, todo.Version, store.TodoUpdate{ProjectID: &project}); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.DeleteProject(ctx, home.ID); !errors.Is(err, store.ErrConflict) {
+		t.Errorf("deleting a project with todos: err = %v, want ErrConflict", err)
+	}
+	if err := st.DeleteProject(ctx, work.ID); err != nil {
+		t.Errorf("deleting an empty project: %v", err)
+	}
+	if _, err := st.GetProject(ctx, work.ID); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("GetProject after deleting: err = %v, want ErrNotFound", err)
+	}
+}
@@ -0,0 +1,1154 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+	"todo-api/filter"
+	"todo-api/models"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// Postgres is the Store backed by the todos and logs tables.
+type Postgres struct {
+	db *sql.DB
+	q  querier // scopedDB, or the transaction inside Atomic
+}
+
+// querier is what *sql.DB and *sql.Tx have in common.
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// scopeKey is the context key of the transaction started by Scope.
+type scopeKey struct{}
+
+// scopedDB runs queries in the transaction of the Scope their context
+// belongs to, if any, and on db otherwise.
+type scopedDB struct{ db *sql.DB }
+
+func (s scopedDB) conn(ctx context.Context) querier {
+	if tx, ok := ctx.Value(scopeKey{}).(*sql.Tx); ok {
+		return tx
+	}
+	return s.db
+}
+
+func (s scopedDB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return s.conn(ctx).ExecContext(ctx, query, args...)
+}
+
+func (s scopedDB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return s.conn(ctx).QueryContext(ctx, query, args...)
+}
+
+func (s scopedDB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return s.conn(ctx).QueryRowContext(ctx, query, args...)
+}
+
+// NewPostgres returns a Store that runs its queries against db.
+func NewPostgres(db *sql.DB) *Postgres {
+	return &Postgres{db: db, q: scopedDB{db}}
+}
+
+// Atomic runs fn in a transaction of its own, or under a savepoint of the
+// transaction of the Scope ctx belongs to.
+func (p *Postgres) Atomic(ctx context.Context, fn func(tx Store) error) error {
+	if _, inTx := p.q.(*sql.Tx); inTx {
+		return fn(p)
+	}
+	if tx, ok := ctx.Value(scopeKey{}).(*sql.Tx); ok {
+		return savepoint(ctx, tx, func() error { return fn(&Postgres{db: p.db, q: tx}) })
+	}
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("beginning transaction: %w", err)
+	}
+	if err := fn(&Postgres{db: p.db, q: tx}); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("committing transaction: %w", err)
+	}
+	return nil
+}
+
+// savepoint runs fn in tx, undoing its writes if it fails.
+func savepoint(ctx context.Context, tx *sql.Tx, fn func() error) error {
+	if _, err := tx.ExecContext(ctx, "SAVEPOINT atomic"); err != nil {
+		return fmt.Errorf("setting savepoint: %w", err)
+	}
+	if err := fn(); err != nil {
+		if _, rbErr := tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT atomic"); rbErr != nil {
+			return fmt.Errorf("rolling back to savepoint: %w (after %w)", rbErr, err)
+		}
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "RELEASE SAVEPOINT atomic"); err != nil {
+		return fmt.Errorf("releasing savepoint: %w", err)
+	}
+	return nil
+}
+
+// Scope sets app.workspace_id, which the row-level security policies of
+// migrations 0010 and 0012 compare workspace_id with, for the length of a
+// transaction.
+func (p *Postgres) Scope(ctx context.Context, workspace uuid.UUID, fn func(ctx context.Context) error) error {
+	setting := "*"
+	if workspace != uuid.Nil {
+		setting = workspace.String()
+	}
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("beginning transaction: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, "SELECT set_config('app.workspace_id', $1, true)", setting); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("setting the workspace: %w", err)
+	}
+	if err := fn(context.WithValue(ctx, scopeKey{}, tx)); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("committing transaction: %w", err)
+	}
+	return nil
+}
+
+const todoColumns = "id, title, description, status, due_date, created_at, started_at, completed_at, is_deleted, deleted_at, version, owner_id, workspace_id, project_id"
+
+func scanTodo(row interface{ Scan(...interface{}) error }, todo *models.Todo, extra ...interface{}) error {
+	return row.Scan(append([]interface{}{&todo.ID, &todo.Title, &todo.Description, &todo.Status, &todo.DueDate, &todo.CreatedAt,
+		&todo.StartedAt, &todo.CompletedAt, &todo.IsDeleted, &todo.DeletedAt, &todo.Version, &todo.OwnerID, &todo.WorkspaceID, &todo.ProjectID}, extra...)...)
+}
+
+// todoDests gives, for each column in todoColumns, the field of a todo it
+// is scanned into.
+var todoDests = map[string]func(*models.Todo) interface{}{
+	"id":           func(t *models.Todo) interface{} { return &t.ID },
+	"title":        func(t *models.Todo) interface{} { return &t.Title },
+	"description":  func(t *models.Todo) interface{} { return &t.Description },
+	"status":       func(t *models.Todo) interface{} { return &t.Status },
+	"due_date":     func(t *models.Todo) interface{} { return &t.DueDate },
+	"created_at":   func(t *models.Todo) interface{} { return &t.CreatedAt },
+	"started_at":   func(t *models.Todo) interface{} { return &t.StartedAt },
+	"completed_at": func(t *models.Todo) interface{} { return &t.CompletedAt },
+	"is_deleted":   func(t *models.Todo) interface{} { return &t.IsDeleted },
+	"deleted_at":   func(t *models.Todo) interface{} { return &t.DeletedAt },
+	"version":      func(t *models.Todo) interface{} { return &t.Version },
+	"owner_id":     func(t *models.Todo) interface{} { return &t.OwnerID },
+	"workspace_id": func(t *models.Todo) interface{} { return &t.WorkspaceID },
+	"project_id":   func(t *models.Todo) interface{} { return &t.ProjectID },
+}
+
+// selectColumns returns the columns a listing has to load: the requested
+// fields plus the ID and the sort fields, in todoColumns order. No fields
+// means every column.
+func selectColumns(fields []string, terms []SortTerm) ([]string, error) {
+	all := strings.Split(todoColumns, ", ")
+	if len(fields) == 0 {
+		return all, nil
+	}
+	want := map[string]bool{"id": true}
+	for _, f := range fields {
+		if !SelectFields[f] {
+			return nil, fmt.Errorf("%w: unknown field %q", ErrInvalid, f)
+		}
+		want[f] = true
+	}
+	for _, term := range terms {
+		want[term.Field] = true
+	}
+	var columns []string
+	for _, c := range all {
+		if want[c] {
+			columns = append(columns, c)
+		}
+	}
+	return columns, nil
+}
+
+func (p *Postgres) CreateTodo(ctx context.Context, todo *models.Todo) error {
+	var dueDate interface{}
+	if !todo.DueDate.IsZero() {
+		dueDate = todo.DueDate.Format("2006-01-02")
+	}
+
+	query := `INSERT INTO todos (id, title, description, status, due_date, created_at, started_at, completed_at, is_deleted, owner_id, workspace_id, project_id)
+	          VALUES ($1, $2, $3, $4, $5, NOW(), $6, $7, FALSE, $8, $9, $10) RETURNING created_at, version`
+	return p.q.QueryRowContext(ctx, query, todo.ID, todo.Title, todo.Description, todo.Status, dueDate,
+		todo.StartedAt, todo.CompletedAt, todo.OwnerID, todo.WorkspaceID, todo.ProjectID).Scan(&todo.CreatedAt, &todo.Version)
+}
+
+func (p *Postgres) GetTodo(ctx context.Context, id uuid.UUID, vis Visibility) (models.Todo, error) {
+	var todo models.Todo
+	query := "SELECT " + todoColumns + " FROM todos WHERE id = $1" + visibilityClause(vis)
+	err := scanTodo(p.q.QueryRowContext(ctx, query, id), &todo)
+	if errors.Is(err, sql.ErrNoRows) {
+		return todo, ErrNotFound
+	}
+	return todo, err
+}
+
+// visibilityClause is the WHERE condition (with a leading AND) applying vis.
+func visibilityClause(vis Visibility) string {
+	switch vis {
+	case IncludeDeleted:
+		return ""
+	case OnlyDeleted:
+		return " AND is_deleted"
+	default:
+		return " AND NOT is_deleted"
+	}
+}
+
+// todoWhere builds the WHERE clause for the filters in opts.
+func todoWhere(opts ListOptions) (where string, args []interface{}) {
+	where = " WHERE 1=1" + visibilityClause(opts.Deleted)
+	if opts.Status != "" {
+		args = append(args, opts.Status)
+		where += fmt.Sprintf(" AND status = $%d", len(args))
+	}
+	if opts.DueDate != nil {
+		args = append(args, opts.DueDate.Format("2006-01-02"))
+		where += fmt.Sprintf(" AND due_date = $%d", len(args))
+	}
+	if opts.Workspace != uuid.Nil {
+		args = append(args, opts.Workspace)
+		where += fmt.Sprintf(" AND workspace_id = $%d", len(args))
+	}
+	if opts.Project != uuid.Nil {
+		args = append(args, opts.Project)
+		where += fmt.Sprintf(" AND project_id = $%d", len(args))
+	}
+	if !opts.Archived {
+		where += " AND NOT EXISTS (SELECT 1 FROM projects WHERE projects.id = todos.project_id AND projects.archived)"
+	}
+	if opts.Filter != nil {
+		clause, filterArgs := filter.SQL(opts.Filter, len(args)+1)
+		where += " AND " + clause
+		args = append(args, filterArgs...)
+	}
+	return where, args
+}
+
+func (p *Postgres) ListTodos(ctx context.Context, opts ListOptions) ([]models.Todo, int, error) {
+	// Sort and select expressions are interpolated, so only whitelisted
+	// names get through.
+	terms, err := opts.sortTerms()
+	if err != nil {
+		return nil, 0, err
+	}
+	columns, err := selectColumns(opts.Fields, terms)
+	if err != nil {
+		return nil, 0, err
+	}
+	where, args := todoWhere(opts)
+
+	total := -1
+	if !opts.SkipCount {
+		if err := p.q.QueryRowContext(ctx, "SELECT COUNT(*) FROM todos"+where, args...).Scan(&total); err != nil {
+			return nil, 0, fmt.Errorf("counting todos: %w", err)
+		}
+	}
+
+	// A backward page is read in reverse order, then flipped.
+	backward := opts.Page.After != nil && opts.Page.Backward
+	if after := opts.Page.After; after != nil {
+		where += " AND " + keysetClause(terms, *after, backward, &args)
+	}
+	query := "SELECT " + strings.Join(columns, ", ") + " FROM todos" + where + " ORDER BY " + orderClause(terms, backward)
+	query += limitClause(opts.Limit, opts.Offset, opts.Page, len(args)+1, &args)
+
+	rows, err := p.q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("listing todos: %w", err)
+	}
+	defer rows.Close()
+
+	var todos []models.Todo
+	for rows.Next() {
+		var todo models.Todo
+		dests := make([]interface{}, len(columns))
+		for i, c := range columns {
+			dests[i] = todoDests[c](&todo)
+		}
+		if err := rows.Scan(dests...); err != nil {
+			return nil, 0, fmt.Errorf("scanning todo: %w", err)
+		}
+		todos = append(todos, todo)
+	}
+	if backward {
+		slices.Reverse(todos)
+	}
+	return todos, total, rows.Err()
+}
+
+// headlineOptions mark matches in ts_headline snippets.
+const headlineOptions = "StartSel=<mark>, StopSel=</mark>"
+
+func (p *Postgres) SearchTodos(ctx context.Context, search SearchQuery, opts ListOptions) ([]models.SearchHit, int, error) {
+	if search.Empty() {
+		return nil, 0, nil
+	}
+	where, args := todoWhere(opts)
+
+	// Each term becomes its own to_tsquery over sanitised words, so the
+	// input can never inject tsquery operators.
+	var terms []string
+	for _, term := range search.Terms {
+		text := strings.Join(term.Words, " <-> ")
+		if term.Prefix {
+			text += ":*"
+		}
+		args = append(args, text)
+		terms = append(terms, fmt.Sprintf("to_tsquery('english', $%d)", len(args)))
+	}
+	from := " FROM todos, (SELECT " + strings.Join(terms, " && ") + " AS query) q" + where + " AND search @@ q.query"
+
+	var total int
+	if err := p.q.QueryRowContext(ctx, "SELECT COUNT(*)"+from, args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("counting search results: %w", err)
+	}
+
+	query := "SELECT " + todoColumns + `, ts_rank(search, q.query) AS rank,
+	        ts_headline('english', title, q.query, 'HighlightAll=true, ` + headlineOptions + `'),
+	        ts_headline('english', description, q.query, 'MaxFragments=2, MaxWords=20, MinWords=5, ` + headlineOptions + `')` +
+		from + " ORDER BY rank DESC, id"
+	query += limitClause(opts.Limit, opts.Offset, Keyset{}, len(args)+1, &args)
+
+	rows, err := p.q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("searching todos: %w", err)
+	}
+	defer rows.Close()
+
+	var hits []models.SearchHit
+	for rows.Next() {
+		var hit models.SearchHit
+		if err := scanTodo(rows, &hit.Todo, &hit.Rank, &hit.Highlights.Title, &hit.Highlights.Description); err != nil {
+			return nil, 0, fmt.Errorf("scanning search result: %w", err)
+		}
+		hits = append(hits, hit)
+	}
+	return hits, total, rows.Err()
+}
+
+// sortColumns gives, for each of SortFields, the type its cursor key is
+// cast to and whether it can be NULL.
+var sortColumns = map[string]struct {
+	cast     string
+	nullable bool
+}{
+	"id":         {"uuid", false},
+	"title":      {"text", false},
+	"status":     {"text", false},
+	"due_date":   {"date", true},
+	"created_at": {"timestamptz", false},
+	"deleted_at": {"timestamptz", true},
+}
+
+// sortExpr is the expression rows are ordered by for term. NULLs are
+// replaced by infinity or -infinity, wherever term puts them, so that keyset
+// comparisons work.
+func sortExpr(term SortTerm) string {
+	col := sortColumns[term.Field]
+	if !col.nullable {
+		return term.Field
+	}
+	unset := "-infinity"
+	if term.nullsHigh() {
+		unset = "infinity"
+	}
+	return fmt.Sprintf("COALESCE(%s, '%s'::%s)", term.Field, unset, col.cast)
+}
+
+// orderClause orders by terms, then by id in the direction of the last
+// term; reversed reverses every direction.
+func orderClause(terms []SortTerm, reversed bool) string {
+	var parts []string
+	dir := ""
+	for _, term := range terms {
+		dir = "ASC"
+		if term.Desc != reversed {
+			dir = "DESC"
+		}
+		parts = append(parts, sortExpr(term)+" "+dir)
+	}
+	return strings.Join(append(parts, "id "+dir), ", ")
+}
+
+// keysetClause selects the rows after c in the order of terms (before it
+// when reversed), appending its parameters to args. Terms may mix
+// directions, so it spells the comparison out term by term instead of
+// comparing row values.
+func keysetClause(terms []SortTerm, c Cursor, reversed bool, args *[]interface{}) string {
+	op := func(desc bool) string {
+		if desc != reversed {
+			return "<"
+		}
+		return ">"
+	}
+	var ors, equal []string
+	desc := false
+	for i, term := range terms {
+		desc = term.Desc
+		*args = append(*args, c.Keys[i])
+		param := fmt.Sprintf("$%d::%s", len(*args), sortColumns[term.Field].cast)
+		ors = append(ors, strings.Join(append(equal[:len(equal):len(equal)], sortExpr(term)+" "+op(desc)+" "+param), " AND "))
+		equal = append(equal, sortExpr(term)+" = "+param)
+	}
+	*args = append(*args, c.ID)
+	ors = append(ors, strings.Join(append(equal, fmt.Sprintf("id %s $%d::uuid", op(desc), len(*args))), " AND "))
+	return "(" + strings.Join(ors, " OR ") + ")"
+}
+
+// limitClause returns the LIMIT (and, without a keyset, OFFSET) clause,
+// appending its parameters to args.
+func limitClause(limit, offset int, page Keyset, argIndex int, args *[]interface{}) string {
+	if limit <= 0 {
+		return ""
+	}
+	if page.After != nil {
+		*args = append(*args, limit)
+		return fmt.Sprintf(" LIMIT $%d", argIndex)
+	}
+	*args = append(*args, limit, offset)
+	return fmt.Sprintf(" LIMIT $%d OFFSET $%d", argIndex, argIndex+1)
+}
+
+func (p *Postgres) UpdateTodo(ctx context.Context, id uuid.UUID, version int, update TodoUpdate) (models.Todo, error) {
+	var values []interface{}
+	var setClauses []string
+	paramIndex := 1
+
+	set := func(column string, value interface{}) {
+		setClauses = append(setClauses, fmt.Sprintf("%s=$%d", column, paramIndex))
+		values = append(values, value)
+		paramIndex++
+	}
+	if update.Title != nil {
+		set("title", *update.Title)
+	}
+	if update.Description != nil {
+		set("description", *update.Description)
+	}
+	if update.Status != nil {
+		set("status", *update.Status)
+	}
+	if update.DueDate != nil {
+		if update.DueDate.IsZero() {
+			set("due_date", nil)
+		} else {
+			set("due_date", update.DueDate.Format("2006-01-02"))
+		}
+	}
+	if update.ProjectID != nil {
+		if *update.ProjectID == uuid.Nil {
+			set("project_id", nil)
+		} else {
+			set("project_id", *update.ProjectID)
+		}
+	}
+	setTime := func(column string, t *time.Time) {
+		if t == nil {
+			return
+		}
+		if t.IsZero() {
+			set(column, nil)
+		} else {
+			set(column, *t)
+		}
+	}
+	setTime("started_at", update.StartedAt)
+	setTime("completed_at", update.CompletedAt)
+	if len(setClauses) == 0 {
+		todo, err := p.GetTodo(ctx, id, IncludeDeleted)
+		if err != nil {
+			return todo, err
+		}
+		return todo, versionError(todo.Version, todo.IsDeleted, version, false)
+	}
+
+	query := "UPDATE todos SET " + strings.Join(setClauses, ", ") +
+		fmt.Sprintf(", version = version + 1 WHERE id=$%d AND version=$%d AND NOT is_deleted RETURNING %s", paramIndex, paramIndex+1, todoColumns)
+	values = append(values, id, version)
+
+	var todo models.Todo
+	err := scanTodo(p.q.QueryRowContext(ctx, query, values...), &todo)
+	if errors.Is(err, sql.ErrNoRows) {
+		return todo, p.explainMiss(ctx, id, version, false)
+	}
+	return todo, err
+}
+
+// explainMiss tells apart the reasons a versioned write that needed the todo
+// to be deleted (or live, when wantDeleted is false) matched no row.
+func (p *Postgres) explainMiss(ctx context.Context, id uuid.UUID, version int, wantDeleted bool) error {
+	var current int
+	var deleted bool
+	err := p.q.QueryRowContext(ctx, "SELECT version, is_deleted FROM todos WHERE id = $1", id).Scan(&current, &deleted)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	return versionError(current, deleted, version, wantDeleted)
+}
+
+func (p *Postgres) DeleteTodo(ctx context.Context, id uuid.UUID, version int) error {
+	return p.setDeleted(ctx, id, version, true)
+}
+
+func (p *Postgres) RestoreTodo(ctx context.Context, id uuid.UUID, version int) error {
+	return p.setDeleted(ctx, id, version, false)
+}
+
+func (p *Postgres) setDeleted(ctx context.Context, id uuid.UUID, version int, deleted bool) error {
+	query := `UPDATE todos SET is_deleted = $1, deleted_at = CASE WHEN $1 THEN NOW() END, version = version + 1
+	          WHERE id = $2 AND version = $3 AND is_deleted = NOT $1`
+	return p.execVersioned(ctx, id, version, !deleted, query, deleted, id, version)
+}
+
+func (p *Postgres) PurgeTodo(ctx context.Context, id uuid.UUID, version int) error {
+	return p.execVersioned(ctx, id, version, true, "DELETE FROM todos WHERE id = $1 AND version = $2 AND is_deleted", id, version)
+}
+
+// execVersioned runs a write guarded by id, version and deletion state and
+// explains why when it matched nothing.
+func (p *Postgres) execVersioned(ctx context.Context, id uuid.UUID, version int, wantDeleted bool, query string, args ...interface{}) error {
+	res, err := p.q.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return p.explainMiss(ctx, id, version, wantDeleted)
+	}
+	return nil
+}
+
+func (p *Postgres) PurgeDeleted(ctx context.Context, before time.Time) ([]models.Todo, error) {
+	rows, err := p.q.QueryContext(ctx, "DELETE FROM todos WHERE is_deleted AND deleted_at < $1 RETURNING "+todoColumns, before)
+	if err != nil {
+		return nil, fmt.Errorf("purging todos: %w", err)
+	}
+	defer rows.Close()
+
+	var todos []models.Todo
+	for rows.Next() {
+		var todo models.Todo
+		if err := scanTodo(rows, &todo); err != nil {
+			return nil, fmt.Errorf("scanning purged todo: %w", err)
+		}
+		todos = append(todos, todo)
+	}
+	return todos, rows.Err()
+}
+
+func (p *Postgres) AddLog(ctx context.Context, entry models.LogEntry) error {
+	var changes interface{}
+	if len(entry.Changes) > 0 {
+		b, err := json.Marshal(entry.Changes)
+		if err != nil {
+			return fmt.Errorf("encoding log changes: %w", err)
+		}
+		changes = string(b)
+	}
+	// Entries take the workspace of their todo, if it has one.
+	query := `INSERT INTO logs (action, todo_id, message, details, changes, timestamp, workspace_id)
+	          VALUES ($1, $2, $3, $4, $5, NOW(), COALESCE($6, (SELECT workspace_id FROM todos WHERE id = $2)))`
+	_, err := p.q.ExecContext(ctx, query, entry.Action, entry.TodoID, entry.Message, entry.Details, changes, entry.WorkspaceID)
+	return err
+}
+
+func (p *Postgres) ListLogs(ctx context.Context, opts LogListOptions) ([]models.Log, int, error) {
+	where := " WHERE 1=1"
+	var args []interface{}
+	argIndex := 1
+
+	if opts.Action != "" {
+		where += fmt.Sprintf(" AND action = $%d", argIndex)
+		args = append(args, opts.Action)
+		argIndex++
+	}
+	if opts.TodoID != nil {
+		where += fmt.Sprintf(" AND todo_id = $%d", argIndex)
+		args = append(args, *opts.TodoID)
+		argIndex++
+	}
+	if opts.Workspace != uuid.Nil {
+		where += fmt.Sprintf(" AND workspace_id = $%d", argIndex)
+		args = append(args, opts.Workspace)
+		argIndex++
+	}
+
+	total := -1
+	if !opts.SkipCount {
+		if err := p.q.QueryRowContext(ctx, "SELECT COUNT(*) FROM logs"+where, args...).Scan(&total); err != nil {
+			return nil, 0, fmt.Errorf("counting logs: %w", err)
+		}
+	}
+
+	backward := opts.Page.After != nil && opts.Page.Backward
+	sortOrder := "DESC"
+	if after := opts.Page.After; after != nil {
+		op := "<"
+		if backward {
+			op, sortOrder = ">", "ASC"
+		}
+		where += fmt.Sprintf(" AND (timestamp, id) %s ($%d::timestamptz, $%d::bigint)", op, argIndex, argIndex+1)
+		if len(after.Keys) != 1 {
+			return nil, 0, fmt.Errorf("%w: cursor does not match the log order", ErrInvalid)
+		}
+		args = append(args, after.Keys[0], after.ID)
+		argIndex += 2
+	}
+	query := "SELECT id, todo_id, workspace_id, action, timestamp, changes FROM logs" + where +
+		fmt.Sprintf(" ORDER BY timestamp %s, id %s", sortOrder, sortOrder)
+	query += limitClause(opts.Limit, opts.Offset, opts.Page, argIndex, &args)
+
+	rows, err := p.q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("listing logs: %w", err)
+	}
+	defer rows.Close()
+
+	var logs []models.Log
+	for rows.Next() {
+		var l models.Log
+		var changes []byte
+		if err := rows.Scan(&l.ID, &l.TodoID, &l.WorkspaceID, &l.Action, &l.Timestamp, &changes); err != nil {
+			return nil, 0, fmt.Errorf("scanning log: %w", err)
+		}
+		if changes != nil {
+			if err := json.Unmarshal(changes, &l.Changes); err != nil {
+				return nil, 0, fmt.Errorf("decoding log changes: %w", err)
+			}
+		}
+		logs = append(logs, l)
+	}
+	if backward {
+		slices.Reverse(logs)
+	}
+	return logs, total, rows.Err()
+}
+
+// isUniqueViolation reports whether err is Postgres refusing a duplicate key.
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
+
+// isForeignKeyViolation reports whether err is Postgres refusing to break a
+// reference between rows.
+func isForeignKeyViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23503"
+}
+
+func (p *Postgres) CreateUser(ctx context.Context, user *models.User) error {
+	query := `INSERT INTO users (id, email, password_hash, role, oidc_issuer, oidc_subject, created_at)
+	          VALUES ($1, $2, $3, $4, $5, $6, NOW()) RETURNING created_at`
+	err := p.q.QueryRowContext(ctx, query, user.ID, user.Email, user.PasswordHash, user.Role, user.OIDCIssuer, user.OIDCSubject).
+		Scan(&user.CreatedAt)
+	if isUniqueViolation(err) {
+		return ErrConflict
+	}
+	return err
+}
+
+func (p *Postgres) GetUser(ctx context.Context, id uuid.UUID) (models.User, error) {
+	return p.getUser(ctx, "id = $1", id)
+}
+
+func (p *Postgres) GetUserByEmail(ctx context.Context, email string) (models.User, error) {
+	return p.getUser(ctx, "email = $1", email)
+}
+
+func (p *Postgres) GetUserByOIDC(ctx context.Context, issuer, subject string) (models.User, error) {
+	return p.getUser(ctx, "oidc_issuer = $1 AND oidc_subject = $2 AND oidc_subject <> ''", issuer, subject)
+}
+
+func (p *Postgres) getUser(ctx context.Context, where string, args ...interface{}) (models.User, error) {
+	var user models.User
+	err := scanUser(p.q.QueryRowContext(ctx, "SELECT "+userColumns+" FROM users WHERE "+where, args...), &user)
+	if errors.Is(err, sql.ErrNoRows) {
+		return user, ErrNotFound
+	}
+	return user, err
+}
+
+func (p *Postgres) ListUsers(ctx context.Context) ([]models.User, error) {
+	rows, err := p.q.QueryContext(ctx, "SELECT "+userColumns+" FROM users ORDER BY created_at, id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []models.User
+	for rows.Next() {
+		var user models.User
+		if err := scanUser(rows, &user); err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+func (p *Postgres) LinkOIDC(ctx context.Context, id uuid.UUID, issuer, subject string) error {
+	res, err := p.q.ExecContext(ctx, `UPDATE users SET oidc_issuer = $2, oidc_subject = $3
+	                                  WHERE id = $1 AND oidc_subject = ''`, id, issuer, subject)
+	if isUniqueViolation(err) {
+		return ErrConflict
+	}
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil || n > 0 {
+		return err
+	}
+	var exists bool
+	if err := p.q.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM users WHERE id = $1)", id).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		return ErrNotFound
+	}
+	return ErrConflict
+}
+
+func (p *Postgres) SetUserRole(ctx context.Context, id uuid.UUID, role string) error {
+	res, err := p.q.ExecContext(ctx, "UPDATE users SET role = $2 WHERE id = $1", id, role)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// userColumns are the users columns read by scanUser, in order.
+const userColumns = "id, email, password_hash, role, oidc_issuer, oidc_subject, created_at"
+
+func scanUser(row interface{ Scan(...interface{}) error }, user *models.User) error {
+	return row.Scan(&user.ID, &user.Email, &user.PasswordHash, &user.Role, &user.OIDCIssuer, &user.OIDCSubject, &user.CreatedAt)
+}
+
+func (p *Postgres) AddRefreshToken(ctx context.Context, token models.RefreshToken) error {
+	query := `INSERT INTO refresh_tokens (id, user_id, family, token_hash, expires_at, created_at)
+	          VALUES ($1, $2, $3, $4, $5, NOW())`
+	_, err := p.q.ExecContext(ctx, query, token.ID, token.UserID, token.Family, token.TokenHash, token.ExpiresAt)
+	return err
+}
+
+func (p *Postgres) GetRefreshToken(ctx context.Context, hash string) (models.RefreshToken, error) {
+	var t models.RefreshToken
+	query := `SELECT id, user_id, family, token_hash, expires_at, created_at, revoked_at FROM refresh_tokens WHERE token_hash = $1`
+	err := p.q.QueryRowContext(ctx, query, hash).
+		Scan(&t.ID, &t.UserID, &t.Family, &t.TokenHash, &t.ExpiresAt, &t.CreatedAt, &t.RevokedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return t, ErrNotFound
+	}
+	return t, err
+}
+
+func (p *Postgres) RevokeRefreshToken(ctx context.Context, id uuid.UUID, at time.Time) error {
+	res, err := p.q.ExecContext(ctx, "UPDATE refresh_tokens SET revoked_at = $2 WHERE id = $1 AND revoked_at IS NULL", id, at)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 1 {
+		return err
+	}
+	var exists bool
+	if err := p.q.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM refresh_tokens WHERE id = $1)", id).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		return ErrNotFound
+	}
+	return ErrConflict
+}
+
+func (p *Postgres) RevokeTokenFamily(ctx context.Context, family uuid.UUID, at time.Time) error {
+	_, err := p.q.ExecContext(ctx, "UPDATE refresh_tokens SET revoked_at = $2 WHERE family = $1 AND revoked_at IS NULL", family, at)
+	return err
+}
+
+// apiKeyColumns are the columns scanned by scanAPIKey.
+const apiKeyColumns = "id, user_id, name, prefix, key_hash, scopes, expires_at, created_at, last_used_at, revoked_at"
+
+func scanAPIKey(row interface{ Scan(...interface{}) error }, key *models.APIKey) error {
+	return row.Scan(&key.ID, &key.UserID, &key.Name, &key.Prefix, &key.KeyHash, pq.Array(&key.Scopes),
+		&key.ExpiresAt, &key.CreatedAt, &key.LastUsedAt, &key.RevokedAt)
+}
+
+func (p *Postgres) CreateAPIKey(ctx context.Context, key *models.APIKey) error {
+	query := `INSERT INTO api_keys (id, user_id, name, prefix, key_hash, scopes, expires_at, created_at)
+	          VALUES ($1, $2, $3, $4, $5, $6, $7, NOW()) RETURNING created_at`
+	return p.q.QueryRowContext(ctx, query, key.ID, key.UserID, key.Name, key.Prefix, key.KeyHash,
+		pq.Array(key.Scopes), key.ExpiresAt).Scan(&key.CreatedAt)
+}
+
+func (p *Postgres) ListAPIKeys(ctx context.Context, user uuid.UUID) ([]models.APIKey, error) {
+	rows, err := p.q.QueryContext(ctx, "SELECT "+apiKeyColumns+" FROM api_keys WHERE user_id = $1 ORDER BY created_at DESC", user)
+	if err != nil {
+		return nil, fmt.Errorf("listing api keys: %w", err)
+	}
+	defer rows.Close()
+
+	var keys []models.APIKey
+	for rows.Next() {
+		var key models.APIKey
+		if err := scanAPIKey(rows, &key); err != nil {
+			return nil, fmt.Errorf("scanning api key: %w", err)
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+func (p *Postgres) GetAPIKeyByHash(ctx context.Context, hash string) (models.APIKey, error) {
+	var key models.APIKey
+	err := scanAPIKey(p.q.QueryRowContext(ctx, "SELECT "+apiKeyColumns+" FROM api_keys WHERE key_hash = $1", hash), &key)
+	if errors.Is(err, sql.ErrNoRows) {
+		return key, ErrNotFound
+	}
+	return key, err
+}
+
+func (p *Postgres) RevokeAPIKey(ctx context.Context, user, id uuid.UUID, at time.Time) error {
+	res, err := p.q.ExecContext(ctx, "UPDATE api_keys SET revoked_at = $3 WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL", id, user, at)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 1 {
+		return err
+	}
+	var exists bool
+	if err := p.q.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM api_keys WHERE id = $1 AND user_id = $2)", id, user).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		return ErrNotFound
+	}
+	return ErrConflict
+}
+
+func (p *Postgres) TouchAPIKey(ctx context.Context, id uuid.UUID, at time.Time) error {
+	_, err := p.q.ExecContext(ctx, "UPDATE api_keys SET last_used_at = $2 WHERE id = $1", id, at)
+	return err
+}
+
+func (p *Postgres) CreateWorkspace(ctx context.Context, ws *models.Workspace) error {
+	settings, err := json.Marshal(ws.Settings)
+	if err != nil {
+		return fmt.Errorf("encoding workspace settings: %w", err)
+	}
+	query := `INSERT INTO workspaces (id, name, settings, created_at) VALUES ($1, $2, $3, NOW()) RETURNING created_at`
+	return p.q.QueryRowContext(ctx, query, ws.ID, ws.Name, string(settings)).Scan(&ws.CreatedAt)
+}
+
+func (p *Postgres) GetWorkspace(ctx context.Context, id uuid.UUID) (models.Workspace, error) {
+	var ws models.Workspace
+	var settings []byte
+	err := p.q.QueryRowContext(ctx, "SELECT id, name, settings, created_at FROM workspaces WHERE id = $1", id).
+		Scan(&ws.ID, &ws.Name, &settings, &ws.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ws, ErrNotFound
+	}
+	if err != nil {
+		return ws, err
+	}
+	if err := json.Unmarshal(settings, &ws.Settings); err != nil {
+		return ws, fmt.Errorf("decoding workspace settings: %w", err)
+	}
+	return ws, nil
+}
+
+func (p *Postgres) UpdateWorkspaceSettings(ctx context.Context, id uuid.UUID, settings models.WorkspaceSettings) error {
+	b, err := json.Marshal(settings)
+	if err != nil {
+		return fmt.Errorf("encoding workspace settings: %w", err)
+	}
+	res, err := p.q.ExecContext(ctx, "UPDATE workspaces SET settings = $2 WHERE id = $1", id, string(b))
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (p *Postgres) AddMember(ctx context.Context, m models.Membership) error {
+	query := `INSERT INTO workspace_members (workspace_id, user_id, role, joined_at) VALUES ($1, $2, $3, NOW())`
+	_, err := p.q.ExecContext(ctx, query, m.WorkspaceID, m.UserID, m.Role)
+	if isUniqueViolation(err) {
+		return ErrConflict
+	}
+	return err
+}
+
+func (p *Postgres) GetMembership(ctx context.Context, workspace, user uuid.UUID) (models.Membership, error) {
+	var m models.Membership
+	query := `SELECT workspace_id, user_id, role, joined_at FROM workspace_members WHERE workspace_id = $1 AND user_id = $2`
+	err := p.q.QueryRowContext(ctx, query, workspace, user).Scan(&m.WorkspaceID, &m.UserID, &m.Role, &m.JoinedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return m, ErrNotFound
+	}
+	return m, err
+}
+
+func (p *Postgres) ListMembers(ctx context.Context, workspace uuid.UUID) ([]models.Membership, error) {
+	query := `SELECT m.workspace_id, m.user_id, m.role, m.joined_at, u.email
+	          FROM workspace_members m JOIN users u ON u.id = m.user_id
+	          WHERE m.workspace_id = $1 ORDER BY m.joined_at, m.user_id`
+	rows, err := p.q.QueryContext(ctx, query, workspace)
+	if err != nil {
+		return nil, fmt.Errorf("listing members: %w", err)
+	}
+	defer rows.Close()
+
+	var members []models.Membership
+	for rows.Next() {
+		var m models.Membership
+		if err := rows.Scan(&m.WorkspaceID, &m.UserID, &m.Role, &m.JoinedAt, &m.Email); err != nil {
+			return nil, fmt.Errorf("scanning member: %w", err)
+		}
+		members = append(members, m)
+	}
+	return members, rows.Err()
+}
+
+func (p *Postgres) ListMemberships(ctx context.Context, user uuid.UUID) ([]models.Membership, error) {
+	query := `SELECT m.workspace_id, m.user_id, m.role, m.joined_at, w.id, w.name, w.settings, w.created_at
+	          FROM workspace_members m JOIN workspaces w ON w.id = m.workspace_id
+	          WHERE m.user_id = $1 ORDER BY m.joined_at, m.workspace_id`
+	rows, err := p.q.QueryContext(ctx, query, user)
+	if err != nil {
+		return nil, fmt.Errorf("listing memberships: %w", err)
+	}
+	defer rows.Close()
+
+	var members []models.Membership
+	for rows.Next() {
+		m := models.Membership{Workspace: &models.Workspace{}}
+		var settings []byte
+		if err := rows.Scan(&m.WorkspaceID, &m.UserID, &m.Role, &m.JoinedAt,
+			&m.Workspace.ID, &m.Workspace.Name, &settings, &m.Workspace.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scanning membership: %w", err)
+		}
+		if err := json.Unmarshal(settings, &m.Workspace.Settings); err != nil {
+			return nil, fmt.Errorf("decoding workspace settings: %w", err)
+		}
+		members = append(members, m)
+	}
+	return members, rows.Err()
+}
+
+func (p *Postgres) RemoveMember(ctx context.Context, workspace, user uuid.UUID) error {
+	res, err := p.q.ExecContext(ctx, "DELETE FROM workspace_members WHERE workspace_id = $1 AND user_id = $2", workspace, user)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// invitationColumns are the columns scanned by scanInvitation.
+const invitationColumns = "id, workspace_id, email, role, token_hash, invited_by, expires_at, created_at, accepted_at"
+
+func scanInvitation(row interface{ Scan(...interface{}) error }, inv *models.Invitation) error {
+	return row.Scan(&inv.ID, &inv.WorkspaceID, &inv.Email, &inv.Role, &inv.TokenHash, &inv.InvitedBy,
+		&inv.ExpiresAt, &inv.CreatedAt, &inv.AcceptedAt)
+}
+
+func (p *Postgres) CreateInvitation(ctx context.Context, inv *models.Invitation) error {
+	query := `INSERT INTO workspace_invitations (id, workspace_id, email, role, token_hash, invited_by, expires_at, created_at)
+	          VALUES ($1, $2, $3, $4, $5, $6, $7, NOW()) RETURNING created_at`
+	return p.q.QueryRowContext(ctx, query, inv.ID, inv.WorkspaceID, inv.Email, inv.Role, inv.TokenHash,
+		inv.InvitedBy, inv.ExpiresAt).Scan(&inv.CreatedAt)
+}
+
+func (p *Postgres) ListInvitations(ctx context.Context, workspace uuid.UUID) ([]models.Invitation, error) {
+	query := "SELECT " + invitationColumns + " FROM workspace_invitations WHERE workspace_id = $1 ORDER BY created_at DESC"
+	rows, err := p.q.QueryContext(ctx, query, workspace)
+	if err != nil {
+		return nil, fmt.Errorf("listing invitations: %w", err)
+	}
+	defer rows.Close()
+
+	var invs []models.Invitation
+	for rows.Next() {
+		var inv models.Invitation
+		if err := scanInvitation(rows, &inv); err != nil {
+			return nil, fmt.Errorf("scanning invitation: %w", err)
+		}
+		invs = append(invs, inv)
+	}
+	return invs, rows.Err()
+}
+
+func (p *Postgres) GetInvitationByHash(ctx context.Context, hash string) (models.Invitation, error) {
+	var inv models.Invitation
+	query := "SELECT " + invitationColumns + " FROM workspace_invitations WHERE token_hash = $1"
+	err := scanInvitation(p.q.QueryRowContext(ctx, query, hash), &inv)
+	if errors.Is(err, sql.ErrNoRows) {
+		return inv, ErrNotFound
+	}
+	return inv, err
+}
+
+func (p *Postgres) AcceptInvitation(ctx context.Context, id uuid.UUID, at time.Time) error {
+	res, err := p.q.ExecContext(ctx, "UPDATE workspace_invitations SET accepted_at = $2 WHERE id = $1 AND accepted_at IS NULL", id, at)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 1 {
+		return err
+	}
+	var exists bool
+	if err := p.q.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM workspace_invitations WHERE id = $1)", id).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		return ErrNotFound
+	}
+	return ErrConflict
+}
+
+func (p *Postgres) DeleteInvitation(ctx context.Context, workspace, id uuid.UUID) error {
+	res, err := p.q.ExecContext(ctx, "DELETE FROM workspace_invitations WHERE id = $1 AND workspace_id = $2", id, workspace)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// projectColumns are the projects columns read by scanProject, in order.
+const projectColumns = "id, workspace_id, name, description, color, archived, archived_at, created_at, updated_at"
+
+func scanProject(row interface{ Scan(...interface{}) error }, project *models.Project) error {
+	return row.Scan(&project.ID, &project.WorkspaceID, &project.Name, &project.Description, &project.Color,
+		&project.Archived, &project.ArchivedAt, &project.CreatedAt, &project.UpdatedAt)
+}
+
+func (p *Postgres) CreateProject(ctx context.Context, project *models.Project) error {
+	query := `INSERT INTO projects (id, workspace_id, name, description, color, archived, created_at, updated_at)
+	          VALUES ($1, $2, $3, $4, $5, FALSE, NOW(), NOW()) RETURNING ` + projectColumns
+	err := scanProject(p.q.QueryRowContext(ctx, query, project.ID, project.WorkspaceID, project.Name, project.Description, project.Color), project)
+	if isUniqueViolation(err) {
+		return ErrConflict
+	}
+	return err
+}
+
+func (p *Postgres) GetProject(ctx context.Context, id uuid.UUID) (models.Project, error) {
+	var project models.Project
+	err := scanProject(p.q.QueryRowContext(ctx, "SELECT "+projectColumns+" FROM projects WHERE id = $1", id), &project)
+	if errors.Is(err, sql.ErrNoRows) {
+		return project, ErrNotFound
+	}
+	return project, err
+}
+
+func (p *Postgres) ListProjects(ctx context.Context, opts ProjectListOptions) ([]models.Project, error) {
+	var args []interface{}
+	where := " WHERE 1=1"
+	if opts.Workspace != uuid.Nil {
+		args = append(args, opts.Workspace)
+		where += fmt.Sprintf(" AND workspace_id = $%d", len(args))
+	}
+	if !opts.Archived {
+		where += " AND NOT archived"
+	}
+	rows, err := p.q.QueryContext(ctx, "SELECT "+projectColumns+" FROM projects"+where+" ORDER BY lower(name), id", args...)
+	if err != nil {
+		return nil, fmt.Errorf("listing projects: %w", err)
+	}
+	defer rows.Close()
+
+	var projects []models.Project
+	for rows.Next() {
+		var project models.Project
+		if err := scanProject(rows, &project); err != nil {
+			return nil, fmt.Errorf("scanning project: %w", err)
+		}
+		projects = append(projects, project)
+	}
+	return projects, rows.Err()
+}
+
+func (p *Postgres) UpdateProject(ctx context.Context, id uuid.UUID, update ProjectUpdate) (models.Project, error) {
+	var values []interface{}
+	var setClauses []string
+	set := func(column string, value interface{}) {
+		values = append(values, value)
+		setClauses = append(setClauses, fmt.Sprintf("%s = $%d", column, len(values)))
+	}
+	if update.Name != nil {
+		set("name", *update.Name)
+	}
+	if update.Description != nil {
+		set("description", *update.Description)
+	}
+	if update.Color != nil {
+		set("color", *update.Color)
+	}
+	if update.Archived != nil {
+		set("archived", *update.Archived)
+		// Archiving again keeps the original time
+		setClauses = append(setClauses, fmt.Sprintf(
+			"archived_at = CASE WHEN $%d THEN COALESCE(archived_at, NOW()) END", len(values)))
+	}
+	if len(setClauses) == 0 {
+		return p.GetProject(ctx, id)
+	}
+
+	values = append(values, id)
+	query := "UPDATE projects SET " + strings.Join(setClauses, ", ") +
+		fmt.Sprintf(", updated_at = NOW() WHERE id = $%d RETURNING %s", len(values), projectColumns)
+	var project models.Project
+	err := scanProject(p.q.QueryRowContext(ctx, query, values...), &project)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return project, ErrNotFound
+	case isUniqueViolation(err):
+		return project, ErrConflict
+	}
+	return project, err
+}
+
+func (p *Postgres) DeleteProject(ctx context.Context, id uuid.UUID) error {
+	res, err := p.q.ExecContext(ctx, "DELETE FROM projects WHERE id = $1", id)
+	if isForeignKeyViolation(err) {
+		return ErrConflict
+	}
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
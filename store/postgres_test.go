@@ -0,0 +1,63 @@
+package store
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestOrderClause(t *testing.T) {
+	tests := []struct {
+		terms    []SortTerm
+		reversed bool
+		want     string
+	}{
+		{terms: []SortTerm{{Field: "title"}}, want: "title ASC, id ASC"},
+		{terms: []SortTerm{{Field: "title"}}, reversed: true, want: "title DESC, id DESC"},
+		{terms: []SortTerm{{Field: "status"}, {Field: "created_at", Desc: true}}, want: "status ASC, created_at DESC, id DESC"},
+		{terms: []SortTerm{{Field: "due_date"}}, want: "COALESCE(due_date, 'infinity'::date) ASC, id ASC"},
+		{terms: []SortTerm{{Field: "due_date", Nulls: NullsFirst}}, want: "COALESCE(due_date, '-infinity'::date) ASC, id ASC"},
+		{terms: []SortTerm{{Field: "deleted_at", Desc: true, Nulls: NullsLast}},
+			want: "COALESCE(deleted_at, '-infinity'::timestamptz) DESC, id DESC"},
+	}
+	for _, tt := range tests {
+		if got := orderClause(tt.terms, tt.reversed); got != tt.want {
+			t.Errorf("orderClause(%+v, %v) = %s, want %s", tt.terms, tt.reversed, got, tt.want)
+		}
+	}
+}
+
+func TestKeysetClause(t *testing.T) {
+	terms := []SortTerm{{Field: "title"}, {Field: "created_at", Desc: true}}
+	c := Cursor{Keys: []string{"b", "2026-01-02T00:00:00Z"}, ID: "42"}
+	tests := []struct {
+		reversed bool
+		want     string
+	}{
+		{want: "(title > $2::text OR title = $2::text AND created_at < $3::timestamptz OR " +
+			"title = $2::text AND created_at = $3::timestamptz AND id < $4::uuid)"},
+		{reversed: true, want: "(title < $2::text OR title = $2::text AND created_at > $3::timestamptz OR " +
+			"title = $2::text AND created_at = $3::timestamptz AND id > $4::uuid)"},
+	}
+	for _, tt := range tests {
+		args := []interface{}{"earlier"}
+		if got := keysetClause(terms, c, tt.reversed, &args); got != tt.want {
+			t.Errorf("keysetClause(reversed %v) = %s, want %s", tt.reversed, got, tt.want)
+		}
+		if want := []interface{}{"earlier", "b", "2026-01-02T00:00:00Z", "42"}; !reflect.DeepEqual(args, want) {
+			t.Errorf("args = %v, want %v", args, want)
+		}
+	}
+}
+
+func TestSelectColumns(t *testing.T) {
+	columns, err := selectColumns([]string{"status", "title"}, []SortTerm{{Field: "due_date"}})
+	if want := []string{"id", "title", "status", "due_date"}; err != nil || !reflect.DeepEqual(columns, want) {
+		t.Errorf("selectColumns = %v, %v, want %v", columns, err, want)
+	}
+	if columns, _ := selectColumns(nil, nil); len(columns) != 14 {
+		t.Errorf("selectColumns without fields = %v, want every column", columns)
+	}
+	if _, err := selectColumns([]string{"password_hash"}, nil); err == nil {
+		t.Error("selectColumns accepted an unknown field")
+	}
+}
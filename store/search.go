@@ -0,0 +1,126 @@
+package store
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// SearchQuery is a parsed full-text search. A todo matches when it matches
+// every term.
+type SearchQuery struct {
+	Terms []SearchTerm
+}
+
+// SearchTerm is one word, a word prefix, or a phrase of consecutive words.
+type SearchTerm struct {
+	Words  []string // lower case; several for a phrase
+	Prefix bool     // the last word may be the start of a longer word
+}
+
+// ParseSearch reads a search string: bare words must all appear, "quoted
+// words" must appear together in that order, and a trailing * (as in
+// invoi*) matches any word starting with what precedes it.
+func ParseSearch(q string) SearchQuery {
+	var query SearchQuery
+	for q = strings.TrimSpace(q); q != ""; q = strings.TrimSpace(q) {
+		var raw string
+		phrase := strings.HasPrefix(q, `"`)
+		if phrase {
+			end := strings.Index(q[1:], `"`)
+			if end < 0 {
+				end = len(q) - 1
+			}
+			raw, q = q[1:end+1], q[min(end+2, len(q)):]
+		} else {
+			end := strings.IndexFunc(q, unicode.IsSpace)
+			if end < 0 {
+				end = len(q)
+			}
+			raw, q = q[:end], q[end:]
+		}
+
+		term := SearchTerm{Words: searchWords(raw)}
+		if !phrase && strings.HasSuffix(raw, "*") {
+			term.Prefix = true
+		}
+		if len(term.Words) > 0 {
+			query.Terms = append(query.Terms, term)
+		}
+	}
+	return query
+}
+
+// Empty reports whether the query has nothing to search for.
+func (q SearchQuery) Empty() bool {
+	return len(q.Terms) == 0
+}
+
+// searchWords splits s into lower-case words of letters and digits.
+func searchWords(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// span is the byte range of a match in a text.
+type span struct{ start, end int }
+
+// find returns where the term occurs in text, for the in-memory store.
+func (t SearchTerm) find(text string) []span {
+	words := wordSpans(text)
+	var found []span
+	for i := 0; i+len(t.Words) <= len(words); i++ {
+		ok := true
+		for j, want := range t.Words {
+			got := strings.ToLower(text[words[i+j].start:words[i+j].end])
+			last := j == len(t.Words)-1
+			if got != want && !(last && t.Prefix && strings.HasPrefix(got, want)) {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			found = append(found, span{words[i].start, words[i+len(t.Words)-1].end})
+		}
+	}
+	return found
+}
+
+// wordSpans returns the positions of the words in text, split like
+// searchWords splits them.
+func wordSpans(text string) []span {
+	var spans []span
+	start := -1
+	for i, r := range text {
+		inWord := unicode.IsLetter(r) || unicode.IsDigit(r)
+		switch {
+		case inWord && start < 0:
+			start = i
+		case !inWord && start >= 0:
+			spans = append(spans, span{start, i})
+			start = -1
+		}
+	}
+	if start >= 0 {
+		spans = append(spans, span{start, len(text)})
+	}
+	return spans
+}
+
+// mark wraps the spans of text in <mark></mark>, like ts_headline does.
+func mark(text string, spans []span) string {
+	sort.Slice(spans, func(i, j int) bool { return spans[i].start < spans[j].start })
+	var b strings.Builder
+	pos := 0
+	for _, s := range spans {
+		if s.start < pos {
+			continue // overlaps the previous match
+		}
+		b.WriteString(text[pos:s.start])
+		b.WriteString("<mark>" + text[s.start:s.end] + "</mark>")
+		pos = s.end
+	}
+	b.WriteString(text[pos:])
+	return b.String()
+}
@@ -0,0 +1,92 @@
+package store_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"todo-api/models"
+	"todo-api/store"
+
+	"github.com/google/uuid"
+)
+
+func TestParseSearch(t *testing.T) {
+	tests := []struct {
+		q    string
+		want []store.SearchTerm
+	}{
+		{q: "", want: nil},
+		{q: `  "" * , `, want: nil},
+		{q: "Milk", want: []store.SearchTerm{{Words: []string{"milk"}}}},
+		{q: "buy  milk", want: []store.SearchTerm{{Words: []string{"buy"}}, {Words: []string{"milk"}}}},
+		{q: "invoi*", want: []store.SearchTerm{{Words: []string{"invoi"}, Prefix: true}}},
+		{q: `"Pay the rent" soon`, want: []store.SearchTerm{{Words: []string{"pay", "the", "rent"}}, {Words: []string{"soon"}}}},
+		{q: `"unclosed phrase`, want: []store.SearchTerm{{Words: []string{"unclosed", "phrase"}}}},
+		{q: `"no prefix*"`, want: []store.SearchTerm{{Words: []string{"no", "prefix"}}}},
+		{q: "e-mail", want: []store.SearchTerm{{Words: []string{"e", "mail"}}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.q, func(t *testing.T) {
+			got := store.ParseSearch(tt.q)
+			if !reflect.DeepEqual(got.Terms, tt.want) {
+				t.Errorf("ParseSearch = %+v, want %+v", got.Terms, tt.want)
+			}
+			if got.Empty() != (len(tt.want) == 0) {
+				t.Errorf("Empty = %v", got.Empty())
+			}
+		})
+	}
+}
+
+func TestMemorySearchTodos(t *testing.T) {
+	ctx := context.Background()
+	st := store.NewMemory()
+	for _, todo := range []models.Todo{
+		{Title: "Send invoices", Description: "Invoice the March work"},
+		{Title: "Pay the rent", Description: "Rent is due on the first"},
+		{Title: "Call the landlord", Description: "about the rent increase"},
+		{Title: "Invoice", Status: "done"},
+	} {
+		todo.ID = uuid.New()
+		if todo.Status == "" {
+			todo.Status = "pending"
+		}
+		if err := st.CreateTodo(ctx, &todo); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		q      string
+		opts   store.ListOptions
+		titles []string // best match first
+		marked string   // title highlight of the first hit
+	}{
+		{q: "rent", titles: []string{"Pay the rent", "Call the landlord"}, marked: "Pay the <mark>rent</mark>"},
+		{q: "invoi*", titles: []string{"Send invoices", "Invoice"}, marked: "Send <mark>invoices</mark>"},
+		{q: "invoice", titles: []string{"Invoice", "Send invoices"}, marked: "<mark>Invoice</mark>"},
+		{q: `"the rent"`, titles: []string{"Pay the rent", "Call the landlord"}},
+		{q: `"rent the"`},
+		{q: "rent landlord", titles: []string{"Call the landlord"}, marked: "Call the <mark>landlord</mark>"},
+		{q: "invoi*", opts: store.ListOptions{Status: "done"}, titles: []string{"Invoice"}},
+		{q: "groceries"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.q, func(t *testing.T) {
+			hits, total, err := st.SearchTodos(ctx, store.ParseSearch(tt.q), tt.opts)
+			if err != nil {
+				t.Fatalf("SearchTodos: %v", err)
+			}
+			var got []string
+			for _, hit := range hits {
+				got = append(got, hit.Todo.Title)
+			}
+			if !equal(got, tt.titles) || total != len(tt.titles) {
+				t.Fatalf("SearchTodos = %v (%d), want %v", got, total, tt.titles)
+			}
+			if tt.marked != "" && hits[0].Highlights.Title != tt.marked {
+				t.Errorf("highlighted title = %q, want %q", hits[0].Highlights.Title, tt.marked)
+			}
+		})
+	}
+}
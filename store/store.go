@@ -0,0 +1,431 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+	"todo-api/filter"
+	"todo-api/models"
+
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrNotFound is returned when the requested todo does not exist.
+	ErrNotFound = errors.New("store: not found")
+	// ErrConflict is returned when a write clashes with the current state.
+	ErrConflict = errors.New("store: conflict")
+	// ErrStale is returned when a write names a version that is no longer current.
+	ErrStale = errors.New("store: stale version")
+	// ErrDeleted is returned when a write targets a soft deleted todo.
+	ErrDeleted = errors.New("store: todo is deleted")
+	// ErrInvalid is returned (usually wrapped) when input is rejected by the store.
+	ErrInvalid = errors.New("store: invalid input")
+)
+
+// TodoStore persists todo items.
+//
+// Soft deleted todos follow one rule on every path: reads hide them unless
+// the caller passes a Visibility that asks for them, and writes other than
+// RestoreTodo and PurgeTodo refuse them with ErrDeleted. Versioned writes
+// that match nothing fail with ErrNotFound, ErrStale, ErrDeleted or
+// ErrConflict (the todo is not in the state the write needs), in that order.
+type TodoStore interface {
+	CreateTodo(ctx context.Context, todo *models.Todo) error
+	// GetTodo returns the todo with the given ID, or ErrNotFound if it does
+	// not exist or is deleted and vis hides it.
+	GetTodo(ctx context.Context, id uuid.UUID, vis Visibility) (models.Todo, error)
+	// ListTodos returns one page of todos matching opts and the total number
+	// of matches, or -1 when opts.SkipCount is set.
+	ListTodos(ctx context.Context, opts ListOptions) ([]models.Todo, int, error)
+	// SearchTodos returns one page of the todos matching query and the
+	// filters in opts, best match first, and the total number of matches.
+	// Sorting and keyset options are ignored.
+	SearchTodos(ctx context.Context, query SearchQuery, opts ListOptions) ([]models.SearchHit, int, error)
+	// UpdateTodo applies update to a live todo still at version, bumping the
+	// version.
+	UpdateTodo(ctx context.Context, id uuid.UUID, version int, update TodoUpdate) (models.Todo, error)
+	// DeleteTodo soft deletes a live todo at version by setting is_deleted.
+	DeleteTodo(ctx context.Context, id uuid.UUID, version int) error
+	// RestoreTodo clears is_deleted on a soft deleted todo at version.
+	RestoreTodo(ctx context.Context, id uuid.UUID, version int) error
+	// PurgeTodo permanently removes a soft deleted todo at version. Its logs
+	// are kept.
+	PurgeTodo(ctx context.Context, id uuid.UUID, version int) error
+	// PurgeDeleted permanently removes every todo soft deleted before the
+	// given time and returns them as they were.
+	PurgeDeleted(ctx context.Context, before time.Time) ([]models.Todo, error)
+}
+
+// LogStore persists the audit trail of todo actions.
+type LogStore interface {
+	AddLog(ctx context.Context, entry models.LogEntry) error
+	// ListLogs returns one page of logs matching opts, newest first, and the
+	// total number of matches, or -1 when opts.SkipCount is set.
+	ListLogs(ctx context.Context, opts LogListOptions) ([]models.Log, int, error)
+}
+
+// UserStore persists user accounts and the refresh tokens issued to them.
+type UserStore interface {
+	// CreateUser adds user, failing with ErrConflict if the email is taken.
+	CreateUser(ctx context.Context, user *models.User) error
+	GetUser(ctx context.Context, id uuid.UUID) (models.User, error)
+	// GetUserByEmail looks a user up by email, which is compared exactly;
+	// callers normalise it first.
+	GetUserByEmail(ctx context.Context, email string) (models.User, error)
+	// ListUsers returns every user, oldest first.
+	ListUsers(ctx context.Context) ([]models.User, error)
+	// GetUserByOIDC looks a user up by the identity they sign in with at an
+	// OpenID Connect provider.
+	GetUserByOIDC(ctx context.Context, issuer, subject string) (models.User, error)
+	// LinkOIDC lets a user sign in with the given provider identity. It
+	// fails with ErrConflict if the user is linked to another identity or
+	// the identity to another user.
+	LinkOIDC(ctx context.Context, id uuid.UUID, issuer, subject string) error
+	// SetUserRole changes the role of a user, failing with ErrNotFound if
+	// there is no such user.
+	SetUserRole(ctx context.Context, id uuid.UUID, role string) error
+
+	AddRefreshToken(ctx context.Context, token models.RefreshToken) error
+	// GetRefreshToken returns the refresh token with the given hash, revoked
+	// or not.
+	GetRefreshToken(ctx context.Context, hash string) (models.RefreshToken, error)
+	// RevokeRefreshToken marks a live refresh token as spent, failing with
+	// ErrConflict if it already was, so only one use of a token can win.
+	RevokeRefreshToken(ctx context.Context, id uuid.UUID, at time.Time) error
+	// RevokeTokenFamily revokes every live refresh token of a family.
+	RevokeTokenFamily(ctx context.Context, family uuid.UUID, at time.Time) error
+}
+
+// APIKeyStore persists the API keys users create for machine clients.
+type APIKeyStore interface {
+	CreateAPIKey(ctx context.Context, key *models.APIKey) error
+	// ListAPIKeys returns the keys of a user, revoked ones included, newest
+	// first.
+	ListAPIKeys(ctx context.Context, user uuid.UUID) ([]models.APIKey, error)
+	// GetAPIKeyByHash returns the key with the given hash, revoked or not.
+	GetAPIKeyByHash(ctx context.Context, hash string) (models.APIKey, error)
+	// RevokeAPIKey revokes a live key of user, failing with ErrNotFound if
+	// user has no such key and ErrConflict if it is already revoked.
+	RevokeAPIKey(ctx context.Context, user, id uuid.UUID, at time.Time) error
+	// TouchAPIKey records that a key was used.
+	TouchAPIKey(ctx context.Context, id uuid.UUID, at time.Time) error
+}
+
+// WorkspaceStore persists workspaces, their members and the invitations to
+// join them.
+type WorkspaceStore interface {
+	CreateWorkspace(ctx context.Context, ws *models.Workspace) error
+	GetWorkspace(ctx context.Context, id uuid.UUID) (models.Workspace, error)
+	// UpdateWorkspaceSettings replaces the settings of a workspace.
+	UpdateWorkspaceSettings(ctx context.Context, id uuid.UUID, settings models.WorkspaceSettings) error
+
+	// AddMember adds a user to a workspace, failing with ErrConflict if they
+	// already are a member.
+	AddMember(ctx context.Context, m models.Membership) error
+	GetMembership(ctx context.Context, workspace, user uuid.UUID) (models.Membership, error)
+	// ListMembers returns the members of a workspace with their emails, in
+	// the order they joined.
+	ListMembers(ctx context.Context, workspace uuid.UUID) ([]models.Membership, error)
+	// ListMemberships returns the memberships of a user with their
+	// workspaces, in the order they joined.
+	ListMemberships(ctx context.Context, user uuid.UUID) ([]models.Membership, error)
+	RemoveMember(ctx context.Context, workspace, user uuid.UUID) error
+
+	CreateInvitation(ctx context.Context, inv *models.Invitation) error
+	// ListInvitations returns the invitations to a workspace, newest first.
+	ListInvitations(ctx context.Context, workspace uuid.UUID) ([]models.Invitation, error)
+	// GetInvitationByHash returns the invitation with the given token hash,
+	// accepted or not.
+	GetInvitationByHash(ctx context.Context, hash string) (models.Invitation, error)
+	// AcceptInvitation marks an invitation accepted, failing with ErrConflict
+	// if it already was, so it can only be used once.
+	AcceptInvitation(ctx context.Context, id uuid.UUID, at time.Time) error
+	// DeleteInvitation withdraws an invitation to a workspace.
+	DeleteInvitation(ctx context.Context, workspace, id uuid.UUID) error
+}
+
+// ProjectStore persists the projects that group todos.
+type ProjectStore interface {
+	// CreateProject adds project, failing with ErrConflict if its workspace
+	// has a project of the same name, compared case-insensitively.
+	CreateProject(ctx context.Context, project *models.Project) error
+	GetProject(ctx context.Context, id uuid.UUID) (models.Project, error)
+	// ListProjects returns the projects matching opts, by name.
+	ListProjects(ctx context.Context, opts ProjectListOptions) ([]models.Project, error)
+	// UpdateProject applies update to a project and returns it, failing with
+	// ErrConflict if the new name is taken.
+	UpdateProject(ctx context.Context, id uuid.UUID, update ProjectUpdate) (models.Project, error)
+	// DeleteProject removes a project, failing with ErrConflict while any
+	// todo, deleted or not, is in it.
+	DeleteProject(ctx context.Context, id uuid.UUID) error
+}
+
+// Store combines everything the handlers need.
+type Store interface {
+	TodoStore
+	LogStore
+	UserStore
+	APIKeyStore
+	WorkspaceStore
+	ProjectStore
+
+	// Atomic runs fn in a transaction: the writes fn makes through tx are
+	// committed together if it returns nil and discarded otherwise. Calling
+	// Atomic on tx runs fn in the same transaction.
+	Atomic(ctx context.Context, fn func(tx Store) error) error
+
+	// Scope runs fn in a transaction limited to the todos and logs of one
+	// workspace, or of every workspace for uuid.Nil, by the row-level
+	// security policies. Calls made with the ctx passed to fn join the
+	// transaction, which is committed if fn returns nil and rolled back
+	// otherwise. Stores without row-level security just run fn.
+	Scope(ctx context.Context, workspace uuid.UUID, fn func(ctx context.Context) error) error
+}
+
+// Visibility says which todos a read may see with respect to soft deletion.
+// The zero value hides deleted todos.
+type Visibility int
+
+const (
+	HideDeleted    Visibility = iota // live todos only
+	IncludeDeleted                   // live and deleted todos
+	OnlyDeleted                      // deleted todos only (the trash)
+)
+
+// Allows reports whether a todo is visible.
+func (v Visibility) Allows(todo models.Todo) bool {
+	switch v {
+	case IncludeDeleted:
+		return true
+	case OnlyDeleted:
+		return todo.IsDeleted
+	default:
+		return !todo.IsDeleted
+	}
+}
+
+// SortFields lists the columns todos can be sorted by.
+var SortFields = map[string]bool{"id": true, "title": true, "status": true, "due_date": true, "created_at": true, "deleted_at": true}
+
+// SelectFields lists the todo fields a listing can be narrowed to.
+var SelectFields = map[string]bool{
+	"id": true, "title": true, "description": true, "status": true, "due_date": true, "created_at": true,
+	"started_at": true, "completed_at": true, "is_deleted": true, "deleted_at": true, "version": true, "owner_id": true,
+	"workspace_id": true, "project_id": true,
+}
+
+// Nulls says where todos with an unset sort field go.
+type Nulls int
+
+const (
+	NullsDefault Nulls = iota // last ascending, first descending, as in SQL
+	NullsFirst
+	NullsLast
+)
+
+// SortTerm orders todos by one of SortFields.
+type SortTerm struct {
+	Field string
+	Desc  bool
+	Nulls Nulls
+}
+
+// nullsHigh reports whether unset values sort above every set one.
+func (t SortTerm) nullsHigh() bool {
+	switch t.Nulls {
+	case NullsFirst:
+		return t.Desc
+	case NullsLast:
+		return !t.Desc
+	}
+	return true
+}
+
+// FilterFields are the todo fields the filter query language can test.
+var FilterFields = filter.Schema{
+	"title":        {Kind: filter.String},
+	"description":  {Kind: filter.String},
+	"status":       {Kind: filter.String},
+	"due_date":     {Kind: filter.Date, Nullable: true},
+	"created_at":   {Kind: filter.Time},
+	"started_at":   {Kind: filter.Time, Nullable: true},
+	"completed_at": {Kind: filter.Time, Nullable: true},
+	"deleted_at":   {Kind: filter.Time, Nullable: true},
+}
+
+// ListOptions filters, sorts and paginates ListTodos. Zero values mean "no filter".
+type ListOptions struct {
+	Status  string
+	DueDate *time.Time
+	Deleted Visibility
+	Filter  filter.Expr // parsed against FilterFields
+	// Workspace limits the list to the todos of one workspace; uuid.Nil
+	// means every workspace's, and todos in none.
+	Workspace uuid.UUID
+	// Project limits the list to the todos of one project; uuid.Nil means
+	// every project's, and todos in none.
+	Project uuid.UUID
+	// Archived includes the todos of archived projects, which are hidden
+	// otherwise.
+	Archived bool
+
+	// Sort defaults to created_at ascending. Ties are broken by id, in the
+	// direction of the last term.
+	Sort []SortTerm
+
+	// Fields names the SelectFields the caller needs; stores may leave the
+	// others zero. The ID and sort fields are always loaded. Empty loads all.
+	Fields []string
+
+	Limit  int // 0 returns every match
+	Offset int
+	Page   Keyset // when set, replaces Offset
+
+	SkipCount bool // don't count the matches
+}
+
+// Cursor is a position in a sorted list: the sort keys and ID of a row.
+type Cursor struct {
+	Keys []string
+	ID   string
+}
+
+// Keyset selects the rows right after Cursor in sort order, or right before
+// it when Backward is set. Rows are returned in sort order either way.
+type Keyset struct {
+	After    *Cursor
+	Backward bool
+}
+
+// sortTerms returns the sort order of opts, checking that every term names
+// one of SortFields and that the keyset cursor, if any, fits it.
+func (o ListOptions) sortTerms() ([]SortTerm, error) {
+	terms := o.Sort
+	if len(terms) == 0 {
+		terms = []SortTerm{{Field: "created_at"}}
+	}
+	for _, term := range terms {
+		if !SortFields[term.Field] {
+			return nil, fmt.Errorf("%w: cannot sort by %q", ErrInvalid, term.Field)
+		}
+	}
+	if o.Page.After != nil && len(o.Page.After.Keys) != len(terms) {
+		return nil, fmt.Errorf("%w: cursor does not match the sort order", ErrInvalid)
+	}
+	return terms, nil
+}
+
+// Cursor returns the position of todo in the list sorted as in opts.
+func (o ListOptions) Cursor(todo models.Todo) Cursor {
+	terms := o.Sort
+	if len(terms) == 0 {
+		terms = []SortTerm{{Field: "created_at"}}
+	}
+	c := Cursor{ID: todo.ID.String()}
+	for _, term := range terms {
+		c.Keys = append(c.Keys, sortKey(todo, term))
+	}
+	return c
+}
+
+// sortKey returns the value of todo's sort field as used in a Cursor. Keys
+// compare correctly as strings; unset dates become "infinity" or
+// "-infinity" depending on where term puts them.
+func sortKey(todo models.Todo, term SortTerm) string {
+	unset := "-infinity"
+	if term.nullsHigh() {
+		unset = "infinity"
+	}
+	stamp := func(t *time.Time) string {
+		if t == nil || t.IsZero() {
+			return unset
+		}
+		return t.UTC().Format(cursorTime)
+	}
+	switch term.Field {
+	case "id":
+		return todo.ID.String()
+	case "title":
+		return todo.Title
+	case "status":
+		return todo.Status
+	case "due_date":
+		if todo.DueDate.IsZero() {
+			return unset
+		}
+		return todo.DueDate.Format("2006-01-02")
+	case "deleted_at":
+		return stamp(todo.DeletedAt)
+	default:
+		return stamp(&todo.CreatedAt)
+	}
+}
+
+// LogCursor returns the position of l in the log list.
+func LogCursor(l models.Log) Cursor {
+	return Cursor{Keys: []string{l.Timestamp.UTC().Format(cursorTime)}, ID: l.ID}
+}
+
+// cursorTime formats timestamps in cursors so that they sort as strings.
+const cursorTime = "2006-01-02T15:04:05.000000000Z"
+
+// TodoUpdate holds the fields to change; nil fields are left untouched.
+type TodoUpdate struct {
+	Title       *string
+	Description *string
+	Status      *string
+	DueDate     *models.CustomDate
+	ProjectID   *uuid.UUID // uuid.Nil takes the todo out of its project
+
+	// Set by the status workflow; a zero time clears the column.
+	StartedAt   *time.Time
+	CompletedAt *time.Time
+}
+
+// Empty reports whether the update would change nothing.
+func (u TodoUpdate) Empty() bool {
+	return u.Title == nil && u.Description == nil && u.Status == nil && u.DueDate == nil && u.ProjectID == nil
+}
+
+// ProjectListOptions filters ListProjects.
+type ProjectListOptions struct {
+	Workspace uuid.UUID // as in ListOptions
+	Archived  bool      // include archived projects
+}
+
+// ProjectUpdate changes the fields of a project that are set. Archiving a
+// project stamps its archived_at; unarchiving clears it.
+type ProjectUpdate struct {
+	Name        *string
+	Description *string
+	Color       *string
+	Archived    *bool
+}
+
+// LogListOptions filters and paginates ListLogs, newest first.
+type LogListOptions struct {
+	Action    string
+	TodoID    *uuid.UUID
+	Workspace uuid.UUID // as in ListOptions
+	Limit     int
+	Offset    int
+	Page      Keyset // when set, replaces Offset; cursors come from LogCursor
+
+	SkipCount bool // don't count the matches
+}
+
+// versionError explains why a write that expected version and the given
+// deletion state cannot apply to a todo at current, or returns nil if it can.
+func versionError(current int, deleted bool, version int, wantDeleted bool) error {
+	switch {
+	case current != version:
+		return ErrStale
+	case deleted && !wantDeleted:
+		return ErrDeleted
+	case deleted != wantDeleted:
+		return ErrConflict
+	}
+	return nil
+}